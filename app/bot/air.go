@@ -0,0 +1,45 @@
+package bot
+
+import (
+	"sync"
+)
+
+// AirSwitch passes messages to the wrapped bot depending on the broadcast status.
+// Noisy bots are off during the broadcast, live-only bots are on during the broadcast
+// and get one more message after it ends, to wrap up the session
+type AirSwitch struct {
+	Interface
+	broadcast BroadcastState
+	onAir     bool
+
+	lock    sync.Mutex
+	wasLive bool
+}
+
+// OnAir makes the bot active during the broadcast only
+func OnAir(b Interface, broadcast BroadcastState) *AirSwitch {
+	return &AirSwitch{Interface: b, broadcast: broadcast, onAir: true}
+}
+
+// OffAir makes the bot silent during the broadcast
+func OffAir(b Interface, broadcast BroadcastState) *AirSwitch {
+	return &AirSwitch{Interface: b, broadcast: broadcast}
+}
+
+// OnMessage passes the message to the bot if it is active
+func (a *AirSwitch) OnMessage(msg Message) (response Response) {
+	live, _ := a.broadcast.Live()
+
+	a.lock.Lock()
+	wasLive := a.wasLive
+	a.wasLive = live
+	a.lock.Unlock()
+
+	if a.onAir && !live && !wasLive {
+		return Response{}
+	}
+	if !a.onAir && live {
+		return Response{}
+	}
+	return a.Interface.OnMessage(msg)
+}
@@ -0,0 +1,31 @@
+package bot
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAirSwitch(t *testing.T) {
+	bs := &broadcastStateMock{}
+	b := &MockInterface{}
+	b.On("OnMessage", Message{Text: "msg"}).Return(Response{Text: "resp", Send: true})
+	b.On("ReactOn").Return([]string{"msg"})
+	b.On("Help").Return("help")
+
+	on, off := OnAir(b, bs), OffAir(b, bs)
+	assert.Equal(t, []string{"msg"}, on.ReactOn())
+	assert.Equal(t, "help", off.Help())
+
+	assert.Equal(t, Response{}, on.OnMessage(Message{Text: "msg"}))
+	assert.Equal(t, Response{Text: "resp", Send: true}, off.OnMessage(Message{Text: "msg"}))
+
+	bs.live = true
+	assert.Equal(t, Response{Text: "resp", Send: true}, on.OnMessage(Message{Text: "msg"}))
+	assert.Equal(t, Response{}, off.OnMessage(Message{Text: "msg"}))
+
+	bs.live = false
+	assert.Equal(t, Response{Text: "resp", Send: true}, on.OnMessage(Message{Text: "msg"}), "wrap up after broadcast")
+	assert.Equal(t, Response{}, on.OnMessage(Message{Text: "msg"}))
+	assert.Equal(t, Response{Text: "resp", Send: true}, off.OnMessage(Message{Text: "msg"}))
+}
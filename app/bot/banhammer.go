@@ -3,7 +3,8 @@ package bot
 import (
 	"fmt"
 	"log"
-	"sort"
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
@@ -12,110 +13,193 @@ import (
 
 //go:generate mockery -name TgBanClient -case snake
 
-// Banhammer bot, allows (super users only) to ban or unban anyone
+// Banhammer bot, allows (super users only) to ban, mute and unban anyone.
+// Target defined by the replied message, by @username or by numeric user ID.
+// Optional duration and reason follow the target, i.e. "ban! @user 2h spam"
 type Banhammer struct {
 	tgClient  TgBanClient
 	superUser SuperUser
 
-	maxRecentUsers int
-	recentUsers    map[string]userInfo
-}
-
-type userInfo struct {
-	User
-	ts time.Time
+	recentUsers *recentUsers
+	recorder    SanctionRecorder
+	learners    []SpamLearner
 }
 
 // TgBanClient is a subset of tg api limited to ban-related operations only
 type TgBanClient interface {
 	KickChatMember(config tbapi.KickChatMemberConfig) (tbapi.APIResponse, error)
 	UnbanChatMember(config tbapi.ChatMemberConfig) (tbapi.APIResponse, error)
+	RestrictChatMember(config tbapi.RestrictChatMemberConfig) (tbapi.APIResponse, error)
 }
 
-// NewBanhammer makes a bot for admins reacting on ban!user unban!user
-func NewBanhammer(tgClient TgBanClient, superUser SuperUser, maxRecentUsers int) *Banhammer {
+// banCommand is a parsed ban!, unban!, mute! or unmute! request
+type banCommand struct {
+	cmd      string
+	target   string // @username, username or numeric ID, empty for reply
+	duration time.Duration
+	reason   string
+}
+
+var reBanDuration = regexp.MustCompile(`^(\d+)(s|m|h|d|w)$`)
+
+// NewBanhammer makes a bot for admins reacting on ban!user unban!user. Actions passed to recorder, if any.
+// The last message of banned user passed to learners as a spam sample
+func NewBanhammer(tgClient TgBanClient, superUser SuperUser, maxRecentUsers int, recorder SanctionRecorder,
+	learners ...SpamLearner) *Banhammer {
 	log.Printf("[INFO] Banhammer bot, max users to keep: %d, supers: %v", maxRecentUsers, superUser)
-	return &Banhammer{tgClient: tgClient, superUser: superUser, recentUsers: map[string]userInfo{}, maxRecentUsers: maxRecentUsers}
+	return &Banhammer{tgClient: tgClient, superUser: superUser, recentUsers: newRecentUsers(maxRecentUsers),
+		recorder: recorder, learners: learners}
 }
 
 // Help returns help message
 func (b *Banhammer) Help() string {
-	return genHelpMsg(b.ReactOn(), "забанить/разбанить (только для админов)")
+	return genHelpMsg(b.ReactOn(), "забанить/разбанить, заглушить/вернуть голос (только для админов). "+
+		"ответом на сообщение, @user или ID, можно срок и причину: ban! @user 2h флуд")
 }
 
 // ReactOn keys
 func (b *Banhammer) ReactOn() []string {
-	return []string{"ban!", "unban!"}
+	return []string{"ban!", "unban!", "mute!", "unmute!"}
 }
 
 // OnMessage pass msg to all bots and collects responses
 // In order to translate user name to ID (mandatory for tg kick/unban) collect up to maxRecentUsers recently seen users
 func (b *Banhammer) OnMessage(msg Message) (response Response) {
 
-	// update list of recent users
-	b.recentUsers[msg.From.Username] = userInfo{User: msg.From, ts: time.Now()}
-	if len(b.recentUsers) > b.maxRecentUsers {
-		b.cleanup()
-	}
+	b.recentUsers.seen(msg)
 
-	ok, cmd, name := b.parse(msg.Text)
+	bc, ok := b.parse(msg.Text, msg.ReplyTo != nil)
 	if !ok || !b.superUser.IsSuper(msg.From.Username) { // only super may ban/unban
 		return Response{}
 	}
 
-	if b.superUser.IsSuper(strings.TrimPrefix(name, "@")) { // super can't be banned by another super
+	user, name, found := b.recentUsers.target(bc.target, msg)
+	if !found {
+		log.Printf("[WARN] can't get ID for user %q", bc.target)
 		return Response{}
 	}
 
-	user, found := b.recentUsers[strings.TrimPrefix(name, "@")]
-	if !found {
-		log.Printf("[WARN] can't get ID for user %s", name)
+	if b.superUser.IsSuper(user.Username) { // super can't be banned by another super
 		return Response{}
 	}
 
-	switch cmd {
-	case "ban":
-		_, err := b.tgClient.KickChatMember(tbapi.KickChatMemberConfig{
-			ChatMemberConfig: tbapi.ChatMemberConfig{UserID: user.ID, ChatID: msg.ChatID},
-		})
-		if err != nil {
-			log.Printf("[WARN] failed to ban %s, %v", name, err)
-			return Response{}
-		}
-		log.Printf("[INFO] banned %+v by %+v", user.User, msg.From)
-		return Response{Text: fmt.Sprintf("прощай %s", name), Send: true}
-	case "unban":
-		_, err := b.tgClient.UnbanChatMember(tbapi.ChatMemberConfig{UserID: user.ID, ChatID: msg.ChatID})
-		if err != nil {
-			log.Printf("[WARN] failed to unban %s, %v", name, err)
-			return Response{}
+	if err := b.apply(bc, msg.ChatID, user.ID); err != nil {
+		log.Printf("[WARN] failed to %s %s, %v", bc.cmd, name, err)
+		return Response{}
+	}
+	log.Printf("[INFO] %s %+v by %+v for %v, reason: %q", bc.cmd, user.User, msg.From, bc.duration, bc.reason)
+	if b.recorder != nil {
+		s := Sanction{ChatID: msg.ChatID, User: user.User, Action: bc.cmd, Issuer: "@" + msg.From.Username,
+			Reason: bc.reason}
+		if bc.duration > 0 && (bc.cmd == ActionBan || bc.cmd == ActionMute) {
+			s.Until = time.Now().Add(bc.duration)
 		}
-		log.Printf("[INFO] unbanned %+v by %+v", user.User, msg.From)
-		return Response{Text: fmt.Sprintf("амнистия для %s", name), Send: true}
+		b.recorder.Record(s)
 	}
 
-	return Response{}
+	var text string
+	switch bc.cmd {
+	case "ban":
+		b.learn(user.lastText, msg.From.Username)
+		text = fmt.Sprintf("прощай %s", name)
+	case "mute":
+		text = fmt.Sprintf("помолчи %s", name)
+	case "unban":
+		text = fmt.Sprintf("амнистия для %s", name)
+	case "unmute":
+		text = fmt.Sprintf("снова в эфире %s", name)
+	}
+	if bc.duration > 0 && (bc.cmd == "ban" || bc.cmd == "mute") {
+		text += " на " + HumanizeDuration(bc.duration)
+	}
+	if bc.reason != "" {
+		text += ", причина: " + EscapeMarkDown(bc.reason)
+	}
+	text += fmt.Sprintf(" (%s)", EscapeMarkDown("@"+msg.From.Username)) // escaping inside italics not supported
+	return Response{Text: text, Send: true}
 }
 
-func (b *Banhammer) cleanup() {
-	users := make([]userInfo, len(b.recentUsers))
-	for _, u := range b.recentUsers {
-		users = append(users, u)
+// apply makes tg call for the command
+func (b *Banhammer) apply(bc banCommand, chatID int64, userID int) (err error) {
+	member := tbapi.ChatMemberConfig{UserID: userID, ChatID: chatID}
+	var until int64
+	if bc.duration > 0 {
+		until = time.Now().Add(bc.duration).Unix()
 	}
-	sort.Slice(users, func(i, j int) bool { return users[i].ts.Before(users[j].ts) })
-	// remove 10% of oldest records
-	for i := 0; i < b.maxRecentUsers/10; i++ {
-		delete(b.recentUsers, users[i].Username)
+
+	switch bc.cmd {
+	case "ban":
+		_, err = b.tgClient.KickChatMember(tbapi.KickChatMemberConfig{ChatMemberConfig: member, UntilDate: until})
+	case "unban":
+		_, err = b.tgClient.UnbanChatMember(member)
+	case "mute":
+		_, err = b.tgClient.RestrictChatMember(tbapi.RestrictChatMemberConfig{ChatMemberConfig: member, UntilDate: until,
+			CanSendMessages: new(bool), CanSendMediaMessages: new(bool), CanSendOtherMessages: new(bool),
+			CanAddWebPagePreviews: new(bool)})
+	case "unmute":
+		allow := true
+		_, err = b.tgClient.RestrictChatMember(tbapi.RestrictChatMemberConfig{ChatMemberConfig: member,
+			CanSendMessages: &allow, CanSendMediaMessages: &allow, CanSendOtherMessages: &allow,
+			CanAddWebPagePreviews: &allow})
 	}
+	return err
 }
 
-func (b *Banhammer) parse(text string) (react bool, cmd, name string) {
+func (b *Banhammer) learn(text, reporter string) {
+	if text == "" {
+		return
+	}
+	for _, l := range b.learners {
+		if err := l.LearnSpam(text, reporter); err != nil {
+			log.Printf("[WARN] can't learn spam from banned user's message, %v", err)
+		}
+	}
+}
 
+// parse splits command to target, duration and reason. Target is not expected in reply
+func (b *Banhammer) parse(text string, reply bool) (bc banCommand, ok bool) {
 	for _, prefix := range b.ReactOn() {
-		if strings.HasPrefix(text, prefix) {
-			return true, strings.TrimSuffix(prefix, "!"),
-				strings.Replace(strings.TrimSpace(strings.TrimPrefix(text, prefix)), " ", "+", -1)
+		if !strings.HasPrefix(text, prefix) {
+			continue
+		}
+		bc.cmd = strings.TrimSuffix(prefix, "!")
+		args := strings.Fields(strings.TrimPrefix(text, prefix))
+		if len(args) > 0 && !reply {
+			bc.target, args = args[0], args[1:]
 		}
+		if len(args) > 0 {
+			if d, isDuration := parseBanDuration(args[0]); isDuration {
+				bc.duration, args = d, args[1:]
+			}
+		}
+		bc.reason = strings.Join(args, " ")
+		return bc, true
+	}
+	return banCommand{}, false
+}
+
+// maxBanDuration is the longest temporary restriction, telegram treats longer ones as permanent
+const maxBanDuration = 366 * 24 * time.Hour
+
+// parseBanDuration parses durations like 30m, 2h, 1d or 1w. Durations longer than maxBanDuration
+// make permanent sanction, zero duration
+func parseBanDuration(s string) (time.Duration, bool) {
+	m := reBanDuration.FindStringSubmatch(strings.ToLower(s))
+	if m == nil {
+		return 0, false
+	}
+	n, err := strconv.Atoi(m[1])
+	if err != nil || n == 0 {
+		return 0, false
+	}
+	unit := map[string]time.Duration{"s": time.Second, "m": time.Minute, "h": time.Hour, "d": 24 * time.Hour,
+		"w": 7 * 24 * time.Hour}[m[2]]
+	if n > int(maxBanDuration/unit) { // checked before multiplication to avoid overflow
+		return 0, true
+	}
+	// telegram considers restrictions shorter than 30 seconds as permanent
+	if d := time.Duration(n) * unit; d >= time.Minute {
+		return d, true
 	}
-	return false, "", ""
+	return time.Minute, true
 }
@@ -3,6 +3,7 @@ package bot
 import (
 	"strconv"
 	"testing"
+	"time"
 
 	tbapi "github.com/go-telegram-bot-api/telegram-bot-api"
 	"github.com/radio-t/super-bot/app/bot/mocks"
@@ -11,35 +12,46 @@ import (
 )
 
 func TestBanhammer_Help(t *testing.T) {
-	b := NewBanhammer(nil, nil, 10)
-	assert.Equal(t, "ban!, unban! _– забанить/разбанить (только для админов)_\n", b.Help())
+	b := NewBanhammer(nil, nil, 10, nil)
+	assert.Equal(t, "ban!, unban!, mute!, unmute! _– забанить/разбанить, заглушить/вернуть голос (только для админов). "+
+		"ответом на сообщение, @user или ID, можно срок и причину: ban! @user 2h флуд_\n", b.Help())
 }
 
 func TestBanhammer_parse(t *testing.T) {
 
 	tbl := []struct {
-		text string
-		ok   bool
-		cmd  string
-		req  string
+		text  string
+		reply bool
+		ok    bool
+		bc    banCommand
 	}{
-		{"blah", false, "", ""},
-		{"ban!someone", true, "ban", "someone"},
-		{"ban! user2", true, "ban", "user2"},
-		{"unban! user2", true, "unban", "user2"},
+		{"blah", false, false, banCommand{}},
+		{"ban!someone", false, true, banCommand{cmd: "ban", target: "someone"}},
+		{"ban! user2", false, true, banCommand{cmd: "ban", target: "user2"}},
+		{"unban! user2", false, true, banCommand{cmd: "unban", target: "user2"}},
+		{"ban! @user2 2h спам и флуд", false, true, banCommand{cmd: "ban", target: "@user2", duration: 2 * time.Hour,
+			reason: "спам и флуд"}},
+		{"mute! 12345 1d", false, true, banCommand{cmd: "mute", target: "12345", duration: 24 * time.Hour}},
+		{"unmute! @user2", false, true, banCommand{cmd: "unmute", target: "@user2"}},
+		{"ban! 10s", true, true, banCommand{cmd: "ban", duration: time.Minute}},
+		{"ban! 1w флуд", true, true, banCommand{cmd: "ban", duration: 7 * 24 * time.Hour, reason: "флуд"}},
+		{"mute! флуд", true, true, banCommand{cmd: "mute", reason: "флуд"}},
+		{"mute! 366d", true, true, banCommand{cmd: "mute", duration: 366 * 24 * time.Hour}},
+		{"mute! 367d", true, true, banCommand{cmd: "mute"}},
+		{"ban! 99999999999d флуд", true, true, banCommand{cmd: "ban", reason: "флуд"}},
+		{"ban! 9999999999999999w", true, true, banCommand{cmd: "ban"}},
 	}
 
 	b := &Banhammer{}
 	for i, tt := range tbl {
 		t.Run(strconv.Itoa(i), func(t *testing.T) {
-			ok, cmd, req := b.parse(tt.text)
+			bc, ok := b.parse(tt.text, tt.reply)
 			if !tt.ok {
 				assert.False(t, ok)
 				return
 			}
 			assert.True(t, ok)
-			assert.Equal(t, tt.cmd, cmd)
-			assert.Equal(t, tt.req, req)
+			assert.Equal(t, tt.bc, bc)
 		})
 	}
 }
@@ -47,18 +59,18 @@ func TestBanhammer_parse(t *testing.T) {
 func TestBanhammer_OnMessage(t *testing.T) {
 	su := &mocks.SuperUser{}
 	tg := &mocks.TgBanClient{}
-	b := NewBanhammer(tg, su, 10)
+	b := NewBanhammer(tg, su, 10, nil)
 
-	su.On("IsSuper", "admin").Return(true).Times(2)
-	su.On("IsSuper", "user1").Return(false).Times(3)
+	su.On("IsSuper", "admin").Return(true)
+	su.On("IsSuper", "user1").Return(false)
 
 	tg.On("KickChatMember", mock.MatchedBy(func(u tbapi.KickChatMemberConfig) bool {
-		return u.UserID == 1 && u.ChatID == 123
-	})).Return(tbapi.APIResponse{}, nil)
+		return u.UserID == 1 && u.ChatID == 123 && u.UntilDate == 0
+	})).Return(tbapi.APIResponse{}, nil).Once()
 
 	tg.On("UnbanChatMember", mock.MatchedBy(func(u tbapi.ChatMemberConfig) bool {
 		return u.UserID == 1 && u.ChatID == 123
-	})).Return(tbapi.APIResponse{}, nil)
+	})).Return(tbapi.APIResponse{}, nil).Once()
 
 	resp := b.OnMessage(Message{Text: "ban! user1", From: User{Username: "user1", ID: 1}})
 	assert.Equal(t, Response{}, resp, "not admin")
@@ -67,11 +79,96 @@ func TestBanhammer_OnMessage(t *testing.T) {
 	assert.Equal(t, Response{}, resp, "not a command")
 
 	resp = b.OnMessage(Message{Text: "ban! user1", From: User{Username: "admin"}, ChatID: 123})
-	assert.Equal(t, Response{Text: "прощай user1", Send: true}, resp)
+	assert.Equal(t, Response{Text: "прощай user1 (@admin)", Send: true}, resp)
 
 	resp = b.OnMessage(Message{Text: "unban! user1", From: User{Username: "admin"}, ChatID: 123})
-	assert.Equal(t, Response{Text: "амнистия для user1", Send: true}, resp)
+	assert.Equal(t, Response{Text: "амнистия для user1 (@admin)", Send: true}, resp)
+
+	resp = b.OnMessage(Message{Text: "ban! user2", From: User{Username: "admin"}, ChatID: 123})
+	assert.Equal(t, Response{}, resp, "unknown user")
+
+	su.AssertExpectations(t)
+	tg.AssertExpectations(t)
+}
+
+func TestBanhammer_OnMessageReplyAndID(t *testing.T) {
+	su := &mocks.SuperUser{}
+	tg := &mocks.TgBanClient{}
+	rec := &MockSanctionRecorder{}
+	b := NewBanhammer(tg, su, 10, rec)
+
+	rec.On("Record", mock.MatchedBy(func(s Sanction) bool {
+		return s.User.ID == 2 && s.Action == ActionBan && s.Issuer == "@admin" && s.Reason == "флуд" &&
+			s.ChatID == 123 && s.Until.After(time.Now().Add(119*time.Minute))
+	})).Once()
+	rec.On("Record", mock.MatchedBy(func(s Sanction) bool {
+		return s.User.ID == 3 && s.Action == ActionMute && s.Until.After(time.Now().Add(29*time.Minute))
+	})).Once()
+	rec.On("Record", mock.MatchedBy(func(s Sanction) bool {
+		return s.User.ID == 3 && s.Action == ActionUnmute && s.Until.IsZero()
+	})).Once()
+
+	su.On("IsSuper", "admin").Return(true)
+	su.On("IsSuper", "").Return(false)
+	su.On("IsSuper", "admin2").Return(true)
+
+	tg.On("KickChatMember", mock.MatchedBy(func(u tbapi.KickChatMemberConfig) bool {
+		until := time.Now().Add(2 * time.Hour).Unix()
+		return u.UserID == 2 && u.ChatID == 123 && u.UntilDate > until-5 && u.UntilDate <= until
+	})).Return(tbapi.APIResponse{}, nil).Once()
+
+	tg.On("RestrictChatMember", mock.MatchedBy(func(u tbapi.RestrictChatMemberConfig) bool {
+		until := time.Now().Add(30 * time.Minute).Unix()
+		return u.UserID == 3 && u.ChatID == 123 && u.UntilDate > until-5 && u.UntilDate <= until &&
+			!*u.CanSendMessages && !*u.CanSendMediaMessages
+	})).Return(tbapi.APIResponse{}, nil).Once()
+
+	tg.On("RestrictChatMember", mock.MatchedBy(func(u tbapi.RestrictChatMemberConfig) bool {
+		return u.UserID == 3 && u.ChatID == 123 && u.UntilDate == 0 && *u.CanSendMessages
+	})).Return(tbapi.APIResponse{}, nil).Once()
+
+	noName := User{ID: 2, DisplayName: "No Name"}
+	b.OnMessage(Message{Text: "hi", From: noName})
+
+	resp := b.OnMessage(Message{Text: "ban! 2h флуд", From: User{Username: "admin"}, ChatID: 123,
+		ReplyTo: &Message{Text: "hi", From: noName}})
+	assert.Equal(t, Response{Text: "прощай [No Name](tg://user?id=2) на 2ч, причина: флуд (@admin)", Send: true}, resp)
+
+	resp = b.OnMessage(Message{Text: "mute! 3 30m", From: User{Username: "admin"}, ChatID: 123})
+	assert.Equal(t, Response{Text: "помолчи [3](tg://user?id=3) на 30мин (@admin)", Send: true}, resp)
+
+	resp = b.OnMessage(Message{Text: "unmute! 3", From: User{Username: "admin"}, ChatID: 123})
+	assert.Equal(t, Response{Text: "снова в эфире [3](tg://user?id=3) (@admin)", Send: true}, resp)
+
+	resp = b.OnMessage(Message{Text: "ban!", From: User{Username: "admin"}, ChatID: 123,
+		ReplyTo: &Message{Text: "hi", From: User{ID: 5, Username: "admin2"}}})
+	assert.Equal(t, Response{}, resp, "super can't be banned")
+
+	resp = b.OnMessage(Message{Text: "ban!", From: User{Username: "admin"}, ChatID: 123})
+	assert.Equal(t, Response{}, resp, "no target")
 
 	su.AssertExpectations(t)
 	tg.AssertExpectations(t)
+	rec.AssertExpectations(t)
+}
+
+func TestBanhammer_OnMessageLearnSpam(t *testing.T) {
+	su := &mocks.SuperUser{}
+	tg := &mocks.TgBanClient{}
+	sc := &mocks.SpamClassifier{}
+	b := NewBanhammer(tg, su, 10, nil, sc)
+
+	su.On("IsSuper", "admin").Return(true)
+	su.On("IsSuper", "spammer").Return(false)
+	tg.On("KickChatMember", mock.Anything).Return(tbapi.APIResponse{}, nil)
+	sc.On("LearnSpam", "заработок без вложений", "admin").Return(nil).Once()
+
+	resp := b.OnMessage(Message{Text: "заработок без вложений", From: User{Username: "spammer", ID: 1}})
+	assert.Equal(t, Response{}, resp)
+
+	resp = b.OnMessage(Message{Text: "ban! spammer", From: User{Username: "admin"}, ChatID: 123})
+	assert.Equal(t, Response{Text: "прощай spammer (@admin)", Send: true}, resp)
+
+	sc.AssertExpectations(t)
+	tg.AssertExpectations(t)
 }
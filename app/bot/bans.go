@@ -0,0 +1,276 @@
+package bot
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/radio-t/super-bot/app/storage"
+)
+
+//go:generate mockery -inpkg -name SanctionRecorder -case snake
+
+// Bans bot is a moderation registry. It records bans, mutes and kicks made by super-users, bots and
+// automatic filters, answers "bans!" queries and marks timed sanctions as expired when the time is up.
+// Records appended to StoreFile, one json per line
+type Bans struct {
+	BansParams
+	store    *storage.JSONLines
+	now      func() time.Time
+	location *time.Location
+
+	lock      sync.Mutex
+	records   []Sanction
+	checkedAt time.Time
+}
+
+// BansParams defines parameters for Bans bot
+type BansParams struct {
+	SuperUser  SuperUser // only super users can query
+	StoreFile  string    // jsonl file with all records
+	ExportPath string    // directory to export records to, shouldn't be public as records have user IDs and reasons
+}
+
+// Sanction is a moderation action record
+type Sanction struct {
+	Time   time.Time
+	ChatID int64
+	User   User
+	Action string    // ban, mute, kick, unban, unmute, expire or warn
+	Issuer string    // @username of super-user or mechanism, i.e. antispam
+	Reason string    `json:",omitempty"`
+	Until  time.Time // zero, "0001-01-01T00:00:00Z" in json, for permanent or lifting actions
+}
+
+// SanctionRecorder records moderation actions
+type SanctionRecorder interface {
+	Record(s Sanction)
+}
+
+// sanction actions
+const (
+	ActionBan    = "ban"
+	ActionMute   = "mute"
+	ActionKick   = "kick"
+	ActionUnban  = "unban"
+	ActionUnmute = "unmute"
+	ActionExpire = "expire"
+	ActionWarn   = "warn"
+)
+
+var actionNames = map[string]string{ActionBan: "бан", ActionMute: "мьют", ActionKick: "кик", ActionUnban: "разбан",
+	ActionUnmute: "снят мьют", ActionExpire: "истек срок", ActionWarn: "предупреждение"}
+
+// NewBans makes Bans bot and loads stored records
+func NewBans(params BansParams) (*Bans, error) {
+	log.Printf("[INFO] bans bot with %s", params.StoreFile)
+	store, err := storage.NewJSONLines(params.StoreFile)
+	if err != nil {
+		return nil, err
+	}
+	location, err := time.LoadLocation("Europe/Moscow")
+	if err != nil {
+		return nil, errors.Wrap(err, "can't load location")
+	}
+	b := &Bans{BansParams: params, store: store, now: time.Now, location: location}
+	err = store.Each(func(line []byte) error {
+		s := Sanction{}
+		if e := json.Unmarshal(line, &s); e != nil {
+			log.Printf("[WARN] skip bad sanction record, %v", e)
+			return nil
+		}
+		b.records = append(b.records, s)
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "can't load sanctions")
+	}
+	return b, nil
+}
+
+// Help returns help message
+func (b *Bans) Help() string {
+	return genHelpMsg(b.ReactOn(), "действующие баны, bans! @user - история пользователя, bans! export - "+
+		"выгрузка в jsonl (только для админов)")
+}
+
+// ReactOn keys
+func (b *Bans) ReactOn() []string {
+	return []string{"bans!", "баны!"}
+}
+
+// Record adds moderation action to the registry, implements SanctionRecorder
+func (b *Bans) Record(s Sanction) {
+	if s.Time.IsZero() {
+		s.Time = b.now()
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.add(s)
+}
+
+// OnMessage expires sanctions and answers queries
+func (b *Bans) OnMessage(msg Message) (response Response) {
+	b.expire()
+
+	text := strings.TrimSpace(msg.Text)
+	cmd := strings.ToLower(strings.SplitN(text, " ", 2)[0])
+	if !contains(b.ReactOn(), cmd) || !b.SuperUser.IsSuper(msg.From.Username) {
+		return Response{}
+	}
+	args := strings.TrimSpace(text[len(cmd):])
+
+	switch {
+	case msg.ReplyTo != nil:
+		return Response{Text: b.history(func(u User) bool { return u.ID == msg.ReplyTo.From.ID }), Send: true}
+	case contains([]string{"export", "экспорт"}, args):
+		return Response{Text: b.export(), Send: true}
+	case args != "":
+		return Response{Text: b.history(matchUser(args)), Send: true}
+	}
+	return Response{Text: b.active(), Send: true}
+}
+
+// expire records expiration of timed sanctions, checks once a minute
+func (b *Bans) expire() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	now := b.now()
+	if now.Sub(b.checkedAt) < time.Minute {
+		return
+	}
+	b.checkedAt = now
+
+	for _, s := range b.current() {
+		if !s.Until.IsZero() && s.Until.Before(now) {
+			log.Printf("[INFO] %s of %v expired", s.Action, s.User)
+			b.add(Sanction{Time: now, ChatID: s.ChatID, User: s.User, Action: ActionExpire, Issuer: "auto",
+				Reason: actionNames[s.Action] + " до " + s.Until.In(b.location).Format("02.01.06 15:04")})
+		}
+	}
+}
+
+// current returns in-effect sanctions, the last one for each user. Should be called under lock
+func (b *Bans) current() []Sanction {
+	last := map[int]int{} // user ID to the last record position
+	var order []int
+	for i, s := range b.records {
+		if s.Action == ActionWarn {
+			continue // warnings don't change restrictions
+		}
+		if _, ok := last[s.User.ID]; !ok {
+			order = append(order, s.User.ID)
+		}
+		last[s.User.ID] = i
+	}
+
+	var res []Sanction
+	for _, id := range order {
+		s := b.records[last[id]]
+		if s.Action == ActionBan || s.Action == ActionMute {
+			res = append(res, s)
+		}
+	}
+	return res
+}
+
+func (b *Bans) active() string {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	cur := b.current()
+	if len(cur) == 0 {
+		return "действующих банов нет"
+	}
+	lines := make([]string, 0, len(cur))
+	for _, s := range cur {
+		lines = append(lines, fmt.Sprintf("%s - %s", mention(s.User), b.describe(s)))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (b *Bans) history(match func(u User) bool) string {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	var lines []string
+	for _, s := range b.records {
+		if match(s.User) {
+			lines = append(lines, fmt.Sprintf("%s %s", s.Time.In(b.location).Format("02.01.06 15:04"), b.describe(s)))
+		}
+	}
+	if len(lines) == 0 {
+		return "ничего не найдено"
+	}
+	return strings.Join(lines, "\n")
+}
+
+// describe returns human-readable sanction without the user
+func (b *Bans) describe(s Sanction) string {
+	res := actionNames[s.Action]
+	if res == "" {
+		res = s.Action
+	}
+	if !s.Until.IsZero() {
+		res += " до " + s.Until.In(b.location).Format("02.01.06 15:04")
+	}
+	res += ", " + EscapeMarkDown(s.Issuer)
+	if s.Reason != "" {
+		res += ": " + EscapeMarkDown(shorten(s.Reason, 100))
+	}
+	return res
+}
+
+// export writes all records to ExportPath
+func (b *Bans) export() string {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	sb := strings.Builder{}
+	for _, s := range b.records {
+		data, err := json.Marshal(s)
+		if err != nil {
+			continue
+		}
+		_, _ = sb.Write(append(data, '\n'))
+	}
+
+	fname := filepath.Join(b.ExportPath, "bans-"+b.now().Format("20060102")+".jsonl")
+	if err := os.MkdirAll(b.ExportPath, 0750); err != nil {
+		log.Printf("[WARN] can't make %s, %v", b.ExportPath, err)
+		return "не получилось выгрузить"
+	}
+	if err := ioutil.WriteFile(fname, []byte(sb.String()), 0600); err != nil {
+		log.Printf("[WARN] can't write %s, %v", fname, err)
+		return "не получилось выгрузить"
+	}
+	log.Printf("[INFO] %d sanctions exported to %s", len(b.records), fname)
+	return fmt.Sprintf("выгружено %d записей в %s", len(b.records), EscapeMarkDown(filepath.Base(fname)))
+}
+
+// add appends the record to memory and store, should be called under lock
+func (b *Bans) add(s Sanction) {
+	b.records = append(b.records, s)
+	if err := b.store.Append(s); err != nil {
+		log.Printf("[WARN] can't save sanction, %v", err)
+	}
+}
+
+// matchUser makes user matcher by @username or numeric ID
+func matchUser(target string) func(u User) bool {
+	if id, err := strconv.Atoi(target); err == nil {
+		return func(u User) bool { return u.ID == id }
+	}
+	name := strings.TrimPrefix(target, "@")
+	return func(u User) bool { return u.Username != "" && strings.EqualFold(u.Username, name) }
+}
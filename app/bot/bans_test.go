@@ -0,0 +1,76 @@
+package bot
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/radio-t/super-bot/app/bot/mocks"
+)
+
+func TestBans_OnMessage(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "bans")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	su := &mocks.SuperUser{}
+	su.On("IsSuper", "admin").Return(true)
+	su.On("IsSuper", "user").Return(false)
+
+	params := BansParams{SuperUser: su, StoreFile: path.Join(tmp, "bans.jsonl"), ExportPath: path.Join(tmp, "export")}
+	b, err := NewBans(params)
+	require.NoError(t, err)
+	now := time.Date(2021, 3, 6, 18, 0, 0, 0, time.UTC)
+	b.now = func() time.Time { return now }
+
+	admin := User{Username: "admin"}
+	spammer, flooder, noName := User{ID: 1, Username: "spammer"}, User{ID: 2, Username: "flood_er"}, User{ID: 3, DisplayName: "No Name"}
+
+	assert.Equal(t, Response{Text: "действующих банов нет", Send: true}, b.OnMessage(Message{Text: "bans!", From: admin}))
+
+	b.Record(Sanction{User: spammer, Action: ActionBan, Issuer: "antispam", Reason: "spam phrase: заработок"})
+	b.Record(Sanction{User: flooder, Action: ActionMute, Issuer: "terminator", Reason: "all activity",
+		Until: now.Add(5 * time.Minute)})
+	b.Record(Sanction{User: noName, Action: ActionMute, Issuer: "@admin", Until: now.Add(time.Hour)})
+	b.Record(Sanction{User: noName, Action: ActionUnmute, Issuer: "@admin"})
+	b.Record(Sanction{User: noName, Action: ActionWarn, Issuer: "@admin"})
+
+	assert.Equal(t, Response{}, b.OnMessage(Message{Text: "bans!", From: User{Username: "user"}}), "not super")
+
+	assert.Equal(t, Response{Text: "[@spammer](tg://user?id=1) - бан, antispam: spam phrase: заработок\n" +
+		"[@flood_er](tg://user?id=2) - мьют до 06.03.21 21:05, terminator: all activity", Send: true},
+		b.OnMessage(Message{Text: "bans!", From: admin}))
+
+	assert.Equal(t, Response{Text: "06.03.21 21:00 мьют до 06.03.21 22:00, @admin\n06.03.21 21:00 снят мьют, @admin\n" +
+		"06.03.21 21:00 предупреждение, @admin",
+		Send: true}, b.OnMessage(Message{Text: "bans! 3", From: admin}))
+	assert.Equal(t, Response{Text: "06.03.21 21:00 бан, antispam: spam phrase: заработок", Send: true},
+		b.OnMessage(Message{Text: "баны!", From: admin, ReplyTo: &Message{From: spammer}}))
+	assert.Equal(t, Response{Text: "ничего не найдено", Send: true}, b.OnMessage(Message{Text: "bans! @nobody", From: admin}))
+
+	// flooder's mute expired
+	now = now.Add(10 * time.Minute)
+	b.OnMessage(Message{Text: "idle"})
+	assert.Equal(t, Response{Text: "[@spammer](tg://user?id=1) - бан, antispam: spam phrase: заработок", Send: true},
+		b.OnMessage(Message{Text: "bans!", From: admin}))
+	assert.Equal(t, Response{Text: "06.03.21 21:00 мьют до 06.03.21 21:05, terminator: all activity\n" +
+		"06.03.21 21:10 истек срок, auto: мьют до 06.03.21 21:05", Send: true},
+		b.OnMessage(Message{Text: "bans! @FLOOD_ER", From: admin}))
+
+	resp := b.OnMessage(Message{Text: "bans! export", From: admin})
+	assert.Equal(t, Response{Text: "выгружено 6 записей в bans-20210306.jsonl", Send: true}, resp)
+	data, err := ioutil.ReadFile(path.Join(tmp, "export", "bans-20210306.jsonl"))
+	require.NoError(t, err)
+	assert.Equal(t, 6, strings.Count(string(data), "\n"))
+
+	// reload from store
+	b2, err := NewBans(params)
+	require.NoError(t, err)
+	assert.Equal(t, b.records, b2.records)
+}
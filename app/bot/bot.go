@@ -12,11 +12,15 @@ import (
 
 	"github.com/go-pkgz/syncs"
 	"github.com/pkg/errors"
+
+	"github.com/radio-t/super-bot/app/confusable"
 )
 
 //go:generate mockery -name HTTPClient -case snake
 //go:generate mockery -inpkg -name Interface -case snake
 //go:generate mockery -name SuperUser -case snake
+//go:generate mockery -inpkg -name Submitter -case snake
+//go:generate mockery -inpkg -name CallbackHandler -case snake
 
 // genHelpMsg construct help message from bot's ReactOn
 func genHelpMsg(com []string, msg string) string {
@@ -38,6 +42,29 @@ type Response struct {
 	Unpin       bool          // enable unpin
 	Preview     bool          // enable web preview
 	BanInterval time.Duration // bots banning user set the interval
+	BanTarget   *User         // user to ban or kick, the message author if not set
+	Kick        bool          // remove the user from the chat
+	Buttons     []Button      // inline buttons under the message
+}
+
+// Button is an inline button, pressing it makes Callback with the button's data
+type Button struct {
+	Text string
+	Data string // callback data, prefixed by handler's key, i.e. "search:123:1"
+}
+
+// Callback is a press of inline button on the bot's message
+type Callback struct {
+	Data   string
+	From   User
+	ChatID int64
+	MsgID  int // the message with the button
+}
+
+// CallbackHandler reacts on inline buttons. Response with Send replaces the message with the button,
+// answer is a short notification shown to the user pressed the button
+type CallbackHandler interface {
+	OnCallback(cb Callback) (resp Response, answer string)
 }
 
 // HTTPClient wrap http.Client to allow mocking
@@ -50,6 +77,12 @@ type SuperUser interface {
 	IsSuper(userName string) bool
 }
 
+// Submitter pushes responses to the chat asynchronously, outside of OnMessage flow.
+// Zero chatID means the primary group
+type Submitter interface {
+	SubmitTo(ctx context.Context, chatID int64, resp Response) error
+}
+
 // Message is primary record to pass data from/to bots
 type Message struct {
 	ID       int
@@ -60,6 +93,16 @@ type Message struct {
 	Text     string    `json:",omitempty"`
 	Entities *[]Entity `json:",omitempty"`
 	Image    *Image    `json:",omitempty"`
+	Forward  *Forward  `json:",omitempty"`
+	ReplyTo  *Message  `json:",omitempty"`
+}
+
+// Forward describes origin of the forwarded message
+type Forward struct {
+	ChatID  int64  `json:",omitempty"` // channel or group the message forwarded from
+	Title   string `json:",omitempty"`
+	Channel bool   `json:",omitempty"`
+	User    *User  `json:",omitempty"` // original author, for messages forwarded from users
 }
 
 // Entity represents one special entity in a text message.
@@ -87,15 +130,39 @@ type User struct {
 	ID          int
 	Username    string
 	DisplayName string
+	IsBot       bool `json:",omitempty"`
 }
 
 // MultiBot combines many bots to one virtual
-type MultiBot []Interface
+type MultiBot struct {
+	bots   []Interface
+	routes routeTable
+}
+
+// routeTable is a lookup of ReactOn keys by their skeletons
+type routeTable struct {
+	keys      map[string]bool   // lower case keys
+	skeletons map[string]string // skeleton to the first key with it
+}
+
+// NewMultiBot makes MultiBot of bots. ReactOn keys don't change, lookup of the keys
+// by skeletons for commands written with lookalike characters made here, once
+func NewMultiBot(bots ...Interface) *MultiBot {
+	res := &MultiBot{bots: bots, routes: routeTable{keys: map[string]bool{}, skeletons: map[string]string{}}}
+	for _, key := range res.ReactOn() {
+		res.routes.keys[strings.ToLower(key)] = true
+		sk := confusable.Skeleton(key)
+		if _, ok := res.routes.skeletons[sk]; !ok {
+			res.routes.skeletons[sk] = key
+		}
+	}
+	return res
+}
 
 // Help returns help message
-func (b MultiBot) Help() string {
+func (b *MultiBot) Help() string {
 	sb := strings.Builder{}
-	for _, child := range b {
+	for _, child := range b.bots {
 		help := child.Help()
 		if help != "" {
 			// WriteString always returns nil err
@@ -110,21 +177,23 @@ func (b MultiBot) Help() string {
 
 // OnMessage pass msg to all bots and collects reposnses (combining all of them)
 //noinspection GoShadowedVar
-func (b MultiBot) OnMessage(msg Message) (response Response) {
+func (b *MultiBot) OnMessage(msg Message) (response Response) {
 	if contains([]string{"help", "/help", "help!"}, msg.Text) {
 		return Response{
 			Text: b.Help(),
 			Send: true,
 		}
 	}
+	msg = b.route(msg)
 
 	resps := make(chan string)
 	var pin, unpin int32
-	var banInterval time.Duration
+	var ban Response // the strongest sanction, target, kick and interval taken from the same response
+	var buttons []Button
 	var mutex = &sync.Mutex{}
 
 	wg := syncs.NewSizedGroup(4)
-	for _, bot := range b {
+	for _, bot := range b.bots {
 		bot := bot
 		wg.Go(func(ctx context.Context) {
 			if resp := bot.OnMessage(msg); resp.Send {
@@ -135,13 +204,18 @@ func (b MultiBot) OnMessage(msg Message) (response Response) {
 				if resp.Unpin {
 					atomic.AddInt32(&unpin, 1)
 				}
-				if resp.BanInterval > 0 {
+				if resp.BanInterval > 0 || resp.Kick {
 					mutex.Lock()
-					if resp.BanInterval > banInterval {
-						banInterval = resp.BanInterval
+					if strongerBan(resp, ban) {
+						ban = resp
 					}
 					mutex.Unlock()
 				}
+				if len(resp.Buttons) > 0 {
+					mutex.Lock()
+					buttons = resp.Buttons
+					mutex.Unlock()
+				}
 			}
 		})
 	}
@@ -162,23 +236,88 @@ func (b MultiBot) OnMessage(msg Message) (response Response) {
 	})
 
 	log.Printf("[DEBUG] answers %d, send %v", len(lines), len(lines) > 0)
+	if len(lines) > 1 {
+		buttons = nil // buttons belong to the answer of a single bot
+	}
 	return Response{
 		Text:        strings.Join(lines, "\n"),
 		Send:        len(lines) > 0,
 		Pin:         atomic.LoadInt32(&pin) > 0,
 		Unpin:       atomic.LoadInt32(&unpin) > 0,
-		BanInterval: banInterval,
+		BanInterval: ban.BanInterval,
+		BanTarget:   ban.BanTarget,
+		Kick:        ban.Kick,
+		Buttons:     buttons,
 	}
 }
 
+// route replaces command written with lookalike characters, i.e. "aнeкдoт!" with Latin letters,
+// by the command of a bot, the rest of the message kept as is
+func (b *MultiBot) route(msg Message) Message {
+	fields := strings.Fields(msg.Text)
+	if len(fields) == 0 {
+		return msg
+	}
+	cmd := fields[0]
+	skeleton := confusable.Skeleton(cmd)
+	if skeleton == strings.ToLower(cmd) || b.routes.keys[strings.ToLower(cmd)] {
+		return msg
+	}
+	if routed, ok := b.routes.skeletons[skeleton]; ok {
+		log.Printf("[DEBUG] command %q routed to %q", cmd, routed)
+		msg.Text = strings.Replace(msg.Text, cmd, routed, 1)
+	}
+	return msg
+}
+
 // ReactOn returns combined list of all keywords
-func (b MultiBot) ReactOn() (res []string) {
-	for _, bot := range b {
+func (b *MultiBot) ReactOn() (res []string) {
+	for _, bot := range b.bots {
 		res = append(res, bot.ReactOn()...)
 	}
 	return res
 }
 
+// entityLinks returns urls from "url" and "text_link" entities of the message
+func entityLinks(msg Message) (res []string) {
+	if msg.Entities == nil {
+		return nil
+	}
+	runes := []rune(msg.Text)
+	for _, e := range *msg.Entities {
+		switch {
+		case e.Type == "text_link" && e.URL != "":
+			res = append(res, e.URL)
+		case e.Type == "url" && e.Offset >= 0 && e.Offset+e.Length <= len(runes):
+			res = append(res, string(runes[e.Offset:e.Offset+e.Length]))
+		}
+	}
+	return res
+}
+
+// shorten cuts text to max runes, adds ellipsis if cut
+func shorten(text string, max int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	runes := []rune(text)
+	if len(runes) <= max {
+		return text
+	}
+	return strings.TrimSpace(string(runes[:max])) + "…"
+}
+
+// strongerBan checks if sanction of response a is stronger than b, kick is the strongest
+func strongerBan(a, b Response) bool {
+	if a.Kick != b.Kick {
+		return a.Kick
+	}
+	return a.BanInterval > b.BanInterval
+}
+
+// EscapeMarkDown escapes telegram markdown (v1) control characters, works outside of entities only
+func EscapeMarkDown(text string) string {
+	return strings.NewReplacer("_", "\\_", "*", "\\*", "`", "\\`", "[", "\\[").Replace(text)
+}
+
 func contains(s []string, e string) bool {
 	e = strings.TrimSpace(e)
 	for _, a := range s {
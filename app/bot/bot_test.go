@@ -3,6 +3,7 @@ package bot
 import (
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -13,13 +14,15 @@ func TestGenHelpMsg(t *testing.T) {
 
 func TestMultiBotHelp(t *testing.T) {
 	b1 := &MockInterface{}
+	b1.On("ReactOn").Return([]string{"b1"})
 	b1.On("Help").Return("b1 help")
 	b2 := &MockInterface{}
+	b2.On("ReactOn").Return([]string{"b2"})
 	b2.On("Help").Return("b2 help")
 
 	// Must return concatenated b1 and b2 without space
 	// Line formatting only in genHelpMsg()
-	require.Equal(t, "b1 help\nb2 help\n", MultiBot{b1, b2}.Help())
+	require.Equal(t, "b1 help\nb2 help\n", NewMultiBot(b1, b2).Help())
 }
 
 func TestMultiBotReactsOnHelp(t *testing.T) {
@@ -27,7 +30,7 @@ func TestMultiBotReactsOnHelp(t *testing.T) {
 	b.On("ReactOn").Return([]string{"help"})
 	b.On("Help").Return("help")
 
-	mb := MultiBot{b}
+	mb := NewMultiBot(b)
 	resp := mb.OnMessage(Message{Text: "help"})
 
 	require.True(t, resp.Send)
@@ -50,7 +53,7 @@ func TestMultiBotCombinesAllBotResponses(t *testing.T) {
 		Send: true,
 	})
 
-	mb := MultiBot{b1, b2}
+	mb := NewMultiBot(b1, b2)
 	resp := mb.OnMessage(msg)
 
 	require.True(t, resp.Send)
@@ -59,3 +62,61 @@ func TestMultiBotCombinesAllBotResponses(t *testing.T) {
 	require.Contains(t, parts, "b1 resp")
 	require.Contains(t, parts, "b2 resp")
 }
+
+func TestMultiBotCombinesBans(t *testing.T) {
+	msg := Message{Text: "warn! @user"}
+	target, other := User{ID: 1, Username: "user"}, User{ID: 2, Username: "other"}
+
+	b1 := &MockInterface{}
+	b1.On("ReactOn").Return([]string{"warn!"})
+	b1.On("OnMessage", msg).Return(Response{Text: "b1 resp", Send: true, BanTarget: &target, Kick: true})
+	b2 := &MockInterface{}
+	b2.On("ReactOn").Return([]string{})
+	b2.On("OnMessage", msg).Return(Response{Text: "b2 resp", Send: true, BanTarget: &other, BanInterval: time.Hour})
+
+	resp := NewMultiBot(b1, b2).OnMessage(msg)
+	require.True(t, resp.Kick)
+	require.Equal(t, &target, resp.BanTarget)
+	require.Equal(t, time.Duration(0), resp.BanInterval, "interval not mixed from another response")
+
+	b3 := &MockInterface{}
+	b3.On("ReactOn").Return([]string{})
+	b3.On("OnMessage", msg).Return(Response{Text: "b3 resp", Send: true, BanInterval: time.Minute})
+
+	resp = NewMultiBot(b3, b2).OnMessage(msg)
+	require.False(t, resp.Kick)
+	require.Equal(t, &other, resp.BanTarget)
+	require.Equal(t, time.Hour, resp.BanInterval)
+}
+
+func TestMultiBotKeepsButtonsOfSingleResponse(t *testing.T) {
+	msg := Message{Text: "search! go"}
+	buttons := []Button{{Text: "▶", Data: "search:1:1"}}
+
+	b1 := &MockInterface{}
+	b1.On("ReactOn").Return([]string{"search!"})
+	b1.On("OnMessage", msg).Return(Response{Text: "b1 resp", Send: true, Buttons: buttons})
+	b2 := &MockInterface{}
+	b2.On("ReactOn").Return([]string{})
+	b2.On("OnMessage", msg).Return(Response{})
+	require.Equal(t, buttons, NewMultiBot(b1, b2).OnMessage(msg).Buttons)
+
+	b3 := &MockInterface{}
+	b3.On("ReactOn").Return([]string{})
+	b3.On("OnMessage", msg).Return(Response{Text: "b3 resp", Send: true})
+	require.Nil(t, NewMultiBot(b1, b3).OnMessage(msg).Buttons, "buttons dropped from combined responses")
+}
+
+func TestMultiBotRoutesLookalikeCommands(t *testing.T) {
+	b := &MockInterface{}
+	b.On("ReactOn").Return([]string{"анекдот!", "log!"})
+	b.On("OnMessage", Message{Text: "анекдот!"}).Return(Response{Text: "joke", Send: true})
+	b.On("OnMessage", Message{Text: "log! докер"}).Return(Response{Text: "found", Send: true})
+
+	mb := NewMultiBot(b)
+	require.Equal(t, "joke", mb.OnMessage(Message{Text: "aнeкдoт!"}).Text, "latin a, e, o")
+	require.Equal(t, "joke", mb.OnMessage(Message{Text: "анекдот!"}).Text)
+	require.Equal(t, "found", mb.OnMessage(Message{Text: "Ⅼоg! докер"}).Text)
+	require.Equal(t, "found", mb.OnMessage(Message{Text: "l0g! докер"}).Text)
+	b.AssertNumberOfCalls(t, "ReactOn", 1) // lookup made once, by NewMultiBot
+}
@@ -2,10 +2,16 @@ package bot
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
+
+	"github.com/radio-t/super-bot/app/storage"
 )
 
 const (
@@ -19,36 +25,129 @@ const (
 // BroadcastParams defines parameters for broadcast detection
 type BroadcastParams struct {
 	URL          string        // URL for "ping"
+	StatusURL    string        // optional, icecast or shoutcast status json with listeners count
+	StoreFile    string        // optional, json file to keep broadcast records
+	SuperUser    SuperUser     // optional, super-users get dropout alerts and timeline
+	Submitter    Submitter     // optional, sends dropout alerts to super-users
 	PingInterval time.Duration // Ping interval
 	DelayToOff   time.Duration // State will be switched to off in no ok replies from URL in this intrval
+	DropoutPings int           // failed pings in a row to alert about dropout, 3 by default
 	Client       http.Client   // http client
 }
 
 // BroadcastStatus bot replies with current broadcast status
 type BroadcastStatus struct {
-	status         bool // current broadcast status
-	lastSentStatus bool // last status sent with OnMessage
+	status         bool         // current broadcast status
+	lastSentStatus bool         // last status sent with OnMessage
+	startedAt      time.Time    // time of the last off->on switch
+	stream         StreamStatus // the last stream status, if StatusURL defined
+	dropoutAt      time.Time    // the stream is down since, while the broadcast is still on
+	failedPings    int          // failed pings in a row since dropoutAt
+	dropoutAlerted bool         // super-users alerted about the current dropout
+	location       *time.Location
+	superUser      SuperUser
 	statusMx       sync.Mutex
+
+	store *storage.JSONFile
+	state broadcastState
+}
+
+// broadcastState is persisted state of BroadcastStatus
+type broadcastState struct {
+	Records  []BroadcastRecord `json:"records"`             // the last one is the current or most recent broadcast
+	NextShow int               `json:"next_show,omitempty"` // show number from the last prep post
+	Supers   map[string]int    `json:"supers,omitempty"`    // user IDs of super-users for alerts
+}
+
+// BroadcastRecord keeps a broadcast session and its stats
+type BroadcastRecord struct {
+	Started       time.Time      `json:"started"`
+	Ended         time.Time      `json:"ended,omitempty"` // zero for the current broadcast
+	Show          int            `json:"show,omitempty"`  // podcast number, if known
+	PeakListeners int            `json:"peak_listeners,omitempty"`
+	AvgListeners  float64        `json:"avg_listeners,omitempty"`
+	Samples       int            `json:"samples,omitempty"` // number of listeners counts in the average
+	Dropouts      []Dropout      `json:"dropouts,omitempty"`
+	Timeline      []StreamSample `json:"timeline,omitempty"`
+}
+
+// Duration of the broadcast, till now for the current one
+func (r BroadcastRecord) Duration() time.Duration {
+	if r.Ended.IsZero() {
+		return time.Since(r.Started)
+	}
+	return r.Ended.Sub(r.Started)
+}
+
+const (
+	maxBroadcastRecords = 100           // how many broadcasts kept in the store
+	resumeBroadcast     = 6 * time.Hour // unfinished broadcast started within this interval continued after restart
+)
+
+var rePrepShow = regexp.MustCompile(`prep-(\d+)/?$`)
+
+// LoadBroadcastRecords reads broadcast records saved by BroadcastStatus, the oldest first
+func LoadBroadcastRecords(storeFile string) ([]BroadcastRecord, error) {
+	store, err := storage.NewJSONFile(storeFile)
+	if err != nil {
+		return nil, err
+	}
+	state := broadcastState{}
+	if err = store.Load(&state); err != nil {
+		return nil, err
+	}
+	return state.Records, nil
 }
 
 // NewBroadcastStatus starts status checking goroutine and returns bot instance
 func NewBroadcastStatus(ctx context.Context, params BroadcastParams) *BroadcastStatus {
-	log.Printf("[INFO] BroadcastStatus bot with %v", params.URL)
-	b := &BroadcastStatus{}
+	log.Printf("[INFO] BroadcastStatus bot with %v, status %q, store %q", params.URL, params.StatusURL, params.StoreFile)
+	b := &BroadcastStatus{superUser: params.SuperUser}
+	location, err := time.LoadLocation("Europe/Moscow")
+	if err != nil {
+		log.Printf("[WARN] can't load location, %v", err)
+		location = time.Local
+	}
+	b.location = location
+	if params.StoreFile != "" {
+		store, err := storage.NewJSONFile(params.StoreFile)
+		if err == nil {
+			err = store.Load(&b.state)
+		}
+		if err != nil {
+			log.Printf("[WARN] broadcast records won't be saved, %v", err)
+		} else {
+			b.store = store
+		}
+	}
 	go b.checker(ctx, params)
 	return b
 }
 
 // Help returns help message
 func (b *BroadcastStatus) Help() string {
-	return ""
+	return genHelpMsg([]string{"listeners!", "слушатели!"}, "сколько слушателей в эфире и максимум за эфир") +
+		genHelpMsg([]string{"эфир?", "broadcast!"}, "текущий или последний эфир, когда и сколько длился") +
+		genHelpMsg([]string{"timeline!"}, "обрывы и качество потока в эфире (только для ведущих)")
 }
 
-// OnMessage returns current broadcast status if it was changed
-func (b *BroadcastStatus) OnMessage(_ Message) (response Response) {
+// OnMessage returns current broadcast status if it was changed, reports listeners and broadcasts on request
+func (b *BroadcastStatus) OnMessage(msg Message) (response Response) {
 	b.statusMx.Lock()
 	defer b.statusMx.Unlock()
 
+	b.learnSuper(msg.From)
+	switch strings.ToLower(strings.TrimSpace(msg.Text)) {
+	case "listeners!", "слушатели!":
+		return Response{Text: b.listeners(), Send: true}
+	case "эфир?", "broadcast!":
+		return Response{Text: b.lastBroadcast(), Send: true}
+	case "timeline!":
+		if b.superUser != nil && b.superUser.IsSuper(msg.From.Username) {
+			return Response{Text: b.timeline(), Send: true}
+		}
+	}
+
 	response.Pin = false
 	if b.lastSentStatus != b.status {
 		response.Send = true
@@ -77,32 +176,180 @@ func (b *BroadcastStatus) checker(ctx context.Context, params BroadcastParams) {
 
 // check do ping to url and change current state
 func (b *BroadcastStatus) check(ctx context.Context, lastOn time.Time, params BroadcastParams) time.Time {
+	// network calls made without lock, Live is called by the listener on every update
+	newStatus := ping(ctx, params.Client, params.URL)
+	var stream *StreamStatus
+	if newStatus && params.StatusURL != "" {
+		if s, err := fetchStreamStatus(ctx, params.Client, params.StatusURL); err == nil {
+			stream = &s
+		} else {
+			log.Printf("[DEBUG] can't get stream status, %v", err)
+		}
+	}
+
 	b.statusMx.Lock()
 	defer b.statusMx.Unlock()
 
-	newStatus := ping(ctx, params.Client, params.URL)
-
 	// 0 -> 1
 	if !b.status && newStatus {
 		log.Print("[INFO] Broadcast started")
 		b.status = true
+		b.startedAt = time.Now()
+		b.resetDropout()
+		n := len(b.state.Records)
+		if n > 0 && b.state.Records[n-1].Ended.IsZero() && time.Since(b.state.Records[n-1].Started) < resumeBroadcast {
+			// restarted during the broadcast
+			b.startedAt = b.state.Records[n-1].Started
+			log.Printf("[INFO] resume broadcast started at %v", b.startedAt)
+		} else {
+			b.state.Records = append(b.state.Records, BroadcastRecord{Started: b.startedAt, Show: b.state.NextShow})
+			if len(b.state.Records) > maxBroadcastRecords {
+				b.state.Records = b.state.Records[len(b.state.Records)-maxBroadcastRecords:]
+			}
+		}
+		b.updateStream(stream)
+		b.save()
 		return time.Now()
 	}
 
 	// 1 -> 0
 	// 0 -> 0
 	if !newStatus {
-		if b.status && lastOn.Add(params.DelayToOff).Before(time.Now()) {
-			log.Print("[INFO] Broadcast finished")
-			b.status = false
+		if !b.status {
+			return lastOn
+		}
+		if lastOn.Add(params.DelayToOff).After(time.Now()) {
+			b.startDropout(ctx, params)
+			return lastOn
 		}
+		log.Print("[INFO] Broadcast finished")
+		b.status = false
+		b.stream = StreamStatus{}
+		b.resetDropout() // the last outage is the end of broadcast, not a dropout
+		if n := len(b.state.Records); n > 0 {
+			b.state.Records[n-1].Ended = time.Now()
+		}
+		b.save()
 		return lastOn
 	}
 
 	// 1 -> 1
+	b.updateStream(stream)
+	b.endDropout(ctx, params)
 	return time.Now()
 }
 
+// updateStream keeps fetched stream status and counts listeners of the current broadcast,
+// nil stream means no status available. Should be called under lock
+func (b *BroadcastStatus) updateStream(stream *StreamStatus) {
+	if stream == nil || len(b.state.Records) == 0 {
+		return
+	}
+	b.stream = *stream
+	b.addSample(StreamSample{Time: time.Now(), Listeners: stream.Listeners, Bitrate: stream.Bitrate})
+
+	rec := &b.state.Records[len(b.state.Records)-1]
+	rec.AvgListeners = (rec.AvgListeners*float64(rec.Samples) + float64(stream.Listeners)) / float64(rec.Samples+1)
+	rec.Samples++
+	if stream.Listeners > rec.PeakListeners {
+		rec.PeakListeners = stream.Listeners
+		b.save()
+		return
+	}
+	if rec.Samples%30 == 0 {
+		b.save()
+	}
+}
+
+// listeners reports listeners of the current or the last broadcast, should be called under lock
+func (b *BroadcastStatus) listeners() string {
+	if len(b.state.Records) == 0 {
+		return "эфиров еще не было"
+	}
+	rec := b.state.Records[len(b.state.Records)-1]
+	if !b.status {
+		return fmt.Sprintf("эфир не идет, в прошлом эфире слушателей было до %d, в среднем %.0f",
+			rec.PeakListeners, rec.AvgListeners)
+	}
+	if rec.Samples == 0 {
+		return "эфир идет, число слушателей неизвестно"
+	}
+	res := fmt.Sprintf("сейчас слушают %d, максимум за эфир %d", b.stream.Listeners, rec.PeakListeners)
+	if b.stream.Bitrate > 0 {
+		res += fmt.Sprintf(", %d kbps", b.stream.Bitrate)
+	}
+	if b.stream.Mount != "" {
+		res += ", " + EscapeMarkDown(b.stream.Mount)
+	}
+	if b.stream.Title != "" {
+		res += ", " + EscapeMarkDown(b.stream.Title)
+	}
+	return res
+}
+
+// lastBroadcast reports the current or the most recent broadcast, should be called under lock
+func (b *BroadcastStatus) lastBroadcast() string {
+	if len(b.state.Records) == 0 {
+		return "эфиров еще не было"
+	}
+	rec := b.state.Records[len(b.state.Records)-1]
+	show := ""
+	if rec.Show > 0 {
+		show = fmt.Sprintf(", выпуск %d", rec.Show)
+	}
+	started := b.localTime(rec.Started)
+
+	if b.status {
+		elapsed := "меньше минуты"
+		if d := rec.Duration().Truncate(time.Minute); d > 0 {
+			elapsed = HumanizeDuration(d)
+		}
+		return fmt.Sprintf("эфир идет с %s%s, уже %s", started.Format("15:04"), show, elapsed)
+	}
+	if rec.Ended.IsZero() {
+		return fmt.Sprintf("последний эфир начался %s%s, окончание неизвестно", started.Format("02.01.06 15:04"), show)
+	}
+	ended := b.localTime(rec.Ended)
+	res := fmt.Sprintf("последний эфир %s - %s%s, %s", started.Format("02.01.06 15:04"), ended.Format("15:04"), show,
+		HumanizeDuration(rec.Duration().Truncate(time.Minute)))
+	if rec.PeakListeners > 0 {
+		res += fmt.Sprintf(", слушателей до %d", rec.PeakListeners)
+	}
+	if len(rec.Dropouts) > 0 {
+		res += fmt.Sprintf(", обрывов %d (%s)", len(rec.Dropouts), humanizeSeconds(rec.DropoutsDuration()))
+	}
+	return res
+}
+
+// NewPrep gets the number of the next show from the prep post url, i.e. https://radio-t.com/p/2022/05/10/prep-800/
+func (b *BroadcastStatus) NewPrep(prepURL string) {
+	m := rePrepShow.FindStringSubmatch(prepURL)
+	if len(m) != 2 {
+		return
+	}
+	show, err := strconv.Atoi(m[1])
+	if err != nil {
+		return
+	}
+	b.statusMx.Lock()
+	defer b.statusMx.Unlock()
+	b.state.NextShow = show
+	if n := len(b.state.Records); n > 0 && b.status && b.state.Records[n-1].Show == 0 {
+		b.state.Records[n-1].Show = show
+	}
+	b.save()
+}
+
+// save writes broadcast records, should be called under lock
+func (b *BroadcastStatus) save() {
+	if b.store == nil {
+		return
+	}
+	if err := b.store.Save(b.state); err != nil {
+		log.Printf("[WARN] can't save broadcast records, %v", err)
+	}
+}
+
 // ping do get request to https://stream.radio-t.com and returns true on OK status and false for all other statuses
 func ping(ctx context.Context, client http.Client, url string) (status bool) {
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
@@ -124,6 +371,16 @@ func ping(ctx context.Context, client http.Client, url string) (status bool) {
 	return
 }
 
+// Live returns true and start time if broadcast is on
+func (b *BroadcastStatus) Live() (live bool, started time.Time) {
+	b.statusMx.Lock()
+	defer b.statusMx.Unlock()
+	if !b.status {
+		return false, time.Time{}
+	}
+	return true, b.startedAt
+}
+
 // nolint
 func (b *BroadcastStatus) getStatus() bool {
 	b.statusMx.Lock()
@@ -133,5 +390,5 @@ func (b *BroadcastStatus) getStatus() bool {
 
 // ReactOn keys
 func (b *BroadcastStatus) ReactOn() []string {
-	return []string{}
+	return []string{"listeners!", "слушатели!", "эфир?", "broadcast!", "timeline!"}
 }
@@ -2,14 +2,21 @@ package bot
 
 import (
 	"context"
+	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strconv"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/radio-t/super-bot/app/storage"
 )
 
 func TestBroadcast_OnMessage(t *testing.T) {
@@ -102,12 +109,18 @@ func TestBroadcast_StatusOffToOn(t *testing.T) {
 	defer ts.Close()
 
 	b := &BroadcastStatus{}
+	live, _ := b.Live()
+	require.False(t, live)
+
 	b.check(ctx, time.Time{}, BroadcastParams{
 		URL:    ts.URL,
 		Client: http.Client{},
 	})
 
 	require.True(t, b.status)
+	live, started := b.Live()
+	require.True(t, live)
+	require.WithinDuration(t, time.Now(), started, time.Second)
 }
 
 func TestBroadcast_StatusOffToOff(t *testing.T) {
@@ -231,6 +244,196 @@ func TestBroadcast_PingReturnsFalseOnUnableToCreateReq(t *testing.T) {
 	require.False(t, ping(nil, http.Client{}, "http://localhost:9873"))
 }
 
-func TestBroadcast_ReactOnAnyMessage(t *testing.T) {
-	require.Empty(t, (&BroadcastStatus{}).ReactOn())
+func TestBroadcast_ReactOn(t *testing.T) {
+	require.Equal(t, []string{"listeners!", "слушатели!", "эфир?", "broadcast!", "timeline!"},
+		(&BroadcastStatus{}).ReactOn())
+}
+
+func TestBroadcast_Listeners(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	listeners := 10
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/status-json.xsl" {
+			fmt.Fprintf(w, `{"icestats":{"source":{"listeners":%d,"bitrate":128,`+
+				`"listenurl":"http://stream.radio-t.com:80/stream","title":"Радио-Т 800"}}}`, listeners)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	tmp, err := ioutil.TempDir("", "broadcast")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmp)
+	store, err := storage.NewJSONFile(filepath.Join(tmp, "broadcasts.json"))
+	require.NoError(t, err)
+
+	params := BroadcastParams{URL: ts.URL, StatusURL: ts.URL + "/status-json.xsl", DelayToOff: time.Second,
+		Client: http.Client{}}
+	b := &BroadcastStatus{store: store}
+	require.Equal(t, Response{Text: "эфиров еще не было", Send: true}, b.OnMessage(Message{Text: "listeners!"}))
+
+	lastOn := b.check(ctx, time.Time{}, params)
+	listeners = 30
+	lastOn = b.check(ctx, lastOn, params)
+	listeners = 20
+	b.check(ctx, lastOn, params)
+
+	require.Equal(t, Response{Text: "сейчас слушают 20, максимум за эфир 30, 128 kbps, /stream, Радио-Т 800", Send: true},
+		b.OnMessage(Message{Text: "слушатели!"}))
+
+	b.status = false
+	require.Equal(t, Response{Text: "эфир не идет, в прошлом эфире слушателей было до 30, в среднем 20", Send: true},
+		b.OnMessage(Message{Text: "listeners!"}))
+
+	loaded := struct{ Records []BroadcastRecord }{}
+	require.NoError(t, store.Load(&loaded))
+	require.Equal(t, 1, len(loaded.Records))
+	assert.Equal(t, 30, loaded.Records[0].PeakListeners)
+}
+
+func TestBroadcast_LiveNotBlockedBySlowStatus(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fetching, release := make(chan struct{}), make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/status-json.xsl" {
+			close(fetching)
+			<-release
+			fmt.Fprint(w, `{"icestats":{"source":{"listeners":10}}}`)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	b := &BroadcastStatus{}
+	done := make(chan struct{})
+	go func() {
+		b.check(ctx, time.Time{}, BroadcastParams{URL: ts.URL, StatusURL: ts.URL + "/status-json.xsl",
+			DelayToOff: time.Second, Client: http.Client{}})
+		close(done)
+	}()
+
+	<-fetching
+	live := make(chan bool)
+	go func() {
+		l, _ := b.Live()
+		live <- l
+	}()
+	select {
+	case l := <-live:
+		assert.False(t, l, "not switched yet")
+	case <-time.After(time.Second):
+		t.Fatal("Live blocked by stream status fetch")
+	}
+
+	close(release)
+	<-done
+	l, _ := b.Live()
+	assert.True(t, l)
+	assert.Equal(t, 10, b.stream.Listeners)
+}
+
+func TestBroadcast_ListenersOffAir(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer ts.Close()
+
+	b := &BroadcastStatus{status: true, state: broadcastState{Records: []BroadcastRecord{{Started: time.Now().Add(-time.Hour), PeakListeners: 5, AvgListeners: 3, Samples: 2}}}}
+	b.check(ctx, time.Now().Add(-2*time.Second), BroadcastParams{URL: ts.URL, DelayToOff: time.Second,
+		Client: http.Client{}})
+
+	require.False(t, b.status)
+	assert.WithinDuration(t, time.Now(), b.state.Records[0].Ended, time.Second)
+	require.Equal(t, Response{Text: "эфир не идет, в прошлом эфире слушателей было до 5, в среднем 3", Send: true},
+		b.OnMessage(Message{Text: "listeners!"}))
+}
+
+func TestBroadcast_Records(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	on := true
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if on {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer ts.Close()
+
+	tmp, err := ioutil.TempDir("", "broadcast")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmp)
+	storeFile := filepath.Join(tmp, "broadcasts.json")
+	store, err := storage.NewJSONFile(storeFile)
+	require.NoError(t, err)
+
+	params := BroadcastParams{URL: ts.URL, DelayToOff: time.Second, Client: http.Client{}}
+	b := &BroadcastStatus{store: store}
+	require.Equal(t, Response{Text: "эфиров еще не было", Send: true}, b.OnMessage(Message{Text: "broadcast!"}))
+
+	b.NewPrep("https://radio-t.com/p/2022/05/10/prep-800/")
+	b.check(ctx, time.Time{}, params)
+	resp := b.OnMessage(Message{Text: "эфир?"})
+	require.Regexp(t, `^эфир идет с \d\d:\d\d, выпуск 800, уже меньше минуты$`, resp.Text)
+
+	on = false
+	b.check(ctx, time.Now().Add(-2*time.Second), params)
+	require.False(t, b.status)
+
+	records, err := LoadBroadcastRecords(storeFile)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(records))
+	assert.Equal(t, 800, records[0].Show)
+	assert.False(t, records[0].Ended.IsZero())
+	assert.True(t, records[0].Duration() < time.Second)
+
+	b.state.Records[0].Started = time.Date(2022, 5, 14, 20, 0, 0, 0, time.UTC)
+	b.state.Records[0].Ended = time.Date(2022, 5, 14, 23, 5, 0, 0, time.UTC)
+	b.state.Records[0].PeakListeners = 1234
+	assert.Equal(t, Response{Text: "последний эфир 14.05.22 20:00 - 23:05, выпуск 800, 3ч 5мин, слушателей до 1234", Send: true},
+		b.OnMessage(Message{Text: "broadcast!"}))
+}
+
+func TestBroadcast_ResumeAfterRestart(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+
+	started := time.Now().Add(-time.Hour).Truncate(time.Second)
+	b := &BroadcastStatus{}
+	b.state.Records = []BroadcastRecord{{Started: started, Show: 800}}
+	b.NewPrep("https://radio-t.com/p/2022/05/17/prep-801/")
+	b.check(ctx, time.Time{}, BroadcastParams{URL: ts.URL, Client: http.Client{}})
+
+	live, liveStarted := b.Live()
+	require.True(t, live)
+	assert.Equal(t, started, liveStarted)
+	require.Equal(t, 1, len(b.state.Records))
+	assert.Equal(t, 800, b.state.Records[0].Show)
+
+	// too old unfinished broadcast
+	b = &BroadcastStatus{}
+	b.state.Records = []BroadcastRecord{{Started: time.Now().Add(-24 * time.Hour)}}
+	b.NewPrep("https://radio-t.com/p/2022/05/17/prep-801/")
+	b.check(ctx, time.Time{}, BroadcastParams{URL: ts.URL, Client: http.Client{}})
+	require.Equal(t, 2, len(b.state.Records))
+	assert.Equal(t, 801, b.state.Records[1].Show)
+	assert.Equal(t, Response{Text: "последний эфир начался 14.05.22 20:00, выпуск 800, окончание неизвестно", Send: true},
+		(&BroadcastStatus{state: broadcastState{Records: []BroadcastRecord{{Started: time.Date(2022, 5, 14, 20, 0, 0, 0, time.UTC), Show: 800}}}}).
+			OnMessage(Message{Text: "broadcast!"}))
 }
@@ -0,0 +1,194 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// Dropout is a short stream outage during the broadcast, too short to finish it
+type Dropout struct {
+	Started  time.Time     `json:"started"`
+	Duration time.Duration `json:"duration"`
+}
+
+// StreamSample is a point of the broadcast quality timeline
+type StreamSample struct {
+	Time      time.Time `json:"time"`
+	Down      bool      `json:"down,omitempty"` // stream is not available
+	Listeners int       `json:"listeners,omitempty"`
+	Bitrate   int       `json:"bitrate,omitempty"`
+}
+
+// timelineStep defines how often stream status added to the timeline, changes and dropouts added immediately
+const timelineStep = time.Minute
+
+// learnSuper remembers user ID of super-user to send alerts, should be called under lock
+func (b *BroadcastStatus) learnSuper(user User) {
+	if b.superUser == nil || user.ID == 0 || user.Username == "" || !b.superUser.IsSuper(user.Username) {
+		return
+	}
+	if b.state.Supers == nil {
+		b.state.Supers = map[string]int{}
+	}
+	name := strings.ToLower(user.Username)
+	if b.state.Supers[name] != user.ID {
+		b.state.Supers[name] = user.ID
+		b.save()
+	}
+}
+
+// defaultDropoutPings is the number of failed pings in a row to alert about dropout if not set by params
+const defaultDropoutPings = 2
+
+// startDropout marks the stream as down while the broadcast is on and counts failed pings. Every outage
+// recorded, super-users alerted after DropoutPings failures in a row only, as a single failed ping is likely
+// a network blip. Should be called under lock
+func (b *BroadcastStatus) startDropout(ctx context.Context, params BroadcastParams) {
+	if b.dropoutAt.IsZero() {
+		b.dropoutAt = time.Now()
+		log.Printf("[WARN] stream dropout at %v", b.dropoutAt)
+		b.addSample(StreamSample{Time: b.dropoutAt, Down: true})
+	}
+	b.failedPings++
+	pings := params.DropoutPings
+	if pings <= 0 {
+		pings = defaultDropoutPings
+	}
+	if b.dropoutAlerted || b.failedPings < pings {
+		return
+	}
+	b.dropoutAlerted = true
+	b.alert(ctx, params, fmt.Sprintf("⚠️ поток недоступен с %s, если эфир не закончен - проверьте трансляцию",
+		b.localTime(b.dropoutAt).Format("15:04:05")))
+}
+
+// endDropout records dropout if the stream is back, should be called under lock
+func (b *BroadcastStatus) endDropout(ctx context.Context, params BroadcastParams) {
+	if b.dropoutAt.IsZero() || len(b.state.Records) == 0 {
+		return
+	}
+	d := Dropout{Started: b.dropoutAt, Duration: time.Since(b.dropoutAt).Truncate(time.Second)}
+	alerted := b.dropoutAlerted
+	b.resetDropout()
+	log.Printf("[INFO] stream is back after %v", d.Duration)
+
+	rec := &b.state.Records[len(b.state.Records)-1]
+	rec.Dropouts = append(rec.Dropouts, d)
+	b.addSample(StreamSample{Time: time.Now(), Listeners: b.stream.Listeners, Bitrate: b.stream.Bitrate})
+	b.save()
+	if alerted {
+		b.alert(ctx, params, fmt.Sprintf("✅ поток снова доступен, перерыв %s, %d за эфир",
+			humanizeSeconds(d.Duration), len(rec.Dropouts)))
+	}
+}
+
+// resetDropout forgets the current outage, should be called under lock
+func (b *BroadcastStatus) resetDropout() {
+	b.dropoutAt = time.Time{}
+	b.failedPings = 0
+	b.dropoutAlerted = false
+}
+
+// addSample appends the stream state to the timeline of the current broadcast if it changed
+// or the last sample is older than timelineStep, should be called under lock
+func (b *BroadcastStatus) addSample(s StreamSample) {
+	if len(b.state.Records) == 0 {
+		return
+	}
+	rec := &b.state.Records[len(b.state.Records)-1]
+	if n := len(rec.Timeline); n > 0 {
+		last := rec.Timeline[n-1]
+		if last.Down == s.Down && last.Bitrate == s.Bitrate && s.Time.Sub(last.Time) < timelineStep {
+			return
+		}
+	}
+	rec.Timeline = append(rec.Timeline, s)
+}
+
+// alert sends private messages to known super-users, asynchronously to avoid blocking on the submitter
+func (b *BroadcastStatus) alert(ctx context.Context, params BroadcastParams, text string) {
+	if params.Submitter == nil {
+		return
+	}
+	ids := make([]int64, 0, len(b.state.Supers))
+	for _, id := range b.state.Supers {
+		ids = append(ids, int64(id))
+	}
+	if len(ids) == 0 {
+		log.Printf("[WARN] no super-users to alert, %s", text)
+		return
+	}
+	go func() {
+		for _, id := range ids {
+			if err := params.Submitter.SubmitTo(ctx, id, Response{Text: text, Send: true}); err != nil {
+				log.Printf("[WARN] can't alert %d, %v", id, err)
+			}
+		}
+	}()
+}
+
+// timeline reports stream quality of the current or the last broadcast, should be called under lock
+func (b *BroadcastStatus) timeline() string {
+	if len(b.state.Records) == 0 {
+		return "эфиров еще не было"
+	}
+	rec := b.state.Records[len(b.state.Records)-1]
+	var lines []string
+	var shown StreamSample
+	for i, s := range rec.Timeline {
+		prev := StreamSample{}
+		if i > 0 {
+			prev = rec.Timeline[i-1]
+		}
+		if i > 0 && !s.Down && !prev.Down && prev.Bitrate == s.Bitrate && s.Time.Sub(shown.Time) < 15*time.Minute {
+			continue // keep changes, recoveries and a sample each 15 minutes
+		}
+		shown = s
+		line := b.localTime(s.Time).Format("15:04:05")
+		switch {
+		case s.Down:
+			line += " поток недоступен"
+		case s.Bitrate > 0:
+			line += fmt.Sprintf(" слушателей %d, %d kbps", s.Listeners, s.Bitrate)
+		default:
+			line += fmt.Sprintf(" слушателей %d", s.Listeners)
+		}
+		lines = append(lines, line)
+	}
+
+	res := fmt.Sprintf("эфир %s, обрывов %d", b.localTime(rec.Started).Format("02.01.06 15:04"), len(rec.Dropouts))
+	if len(rec.Dropouts) > 0 {
+		res += ", всего " + humanizeSeconds(rec.DropoutsDuration())
+	}
+	if len(lines) > 0 {
+		res += "\n" + strings.Join(lines, "\n")
+	}
+	return res
+}
+
+// DropoutsDuration returns total time of dropouts of the broadcast
+func (r BroadcastRecord) DropoutsDuration() (res time.Duration) {
+	for _, d := range r.Dropouts {
+		res += d.Duration
+	}
+	return res
+}
+
+// localTime converts t to the bot's location, if defined
+func (b *BroadcastStatus) localTime(t time.Time) time.Time {
+	if b.location == nil {
+		return t
+	}
+	return t.In(b.location)
+}
+
+// humanizeSeconds is HumanizeDuration with seconds precision and "0сек" for zero
+func humanizeSeconds(d time.Duration) string {
+	if d = d.Truncate(time.Second); d <= 0 {
+		return "0сек"
+	}
+	return HumanizeDuration(d)
+}
@@ -0,0 +1,138 @@
+package bot
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/radio-t/super-bot/app/bot/mocks"
+)
+
+func TestBroadcast_Dropout(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	on := true
+	onMx := sync.Mutex{}
+	setOn := func(v bool) {
+		onMx.Lock()
+		on = v
+		onMx.Unlock()
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		onMx.Lock()
+		defer onMx.Unlock()
+		if on {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer ts.Close()
+
+	su := &mocks.SuperUser{}
+	su.On("IsSuper", "umputun").Return(true)
+	su.On("IsSuper", mock.Anything).Return(false)
+
+	var alerts []string
+	alertsMx := sync.Mutex{}
+	sub := &MockSubmitter{}
+	sub.On("SubmitTo", mock.Anything, int64(1), mock.Anything).Return(nil).Run(func(args mock.Arguments) {
+		alertsMx.Lock()
+		alerts = append(alerts, args.Get(2).(Response).Text)
+		alertsMx.Unlock()
+	})
+	alertsCount := func() int {
+		alertsMx.Lock()
+		defer alertsMx.Unlock()
+		return len(alerts)
+	}
+
+	params := BroadcastParams{URL: ts.URL, DelayToOff: time.Minute, DropoutPings: 2, Client: http.Client{}, Submitter: sub}
+	b := &BroadcastStatus{superUser: su}
+	b.OnMessage(Message{Text: "hi", From: User{ID: 1, Username: "umputun"}})
+	b.OnMessage(Message{Text: "hi", From: User{ID: 2, Username: "user"}})
+	assert.Equal(t, map[string]int{"umputun": 1}, b.state.Supers)
+
+	lastOn := b.check(ctx, time.Time{}, params)
+	require.True(t, b.status)
+
+	// a single failed ping is recorded, but not alerted
+	setOn(false)
+	lastOn = b.check(ctx, lastOn, params)
+	require.True(t, b.status)
+	setOn(true)
+	lastOn = b.check(ctx, lastOn, params)
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, 0, alertsCount())
+	require.Equal(t, 1, len(b.state.Records[0].Dropouts))
+	require.Equal(t, 2, len(b.state.Records[0].Timeline))
+
+	setOn(false)
+	lastOn = b.check(ctx, lastOn, params)
+	lastOn = b.check(ctx, lastOn, params)
+	require.True(t, b.status, "still on, dropout only")
+	b.check(ctx, lastOn, params)
+	require.Eventually(t, func() bool { return alertsCount() == 1 }, time.Second, 10*time.Millisecond)
+
+	setOn(true)
+	b.check(ctx, lastOn, params)
+	require.Eventually(t, func() bool { return alertsCount() == 2 }, time.Second, 10*time.Millisecond)
+	assert.Regexp(t, `^⚠️ поток недоступен с \d\d:\d\d:\d\d, если эфир не закончен - проверьте трансляцию$`, alerts[0])
+	assert.Equal(t, "✅ поток снова доступен, перерыв 0сек, 2 за эфир", alerts[1])
+
+	rec := b.state.Records[0]
+	require.Equal(t, 2, len(rec.Dropouts))
+	require.Equal(t, 4, len(rec.Timeline))
+	assert.True(t, rec.Timeline[2].Down)
+	assert.False(t, rec.Timeline[3].Down)
+
+	resp := b.OnMessage(Message{Text: "timeline!", From: User{ID: 1, Username: "umputun"}})
+	assert.Regexp(t, `^эфир \d\d\.\d\d\.\d\d \d\d:\d\d, обрывов 2, всего 0сек\n\d\d:\d\d:\d\d поток недоступен\n`+
+		`\d\d:\d\d:\d\d слушателей 0\n\d\d:\d\d:\d\d поток недоступен\n\d\d:\d\d:\d\d слушателей 0$`, resp.Text)
+	resp = b.OnMessage(Message{Text: "timeline!", From: User{ID: 2, Username: "user"}})
+	assert.NotContains(t, resp.Text, "обрывов", "not super")
+
+	// the final outage is not a dropout and not alerted
+	setOn(false)
+	lastOn = b.check(ctx, time.Now().Add(-2*time.Minute), params)
+	require.False(t, b.status)
+	b.check(ctx, lastOn, params)
+	b.check(ctx, lastOn, params)
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, 2, alertsCount(), "no alerts after the broadcast finished")
+	assert.Equal(t, 2, len(b.state.Records[0].Dropouts))
+	assert.True(t, b.dropoutAt.IsZero())
+	assert.Equal(t, 0, b.failedPings)
+}
+
+func TestBroadcast_Timeline(t *testing.T) {
+	started := time.Date(2022, 5, 14, 20, 0, 0, 0, time.UTC)
+	b := &BroadcastStatus{}
+	assert.Equal(t, "эфиров еще не было", b.timeline())
+
+	b.state.Records = []BroadcastRecord{{Started: started}}
+	for i := 0; i < 40; i++ {
+		b.addSample(StreamSample{Time: started.Add(time.Duration(i) * 30 * time.Second), Listeners: 100 + i, Bitrate: 128})
+	}
+	b.addSample(StreamSample{Time: started.Add(20*time.Minute + 10*time.Second), Down: true})
+	b.addSample(StreamSample{Time: started.Add(20*time.Minute + 40*time.Second), Listeners: 90, Bitrate: 64})
+	b.state.Records[0].Dropouts = []Dropout{{Started: started.Add(20*time.Minute + 10*time.Second), Duration: 30 * time.Second}}
+	assert.Equal(t, 22, len(b.state.Records[0].Timeline), "a sample per minute and changes")
+
+	assert.Equal(t, "эфир 14.05.22 20:00, обрывов 1, всего 30сек\n"+
+		"20:00:00 слушателей 100, 128 kbps\n"+
+		"20:15:00 слушателей 130, 128 kbps\n"+
+		"20:20:10 поток недоступен\n"+
+		"20:20:40 слушателей 90, 64 kbps", b.timeline())
+
+	b.state.Records[0].Ended = started.Add(time.Hour)
+	assert.Equal(t, "последний эфир 14.05.22 20:00 - 21:00, 1ч, обрывов 1 (30сек)", b.lastBroadcast())
+}
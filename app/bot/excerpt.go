@@ -1,32 +1,67 @@
 package bot
 
 import (
-	"encoding/json"
-	"errors"
+	"context"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
+	"net"
 	"net/http"
+	"net/url"
 	"regexp"
 	"strings"
+	"syscall"
 	"time"
+
+	"github.com/go-pkgz/lcw"
+	"github.com/pkg/errors"
 )
 
-// Excerpt bot, returns link excerpt
+// Excerpt bot, returns excerpt of the article linked in the message. The page is fetched with size and time limits,
+// title, description and the main text extracted by extractArticle. Results cached by url
 type Excerpt struct {
-	api   string
-	token string
+	ExcerptParams
+	cache lcw.LoadingCache
+}
+
+// ExcerptParams defines limits and domains of Excerpt bot
+type ExcerptParams struct {
+	Client    HTTPClient    // optional, the default one doesn't connect to private, loopback and link-local addresses
+	Allow     []string      // domains with excerpts, subdomains included. All domains if empty
+	Deny      []string      // domains without excerpts, i.e. twitter.com
+	MaxSize   int64         // max size of the page read, 1Mb by default
+	Timeout   time.Duration // fetch time limit, 5s by default
+	MaxLength int           // max length of the excerpt, 300 by default
 }
 
 var (
-	rLink = regexp.MustCompile(`(https?://[a-zA-Z0-9\-.]+\.[a-zA-Z]{2,3}(/\S*)?)`)
+	rLink = regexp.MustCompile(`(https?://[a-zA-Z0-9\-.]+\.[a-zA-Z]{2,24}(/\S*)?)`)
 	rImg  = regexp.MustCompile(`\.gif|\.jpg|\.jpeg|\.png`)
+
+	// privateNets are not routed to the internet, IPv4 private and shared address space and IPv6 unique local
+	privateNets = mustParseCIDRs("10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "100.64.0.0/10", "fc00::/7")
 )
 
 // NewExcerpt makes a bot extracting articles excerpt
-func NewExcerpt(api string, token string) *Excerpt {
-	log.Printf("[INFO] Excerpt bot with %s", api)
-	return &Excerpt{api: api, token: token}
+func NewExcerpt(params ExcerptParams) *Excerpt {
+	if params.MaxSize == 0 {
+		params.MaxSize = 1024 * 1024
+	}
+	if params.Timeout == 0 {
+		params.Timeout = 5 * time.Second
+	}
+	if params.MaxLength == 0 {
+		params.MaxLength = 300
+	}
+	if params.Client == nil {
+		// checked on connect, after dns lookup and on redirects as well
+		dialer := &net.Dialer{Timeout: params.Timeout, Control: publicOnly}
+		params.Client = &http.Client{Transport: &http.Transport{DialContext: dialer.DialContext}}
+	}
+	log.Printf("[INFO] excerpt bot, allow %v, deny %v", params.Allow, params.Deny)
+	c, _ := lcw.NewExpirableCache(lcw.MaxKeys(1000), lcw.TTL(12*time.Hour))
+	return &Excerpt{ExcerptParams: params, cache: c}
 }
 
 // Help returns help message
@@ -34,61 +69,137 @@ func (e *Excerpt) Help() string {
 	return ""
 }
 
-// OnMessage pass msg to all bots and collects responses
+// OnMessage returns excerpt of the first link in the message shared by not a bot
 func (e *Excerpt) OnMessage(msg Message) (response Response) {
+	if msg.From.IsBot {
+		return Response{}
+	}
 
 	link, err := e.link(msg.Text)
 	if err != nil {
 		return Response{}
 	}
 
-	client := http.Client{Timeout: 5 * time.Second}
-	url := fmt.Sprintf("%s?token=%s&url=%s", e.api, e.token, link)
-	resp, err := client.Get(url)
+	res, err := e.cache.Get(link, func() (interface{}, error) {
+		return e.article(link)
+	})
 	if err != nil {
-		log.Printf("[WARN] can't send request to parse article to %s, %v", url, err)
+		log.Printf("[WARN] can't get article %s, %v", link, err)
 		return Response{}
 	}
-	defer func() { _ = resp.Body.Close() }()
+	a := res.(article)
 
-	if resp.StatusCode >= 400 {
-		log.Printf("[WARN] parser error code %d for %v", resp.StatusCode, url)
+	text := a.Description
+	if len([]rune(text)) < 50 && len([]rune(a.Text)) > len([]rune(text)) {
+		text = a.Text
+	}
+	if text == "" {
 		return Response{}
 	}
+	text = EscapeMarkDown(shorten(text, e.MaxLength))
+	if a.Title != "" {
+		text += fmt.Sprintf("\n\n_%s_", strings.NewReplacer("_", " ", "*", "", "`", "'", "[", "(", "]", ")").Replace(a.Title))
+	}
+	return Response{Text: text, Send: true}
+}
 
-	r := struct {
-		Title   string `json:"title"`
-		Excerpt string `json:"excerpt"`
-	}{}
-
-	body, err := ioutil.ReadAll(resp.Body)
+// article fetches the page and extracts the article. Not html pages make empty article
+func (e *Excerpt) article(link string) (article, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), e.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", link, nil)
 	if err != nil {
-		log.Printf("[WARN] can't read response for %s, %v", url, err)
-		return Response{}
+		return article{}, errors.Wrapf(err, "failed to make request %s", link)
 	}
+	req.Header.Set("Accept", "text/html")
 
-	if err := json.Unmarshal(body, &r); err != nil {
-		log.Printf("[WARN] can't decode response for %s, %v", url, err)
+	resp, err := e.Client.Do(req)
+	if err != nil {
+		return article{}, errors.Wrapf(err, "failed to send request %s", link)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return article{}, errors.Errorf("request %s returned %d", link, resp.StatusCode)
 	}
 
-	return Response{
-		Text: fmt.Sprintf("%s\n\n_%s_", r.Excerpt, r.Title),
-		Send: true,
+	contentType := resp.Header.Get("Content-Type")
+	if contentType != "" && !strings.Contains(contentType, "html") {
+		log.Printf("[DEBUG] not html %s, %s", link, contentType)
+		return article{}, nil
 	}
+	page, err := ioutil.ReadAll(io.LimitReader(resp.Body, e.MaxSize))
+	if err != nil {
+		return article{}, errors.Wrapf(err, "failed to read %s", link)
+	}
+	return extractArticle(decodePage(page, contentType)), nil
 }
 
+// link returns the first link of the text, not to an image and allowed by domain lists
 func (e *Excerpt) link(input string) (link string, err error) {
+	l := rLink.FindString(input)
+	if l == "" || rImg.MatchString(l) {
+		return "", errors.New("no link found")
+	}
+	u, err := url.Parse(l)
+	if err != nil {
+		return "", errors.Wrapf(err, "bad link %s", l)
+	}
+	host := strings.ToLower(u.Hostname())
+	if matchDomain(host, e.Deny) || (len(e.Allow) > 0 && !matchDomain(host, e.Allow)) {
+		log.Printf("[DEBUG] ignore link %s", l)
+		return "", errors.Errorf("domain %s not allowed", host)
+	}
+	log.Printf("[DEBUG] found a link %s", l)
+	return l, nil
+}
 
-	if strings.Contains(input, "twitter.com") {
-		log.Printf("ignore possible twitter link from %s", input)
-		return "", errors.New("ignore twitter")
+// matchDomain checks if host is one of domains or their subdomain
+func matchDomain(host string, domains []string) bool {
+	for _, d := range domains {
+		d = strings.ToLower(strings.TrimSpace(d))
+		if d != "" && (host == d || strings.HasSuffix(host, "."+d)) {
+			return true
+		}
 	}
+	return false
+}
+
+// publicOnly is net.Dialer control rejecting connections to private, loopback, link-local and unspecified addresses
+func publicOnly(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return errors.Wrapf(err, "bad address %s", address)
+	}
+	if ip := net.ParseIP(host); ip == nil || !publicIP(ip) {
+		return errors.Errorf("address %s not allowed", address)
+	}
+	return nil
+}
+
+// publicIP checks if ip is a public internet address
+func publicIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsUnspecified() ||
+		ip.IsInterfaceLocalMulticast() {
+		return false
+	}
+	for _, n := range privateNets {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
 
-	if l := rLink.FindString(input); l != "" && !rImg.MatchString(l) {
-		log.Printf("found a link %s", l)
-		return l, nil
+// mustParseCIDRs parses networks list, panics on error
+func mustParseCIDRs(cidrs ...string) (res []*net.IPNet) {
+	for _, c := range cidrs {
+		_, n, err := net.ParseCIDR(c)
+		if err != nil {
+			panic(err)
+		}
+		res = append(res, n)
 	}
-	return "", errors.New("no link found")
+	return res
 }
 
 // ReactOn keys
@@ -1,11 +1,20 @@
 package bot
 
 import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
+
+	"github.com/radio-t/super-bot/app/bot/mocks"
 )
 
 func TestExcerpt_Link(t *testing.T) {
@@ -21,9 +30,13 @@ func TestExcerpt_Link(t *testing.T) {
 		{"blah https://radio-t.com/aa.png blah2", "", true},
 		{"blah https://radio-t.com/png blah2", "https://radio-t.com/png", false},
 		{"blah https://twitter.com/radio_t/status/811670832510537730", "", true},
+		{"blah https://mobile.twitter.com/radio_t/status/811670832510537730", "", true},
+		{"https://example.media/post", "https://example.media/post", false},
+		{"https://blocked.example.com/post", "", true},
+		{"https://nottwitter.com/post", "https://nottwitter.com/post", false},
 	}
 
-	ex := NewExcerpt("https://ureadability.radio-t.com/api/content/v1/parser", "")
+	ex := NewExcerpt(ExcerptParams{Deny: []string{"twitter.com", "blocked.example.com"}})
 	for i, tt := range tbl {
 		t.Run(strconv.Itoa(i), func(t *testing.T) {
 			link, err := ex.link(tt.inp)
@@ -33,33 +46,106 @@ func TestExcerpt_Link(t *testing.T) {
 			assert.Equal(t, tt.link, link)
 		})
 	}
+
+	ex = NewExcerpt(ExcerptParams{Allow: []string{"radio-t.com"}})
+	link, err := ex.link("https://news.radio-t.com/post/1")
+	require.NoError(t, err)
+	assert.Equal(t, "https://news.radio-t.com/post/1", link)
+	_, err = ex.link("https://example.com/post/1")
+	assert.EqualError(t, err, "domain example.com not allowed")
 }
 
 func TestExcerpt(t *testing.T) {
+	pages := map[string]struct {
+		contentType string
+		body        string
+	}{
+		"https://radio-t.com/p/2016/11/06/bot/": {"text/html; charset=utf-8", `<html><head>
+			<title>Больше ботов - Радио-Т</title>
+			<meta property="og:title" content="Больше ботов, хороших и разных">
+			<meta property="og:description" content="В выпуске 520 была озвучена идея &laquo;сделай своего бота для любимого подкаста&raquo;.">
+			</head><body><p>Текст статьи, который не нужен, потому что есть описание.</p></body></html>`},
+		"https://example.com/no-meta": {"text/html", `<html><head><title>Some_title [draft]</title></head><body>
+			<nav><p>Home, About, Contacts, Blog, Archive and many other links</p></nav>
+			<div class="post-content">
+				<p>The first paragraph of the post, long enough to be counted as the text.</p>
+				<p>The second paragraph with *stars* and _underscores_, also long enough.</p>
+			</div>
+			<div id="comments"><p>Great post, thanks, I learned a lot from it!!!</p></div>
+			</body></html>`},
+		"https://example.com/image": {"image/jpeg", "binary"},
+		"https://example.com/empty": {"text/html", "<html><body>nothing</body></html>"},
+	}
+	client := &mocks.HTTPClient{}
+	client.On("Do", mock.Anything).Return(func(req *http.Request) *http.Response {
+		p, ok := pages[req.URL.String()]
+		if !ok {
+			return &http.Response{StatusCode: http.StatusNotFound, Body: ioutil.NopCloser(strings.NewReader(""))}
+		}
+		return &http.Response{StatusCode: http.StatusOK, Header: http.Header{"Content-Type": []string{p.contentType}},
+			Body: ioutil.NopCloser(bytes.NewBufferString(p.body))}
+	}, nil)
 
+	ex := NewExcerpt(ExcerptParams{Client: client, MaxLength: 100, Deny: []string{"twitter.com"}})
 	tbl := []struct {
-		link    string
-		excerpt string
-		fail    bool
+		msg  Message
+		resp Response
 	}{
-		{"https://radio-t.com/p/2016/11/06/bot/", "В выпуске 520 была озвучена идея “сделай своего бота для любимого подкаста”." +
-			" Я создал репо для этого дела где попытался описать как и что. Надеюсь, " +
-			"получилось понятно. В двух словах - каждый ваш бот это микро-рест запакованный в контейнер и " +
-			"получающий все сообщения из нашего чата. Если боту есть ...\n\n" +
-			"_Больше ботов, хороших и разных — Радио-Т Подкаст_", false},
-		{"https://xxxx.radio-t.com blah2", "", true},
+		{Message{Text: "смотрите https://radio-t.com/p/2016/11/06/bot/ !"}, Response{Text: "В выпуске 520 была озвучена идея " +
+			"«сделай своего бота для любимого подкаста».\n\n_Больше ботов, хороших и разных_", Send: true}},
+		{Message{Text: "https://example.com/no-meta"}, Response{Text: "The first paragraph of the post, long enough to be " +
+			"counted as the text. The second paragraph with \\*s…\n\n_Some title (draft)_", Send: true}},
+		{Message{Text: "https://example.com/image"}, Response{}},
+		{Message{Text: "https://example.com/empty"}, Response{}},
+		{Message{Text: "https://example.com/not-found"}, Response{}},
+		{Message{Text: "https://twitter.com/radio_t"}, Response{}},
+		{Message{Text: "https://example.com/no-meta", From: User{Username: "other_bot", IsBot: true}}, Response{}},
+	}
+	for i, tt := range tbl {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			assert.Equal(t, tt.resp, ex.OnMessage(tt.msg))
+		})
 	}
 
-	ex := NewExcerpt("https://ureadability.radio-t.com/api/content/v1/parser", "123456")
+	calls := len(client.Calls)
+	assert.Equal(t, 5, calls)
+	ex.OnMessage(Message{Text: "again https://radio-t.com/p/2016/11/06/bot/"})
+	assert.Equal(t, calls, len(client.Calls), "cached")
+}
+
+func TestExcerpt_PrivateAddress(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`<html><head><meta property="og:description" content="internal page"></head></html>`))
+	}))
+	defer ts.Close()
 
+	ex := NewExcerpt(ExcerptParams{})
+	_, err := ex.article(ts.URL)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "not allowed")
+
+	tbl := []struct {
+		ip     string
+		public bool
+	}{
+		{"8.8.8.8", true},
+		{"2a00:1450:4010:c05::8a", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"172.20.0.1", false},
+		{"192.168.1.1", false},
+		{"100.64.0.1", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"fd00::1", false},
+		{"0.0.0.0", false},
+		{"::", false},
+		{"::ffff:127.0.0.1", false},
+	}
 	for i, tt := range tbl {
 		t.Run(strconv.Itoa(i), func(t *testing.T) {
-			r := ex.OnMessage(Message{Text: tt.link})
-			require.Equal(t, tt.fail, !r.Send)
-			if !tt.fail {
-				assert.Equal(t, tt.excerpt, r.Text)
-			}
+			assert.Equal(t, tt.public, publicIP(net.ParseIP(tt.ip)))
 		})
 	}
-
 }
@@ -0,0 +1,430 @@
+package bot
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/radio-t/super-bot/app/storage"
+)
+
+// FeedWatcher announces new items of RSS 2.0 and Atom feeds. Feeds defined in ConfigFile, one per line:
+// url|chat|interval|keywords|template. Seen items kept in StoreFile, the first check of a feed only
+// remembers its items. Announcements limited per feed check and per chat minute to stay within telegram flood limits
+type FeedWatcher struct {
+	FeedWatcherParams
+	feeds []feedConfig
+	store *storage.JSONFile
+	now   func() time.Time
+
+	lock  sync.Mutex
+	sent  map[int64][]time.Time // chat to times of recent announcements
+	state struct {
+		Seen map[string][]string `json:"seen"` // feed url to IDs of seen items
+	}
+}
+
+// FeedWatcherParams defines feed watcher
+type FeedWatcherParams struct {
+	Client       HTTPClient
+	Submitter    Submitter
+	ConfigFile   string // i.e. data/feeds.data
+	StoreFile    string
+	MaxPerCheck  int // new items of a feed announced at once, the rest on the next checks. 5 by default
+	MaxPerMinute int // announcements to a chat per minute, 20 by default
+}
+
+// FeedItem is an item of the feed passed to the template
+type FeedItem struct {
+	Feed        string // title of the feed
+	ID          string
+	Title       string
+	Link        string
+	Author      string
+	Description string
+	Published   time.Time
+}
+
+type feedConfig struct {
+	url      string
+	chatID   int64 // zero for the primary group
+	interval time.Duration
+	keywords []string
+	tmpl     *template.Template
+	next     time.Time // time of the next check
+}
+
+const (
+	defaultFeedTemplate = "📰 {{md .Feed}}: {{md .Title}} - {{.Link}}"
+	defaultFeedInterval = time.Hour
+	maxSeenFeedItems    = 200 // seen IDs kept per feed, in addition to the current items
+)
+
+// NewFeedWatcher makes FeedWatcher with feeds from params.ConfigFile
+func NewFeedWatcher(params FeedWatcherParams) (*FeedWatcher, error) {
+	lines, err := readLines(params.ConfigFile)
+	if err != nil {
+		return nil, err
+	}
+	feeds, err := parseFeedsConfig(lines)
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't parse %s", params.ConfigFile)
+	}
+	store, err := storage.NewJSONFile(params.StoreFile)
+	if err != nil {
+		return nil, err
+	}
+	if params.MaxPerCheck == 0 {
+		params.MaxPerCheck = 5
+	}
+	if params.MaxPerMinute == 0 {
+		params.MaxPerMinute = 20
+	}
+
+	w := &FeedWatcher{FeedWatcherParams: params, feeds: feeds, store: store, now: time.Now, sent: map[int64][]time.Time{}}
+	if err = store.Load(&w.state); err != nil {
+		return nil, err
+	}
+	if w.state.Seen == nil {
+		w.state.Seen = map[string][]string{}
+	}
+	log.Printf("[INFO] feed watcher with %d feeds from %s", len(feeds), params.ConfigFile)
+	for _, fc := range feeds {
+		log.Printf("[DEBUG] feed %v", fc)
+	}
+	return w, nil
+}
+
+// parseFeedsConfig parses feed lines, empty lines and lines started with # ignored.
+// Template is the last field and may contain "|"
+func parseFeedsConfig(lines []string) (res []feedConfig, err error) {
+	funcs := template.FuncMap{"md": EscapeMarkDown}
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.SplitN(line, "|", 5)
+		for len(fields) < 5 {
+			fields = append(fields, "")
+		}
+		for j := range fields {
+			fields[j] = strings.TrimSpace(fields[j])
+		}
+
+		fc := feedConfig{url: fields[0], interval: defaultFeedInterval}
+		if fc.url == "" {
+			return nil, errors.Errorf("no feed url in line %d", i+1)
+		}
+		if fields[1] != "" {
+			if fc.chatID, err = strconv.ParseInt(fields[1], 10, 64); err != nil {
+				return nil, errors.Wrapf(err, "bad chat in line %d", i+1)
+			}
+		}
+		if fields[2] != "" {
+			if fc.interval, err = time.ParseDuration(fields[2]); err != nil || fc.interval < time.Minute {
+				return nil, errors.Errorf("bad interval %q in line %d, should be 1m or more", fields[2], i+1)
+			}
+		}
+		for _, k := range strings.Split(fields[3], ",") {
+			if k = strings.ToLower(strings.TrimSpace(k)); k != "" {
+				fc.keywords = append(fc.keywords, k)
+			}
+		}
+		tmpl := fields[4]
+		if tmpl == "" {
+			tmpl = defaultFeedTemplate
+		}
+		if fc.tmpl, err = template.New(fc.url).Funcs(funcs).Parse(tmpl); err != nil {
+			return nil, errors.Wrapf(err, "bad template in line %d", i+1)
+		}
+		res = append(res, fc)
+	}
+	return res, nil
+}
+
+// Run checks due feeds every step, blocking until ctx done
+func (w *FeedWatcher) Run(ctx context.Context, step time.Duration) {
+	if len(w.feeds) == 0 {
+		log.Print("[INFO] no feeds to watch")
+		return
+	}
+	ticker := time.NewTicker(step)
+	defer ticker.Stop()
+	for {
+		w.checkFeeds(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// checkFeeds checks all feeds with passed interval and saves seen items
+func (w *FeedWatcher) checkFeeds(ctx context.Context) {
+	changed := false
+	for i := range w.feeds {
+		fc := &w.feeds[i]
+		if w.now().Before(fc.next) {
+			continue
+		}
+		fc.next = w.now().Add(fc.interval)
+		ch, err := w.check(ctx, *fc)
+		if err != nil {
+			log.Printf("[WARN] failed to check feed %s, %v", fc.url, err)
+		}
+		changed = changed || ch
+	}
+	if !changed {
+		return
+	}
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if err := w.store.Save(w.state); err != nil {
+		log.Printf("[WARN] can't save feeds state, %v", err)
+	}
+}
+
+// check gets the feed and announces new matching items, the oldest first. Returns true if seen items changed
+func (w *FeedWatcher) check(ctx context.Context, fc feedConfig) (changed bool, err error) {
+	items, err := w.fetch(fc.url)
+	if err != nil {
+		return false, err
+	}
+
+	w.lock.Lock()
+	seenIDs, known := w.state.Seen[fc.url]
+	w.lock.Unlock()
+	seen := map[string]bool{}
+	for _, id := range seenIDs {
+		seen[id] = true
+	}
+
+	announced := 0
+	for i := len(items) - 1; i >= 0; i-- {
+		item := items[i]
+		if seen[item.ID] {
+			continue
+		}
+		if known && fc.match(item) {
+			if announced >= w.MaxPerCheck || !w.allow(fc.chatID) {
+				break // the rest on the next check
+			}
+			text, e := fc.text(item)
+			if e != nil {
+				log.Printf("[WARN] %v", e)
+			} else if e = w.Submitter.SubmitTo(ctx, fc.chatID, Response{Text: text, Send: true}); e != nil {
+				err = errors.Wrapf(e, "can't announce %s", item.Link)
+				break
+			}
+			log.Printf("[INFO] announced feed item %s", item.Link)
+			announced++
+		}
+		seen[item.ID] = true
+		seenIDs = append(seenIDs, item.ID)
+		changed = true
+	}
+	if !known {
+		log.Printf("[INFO] feed %s with %d items", fc.url, len(items))
+		changed = true
+	}
+	if keep := maxSeenFeedItems + len(items); len(seenIDs) > keep { // enough to cover all items of the feed
+		seenIDs = seenIDs[len(seenIDs)-keep:]
+	}
+
+	w.lock.Lock()
+	if seenIDs == nil {
+		seenIDs = []string{}
+	}
+	w.state.Seen[fc.url] = seenIDs
+	w.lock.Unlock()
+	return changed, err
+}
+
+// allow checks and counts announcement to the chat within MaxPerMinute limit
+func (w *FeedWatcher) allow(chatID int64) bool {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	now := w.now()
+	recent := w.sent[chatID][:0]
+	for _, t := range w.sent[chatID] {
+		if now.Sub(t) < time.Minute {
+			recent = append(recent, t)
+		}
+	}
+	w.sent[chatID] = recent
+	if len(recent) >= w.MaxPerMinute {
+		log.Printf("[WARN] feeds flood limit for chat %d", chatID)
+		return false
+	}
+	w.sent[chatID] = append(recent, now)
+	return true
+}
+
+// match checks if the item has any of keywords in title or description, all items match without keywords
+func (fc feedConfig) match(item FeedItem) bool {
+	if len(fc.keywords) == 0 {
+		return true
+	}
+	text := strings.ToLower(item.Title + " " + item.Description)
+	for _, k := range fc.keywords {
+		if strings.Contains(text, k) {
+			return true
+		}
+	}
+	return false
+}
+
+// text makes announcement of the item with feed's template
+func (fc feedConfig) text(item FeedItem) (string, error) {
+	buf := bytes.Buffer{}
+	if err := fc.tmpl.Execute(&buf, item); err != nil {
+		return "", errors.Wrapf(err, "can't make announcement of %s", item.Link)
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// fetch gets and parses the feed
+func (w *FeedWatcher) fetch(feedURL string) ([]FeedItem, error) {
+	req, err := http.NewRequest("GET", feedURL, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to make request %s", feedURL)
+	}
+	resp, err := w.Client.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to send request %s", feedURL)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("request %s returned %d", feedURL, resp.StatusCode)
+	}
+
+	buf := bytes.Buffer{}
+	if _, err = buf.ReadFrom(resp.Body); err != nil {
+		return nil, errors.Wrapf(err, "failed to read %s", feedURL)
+	}
+	return parseFeed(buf.Bytes())
+}
+
+type rssFeed struct {
+	Channel struct {
+		Title string `xml:"title"`
+		Items []struct {
+			Title       string `xml:"title"`
+			Link        string `xml:"link"`
+			GUID        string `xml:"guid"`
+			Description string `xml:"description"`
+			Author      string `xml:"author"`
+			Creator     string `xml:"http://purl.org/dc/elements/1.1/ creator"`
+			PubDate     string `xml:"pubDate"`
+		} `xml:"item"`
+	} `xml:"channel"`
+}
+
+type atomFeed struct {
+	Title   string `xml:"title"`
+	Entries []struct {
+		ID    string `xml:"id"`
+		Title string `xml:"title"`
+		Links []struct {
+			Href string `xml:"href,attr"`
+			Rel  string `xml:"rel,attr"`
+		} `xml:"link"`
+		Summary   string `xml:"summary"`
+		Content   string `xml:"content"`
+		Author    string `xml:"author>name"`
+		Published string `xml:"published"`
+		Updated   string `xml:"updated"`
+	} `xml:"entry"`
+}
+
+// parseFeed parses RSS 2.0 or Atom feed, items in the feed order
+func parseFeed(data []byte) ([]FeedItem, error) {
+	root := struct{ XMLName xml.Name }{}
+	if err := xml.Unmarshal(data, &root); err != nil {
+		return nil, errors.Wrap(err, "can't parse feed")
+	}
+
+	var res []FeedItem
+	switch root.XMLName.Local {
+	case "rss":
+		feed := rssFeed{}
+		if err := xml.Unmarshal(data, &feed); err != nil {
+			return nil, errors.Wrap(err, "can't parse rss")
+		}
+		title := strings.TrimSpace(feed.Channel.Title)
+		for _, it := range feed.Channel.Items {
+			item := FeedItem{Feed: title, ID: strings.TrimSpace(it.GUID), Title: strings.TrimSpace(it.Title),
+				Link: strings.TrimSpace(it.Link), Author: strings.TrimSpace(it.Author),
+				Description: strings.TrimSpace(it.Description), Published: parseFeedTime(it.PubDate)}
+			if item.Author == "" {
+				item.Author = strings.TrimSpace(it.Creator)
+			}
+			res = append(res, item)
+		}
+	case "feed":
+		feed := atomFeed{}
+		if err := xml.Unmarshal(data, &feed); err != nil {
+			return nil, errors.Wrap(err, "can't parse atom")
+		}
+		title := strings.TrimSpace(feed.Title)
+		for _, e := range feed.Entries {
+			item := FeedItem{Feed: title, ID: strings.TrimSpace(e.ID), Title: strings.TrimSpace(e.Title),
+				Author: strings.TrimSpace(e.Author), Description: strings.TrimSpace(e.Summary),
+				Published: parseFeedTime(e.Published)}
+			for _, l := range e.Links {
+				if l.Rel == "" || l.Rel == "alternate" {
+					item.Link = strings.TrimSpace(l.Href)
+					break
+				}
+			}
+			if item.Description == "" {
+				item.Description = strings.TrimSpace(e.Content)
+			}
+			if item.Published.IsZero() {
+				item.Published = parseFeedTime(e.Updated)
+			}
+			res = append(res, item)
+		}
+	default:
+		return nil, errors.Errorf("unknown feed format %q", root.XMLName.Local)
+	}
+
+	for i := range res {
+		if res[i].ID == "" {
+			res[i].ID = res[i].Link
+		}
+		if res[i].ID == "" {
+			res[i].ID = res[i].Title
+		}
+	}
+	return res, nil
+}
+
+// parseFeedTime parses time of RSS (RFC 822/1123) or Atom (RFC 3339), zero time if unknown
+func parseFeedTime(s string) time.Time {
+	s = strings.TrimSpace(s)
+	for _, layout := range []string{time.RFC1123Z, time.RFC1123, time.RFC3339, "Mon, 2 Jan 2006 15:04:05 -0700",
+		"Mon, 2 Jan 2006 15:04:05 MST", time.RFC822Z, time.RFC822} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// String describes the feed for logs
+func (fc feedConfig) String() string {
+	return fmt.Sprintf("%s to %d every %v", fc.url, fc.chatID, fc.interval)
+}
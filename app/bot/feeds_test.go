@@ -0,0 +1,248 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+const testRSS = `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0" xmlns:dc="http://purl.org/dc/elements/1.1/">
+<channel>
+	<title>Guest blog</title>
+	%s
+</channel>
+</rss>`
+
+const testAtom = `<?xml version="1.0" encoding="UTF-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+	<title>Release notes from remark42</title>
+	<entry>
+		<id>tag:github.com,2008:Repository/1/v1.9.0</id>
+		<updated>2022-01-10T10:00:00Z</updated>
+		<link rel="alternate" type="text/html" href="https://github.com/umputun/remark42/releases/tag/v1.9.0"/>
+		<title>v1.9.0</title>
+		<content type="html">Fixes for the_bug</content>
+		<author><name>umputun</name></author>
+	</entry>
+	<entry>
+		<id>tag:github.com,2008:Repository/1/v1.8.1</id>
+		<published>2021-06-01T10:00:00Z</published>
+		<link rel="self" href="https://example.com/self"/>
+		<link href="https://github.com/umputun/remark42/releases/tag/v1.8.1"/>
+		<title>v1.8.1</title>
+		<summary>Minor</summary>
+	</entry>
+</feed>`
+
+func rssItems(from, to int) string {
+	res := ""
+	for i := to; i >= from; i-- {
+		res += fmt.Sprintf("<item><title>Post %d</title><link>https://blog.example.com/%d</link>"+
+			"<description>about go and docker</description><dc:creator>guest</dc:creator>"+
+			"<pubDate>Mon, 02 Jan 2006 15:04:05 -0700</pubDate></item>\n", i, i)
+	}
+	return res
+}
+
+func TestParseFeed(t *testing.T) {
+	items, err := parseFeed([]byte(fmt.Sprintf(testRSS, rssItems(1, 2))))
+	require.NoError(t, err)
+	assert.Equal(t, []FeedItem{
+		{Feed: "Guest blog", ID: "https://blog.example.com/2", Title: "Post 2", Link: "https://blog.example.com/2",
+			Author: "guest", Description: "about go and docker", Published: time.Date(2006, 1, 2, 22, 4, 5, 0, time.UTC)},
+		{Feed: "Guest blog", ID: "https://blog.example.com/1", Title: "Post 1", Link: "https://blog.example.com/1",
+			Author: "guest", Description: "about go and docker", Published: time.Date(2006, 1, 2, 22, 4, 5, 0, time.UTC)},
+	}, utcItems(items))
+
+	items, err = parseFeed([]byte(testAtom))
+	require.NoError(t, err)
+	assert.Equal(t, []FeedItem{
+		{Feed: "Release notes from remark42", ID: "tag:github.com,2008:Repository/1/v1.9.0", Title: "v1.9.0",
+			Link: "https://github.com/umputun/remark42/releases/tag/v1.9.0", Author: "umputun",
+			Description: "Fixes for the_bug", Published: time.Date(2022, 1, 10, 10, 0, 0, 0, time.UTC)},
+		{Feed: "Release notes from remark42", ID: "tag:github.com,2008:Repository/1/v1.8.1", Title: "v1.8.1",
+			Link: "https://github.com/umputun/remark42/releases/tag/v1.8.1", Description: "Minor",
+			Published: time.Date(2021, 6, 1, 10, 0, 0, 0, time.UTC)},
+	}, utcItems(items))
+
+	_, err = parseFeed([]byte(`<html><body>not a feed</body></html>`))
+	assert.EqualError(t, err, `unknown feed format "html"`)
+	_, err = parseFeed([]byte(`{"json": true}`))
+	assert.Error(t, err)
+}
+
+func utcItems(items []FeedItem) []FeedItem {
+	for i := range items {
+		items[i].Published = items[i].Published.UTC()
+	}
+	return items
+}
+
+func TestParseFeedsConfig(t *testing.T) {
+	tbl := []struct {
+		lines []string
+		feeds []string
+		err   string
+	}{
+		{[]string{"# comment", "", "https://example.com/feed"}, []string{"https://example.com/feed to 0 every 1h0m0s"}, ""},
+		{[]string{"https://example.com/feed|-1001|30m|go, Docker|{{.Title}} | {{.Link}}"},
+			[]string{"https://example.com/feed to -1001 every 30m0s"}, ""},
+		{[]string{"|1"}, nil, "no feed url in line 1"},
+		{[]string{"https://example.com/feed|chat"}, nil, `bad chat in line 1: strconv.ParseInt: parsing "chat": invalid syntax`},
+		{[]string{"https://example.com/feed||10s"}, nil, `bad interval "10s" in line 1, should be 1m or more`},
+		{[]string{"", "https://example.com/feed||||{{if .Title}}x"}, nil, "bad template in line 2"},
+	}
+	for i, tt := range tbl {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			feeds, err := parseFeedsConfig(tt.lines)
+			if tt.err != "" {
+				require.Error(t, err)
+				assert.True(t, strings.HasPrefix(err.Error(), tt.err), err.Error())
+				return
+			}
+			require.NoError(t, err)
+			var res []string
+			for _, fc := range feeds {
+				res = append(res, fc.String())
+			}
+			assert.Equal(t, tt.feeds, res)
+		})
+	}
+
+	feeds, err := parseFeedsConfig([]string{"https://example.com/feed|-1001|30m|go, Docker|{{.Title}} | {{.Link}}"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"go", "docker"}, feeds[0].keywords)
+	text, err := feeds[0].text(FeedItem{Title: "title", Link: "link"})
+	require.NoError(t, err)
+	assert.Equal(t, "title | link", text)
+}
+
+func TestFeedWatcher_Check(t *testing.T) {
+	posts := 2
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/blog.xml":
+			fmt.Fprintf(w, testRSS, rssItems(1, posts))
+		case "/releases.atom":
+			fmt.Fprint(w, testAtom)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	tmp, err := ioutil.TempDir("", "feeds")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmp)
+	config := ts.URL + "/blog.xml||5m|docker\n" +
+		ts.URL + "/releases.atom|-1001|1h||🚀 {{.Feed}} {{.Title}}: {{.Link}}\n" +
+		ts.URL + "/missing.xml\n"
+	require.NoError(t, ioutil.WriteFile(filepath.Join(tmp, "feeds.data"), []byte(config), 0600))
+
+	now := time.Date(2022, 5, 14, 20, 0, 0, 0, time.UTC)
+	submitter := &MockSubmitter{}
+	params := FeedWatcherParams{Client: &http.Client{Timeout: time.Second}, Submitter: submitter,
+		ConfigFile: filepath.Join(tmp, "feeds.data"), StoreFile: filepath.Join(tmp, "feeds.json"), MaxPerCheck: 2, MaxPerMinute: 3}
+	w, err := NewFeedWatcher(params)
+	require.NoError(t, err)
+	w.now = func() time.Time { return now }
+	require.Len(t, w.feeds, 3)
+
+	// the first check remembers items, nothing announced
+	w.checkFeeds(context.Background())
+	assert.Len(t, w.state.Seen[ts.URL+"/blog.xml"], 2)
+	assert.Len(t, w.state.Seen[ts.URL+"/releases.atom"], 2)
+	submitter.AssertExpectations(t)
+
+	// new posts announced oldest first, MaxPerCheck at once
+	posts = 5
+	now = now.Add(5 * time.Minute)
+	for i := 3; i <= 4; i++ {
+		submitter.On("SubmitTo", mock.Anything, int64(0), Response{Text: fmt.Sprintf("📰 Guest blog: Post %d - https://blog.example.com/%d", i, i),
+			Send: true}).Return(nil).Once()
+	}
+	w.checkFeeds(context.Background())
+	submitter.AssertExpectations(t)
+	assert.Len(t, w.state.Seen[ts.URL+"/blog.xml"], 4)
+
+	// not due yet
+	now = now.Add(time.Minute)
+	w.checkFeeds(context.Background())
+	submitter.AssertExpectations(t)
+
+	// the rest on the next check, restarted watcher keeps seen items
+	w, err = NewFeedWatcher(params)
+	require.NoError(t, err)
+	w.now = func() time.Time { return now }
+	submitter.On("SubmitTo", mock.Anything, int64(0), Response{Text: "📰 Guest blog: Post 5 - https://blog.example.com/5",
+		Send: true}).Return(nil).Once()
+	w.checkFeeds(context.Background())
+	submitter.AssertExpectations(t)
+	assert.Len(t, w.state.Seen[ts.URL+"/blog.xml"], 5)
+}
+
+func TestFeedWatcher_Filters(t *testing.T) {
+	var items string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, testRSS, items)
+	}))
+	defer ts.Close()
+
+	tmp, err := ioutil.TempDir("", "feeds")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmp)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(tmp, "feeds.data"),
+		[]byte(ts.URL+"|123|1m|rust, kotlin|{{.Title}} by {{.Author}}"), 0600))
+
+	now := time.Date(2022, 5, 14, 20, 0, 0, 0, time.UTC)
+	submitter := &MockSubmitter{}
+	w, err := NewFeedWatcher(FeedWatcherParams{Client: &http.Client{Timeout: time.Second}, Submitter: submitter,
+		ConfigFile: filepath.Join(tmp, "feeds.data"), StoreFile: filepath.Join(tmp, "feeds.json"), MaxPerMinute: 2})
+	require.NoError(t, err)
+	w.now = func() time.Time { return now }
+	w.checkFeeds(context.Background())
+
+	item := func(guid, title string) string {
+		return fmt.Sprintf("<item><guid>%s</guid><title>%s</title><author>guest</author></item>", guid, title)
+	}
+	items = item("4", "About Rust again") + item("3", "About KOTLIN") + item("2", "About Go") + item("1", "About Rust")
+	now = now.Add(time.Minute)
+	submitter.On("SubmitTo", mock.Anything, int64(123), Response{Text: "About Rust by guest", Send: true}).Return(nil).Once()
+	submitter.On("SubmitTo", mock.Anything, int64(123), Response{Text: "About KOTLIN by guest", Send: true}).Return(nil).Once()
+	w.checkFeeds(context.Background())
+	submitter.AssertExpectations(t)
+	assert.Equal(t, []string{"1", "2", "3"}, w.state.Seen[ts.URL], "flood limit, the last one is not seen yet")
+
+	// within the same minute still limited
+	now = now.Add(30 * time.Second)
+	w.feeds[0].next = now
+	w.checkFeeds(context.Background())
+	submitter.AssertExpectations(t)
+
+	// failed announcement is retried
+	now = now.Add(time.Minute)
+	submitter.On("SubmitTo", mock.Anything, int64(123), Response{Text: "About Rust again by guest", Send: true}).
+		Return(fmt.Errorf("failed")).Once()
+	w.checkFeeds(context.Background())
+	assert.Equal(t, []string{"1", "2", "3"}, w.state.Seen[ts.URL])
+
+	now = now.Add(time.Minute)
+	submitter.On("SubmitTo", mock.Anything, int64(123), Response{Text: "About Rust again by guest", Send: true}).
+		Return(nil).Once()
+	w.checkFeeds(context.Background())
+	submitter.AssertExpectations(t)
+	assert.Equal(t, []string{"1", "2", "3", "4"}, w.state.Seen[ts.URL])
+}
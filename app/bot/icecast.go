@@ -0,0 +1,110 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// StreamStatus is a state of the stream reported by Icecast or Shoutcast status endpoint
+type StreamStatus struct {
+	Listeners int    // listeners of all mounts
+	Bitrate   int    // kbps
+	Mount     string // i.e. /stream
+	Title     string // current title metadata
+}
+
+// icecastSource is a mount in icecast's status-json.xsl
+type icecastSource struct {
+	Listeners int             `json:"listeners"`
+	Bitrate   json.RawMessage `json:"bitrate"` // number or string, depends on the source
+	ListenURL string          `json:"listenurl"`
+	Title     string          `json:"title"`
+}
+
+// shoutcastStats is a shoutcast v2 /stats?json=1 response
+type shoutcastStats struct {
+	CurrentListeners *int   `json:"currentlisteners"`
+	Bitrate          string `json:"bitrate"`
+	SongTitle        string `json:"songtitle"`
+	StreamPath       string `json:"streampath"`
+}
+
+// fetchStreamStatus gets and parses status json
+func fetchStreamStatus(ctx context.Context, client http.Client, statusURL string) (StreamStatus, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", statusURL, nil)
+	if err != nil {
+		return StreamStatus{}, errors.Wrapf(err, "can't make request to %s", statusURL)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return StreamStatus{}, errors.Wrapf(err, "can't get %s", statusURL)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return StreamStatus{}, errors.Errorf("status %d from %s", resp.StatusCode, statusURL)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return StreamStatus{}, errors.Wrapf(err, "can't read %s", statusURL)
+	}
+	return parseStreamStatus(body)
+}
+
+// parseStreamStatus understands icecast status-json.xsl, with one or many sources, and shoutcast v2 stats
+func parseStreamStatus(body []byte) (StreamStatus, error) {
+	ice := struct {
+		IceStats *struct {
+			Source json.RawMessage `json:"source"`
+		} `json:"icestats"`
+	}{}
+	if err := json.Unmarshal(body, &ice); err != nil {
+		return StreamStatus{}, errors.Wrap(err, "can't decode stream status")
+	}
+
+	if ice.IceStats == nil {
+		sc := shoutcastStats{}
+		if err := json.Unmarshal(body, &sc); err != nil || sc.CurrentListeners == nil {
+			return StreamStatus{}, errors.New("unknown stream status format")
+		}
+		bitrate, _ := strconv.Atoi(sc.Bitrate)
+		return StreamStatus{Listeners: *sc.CurrentListeners, Bitrate: bitrate, Mount: sc.StreamPath,
+			Title: sc.SongTitle}, nil
+	}
+
+	var sources []icecastSource
+	if len(ice.IceStats.Source) > 0 && ice.IceStats.Source[0] == '[' {
+		if err := json.Unmarshal(ice.IceStats.Source, &sources); err != nil {
+			return StreamStatus{}, errors.Wrap(err, "can't decode icecast sources")
+		}
+	} else if len(ice.IceStats.Source) > 0 {
+		src := icecastSource{}
+		if err := json.Unmarshal(ice.IceStats.Source, &src); err != nil {
+			return StreamStatus{}, errors.Wrap(err, "can't decode icecast source")
+		}
+		sources = append(sources, src)
+	}
+
+	res := StreamStatus{}
+	for i, src := range sources {
+		res.Listeners += src.Listeners
+		if i > 0 {
+			continue // metadata of the first mount
+		}
+		res.Title = src.Title
+		if u, err := url.Parse(src.ListenURL); err == nil {
+			res.Mount = u.Path
+		}
+		var bitrate interface{}
+		if err := json.Unmarshal(src.Bitrate, &bitrate); err == nil {
+			res.Bitrate, _ = strconv.Atoi(fmt.Sprintf("%v", bitrate))
+		}
+	}
+	return res, nil
+}
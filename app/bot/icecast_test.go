@@ -0,0 +1,61 @@
+package bot
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseStreamStatus(t *testing.T) {
+	tbl := []struct {
+		body string
+		res  StreamStatus
+		err  bool
+	}{
+		{`{"icestats":{"admin":"x","source":{"listeners":12,"bitrate":128,"listenurl":"http://s.radio-t.com:80/stream",
+			"title":"Радио-Т 800"}}}`, StreamStatus{Listeners: 12, Bitrate: 128, Mount: "/stream", Title: "Радио-Т 800"}, false},
+		{`{"icestats":{"source":[{"listeners":10,"bitrate":"192","listenurl":"http://s.radio-t.com/stream"},
+			{"listeners":5,"bitrate":64,"listenurl":"http://s.radio-t.com/low"}]}}`,
+			StreamStatus{Listeners: 15, Bitrate: 192, Mount: "/stream"}, false},
+		{`{"icestats":{"server_id":"Icecast 2.4.4"}}`, StreamStatus{}, false},
+		{`{"currentlisteners":7,"bitrate":"128","songtitle":"live","streampath":"/stream"}`,
+			StreamStatus{Listeners: 7, Bitrate: 128, Mount: "/stream", Title: "live"}, false},
+		{`{"something":"else"}`, StreamStatus{}, true},
+		{`<html>`, StreamStatus{}, true},
+	}
+
+	for i, tt := range tbl {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			res, err := parseStreamStatus([]byte(tt.body))
+			if tt.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.res, res)
+		})
+	}
+}
+
+func TestFetchStreamStatus(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/status-json.xsl" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(`{"icestats":{"source":{"listeners":42,"bitrate":128}}}`))
+	}))
+	defer ts.Close()
+
+	res, err := fetchStreamStatus(context.Background(), http.Client{}, ts.URL+"/status-json.xsl")
+	require.NoError(t, err)
+	assert.Equal(t, StreamStatus{Listeners: 42, Bitrate: 128}, res)
+
+	_, err = fetchStreamStatus(context.Background(), http.Client{}, ts.URL+"/bad")
+	require.EqualError(t, err, "status 404 from "+ts.URL+"/bad")
+}
@@ -0,0 +1,86 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/radio-t/super-bot/app/search"
+)
+
+// LogSearch bot searches chat archive, i.e. "log! докер from:umputun after:2021-01-01"
+type LogSearch struct {
+	searcher Searcher
+	limit    int
+	location *time.Location
+}
+
+// Searcher is a full-text index of the chat archive
+type Searcher interface {
+	Search(q search.Query, limit int) []search.Result
+}
+
+// NewLogSearch makes LogSearch bot returning up to limit results
+func NewLogSearch(searcher Searcher, limit int) (*LogSearch, error) {
+	location, err := time.LoadLocation("Europe/Moscow")
+	if err != nil {
+		return nil, errors.Wrap(err, "can't load location")
+	}
+	log.Printf("[INFO] log search bot with limit %d", limit)
+	return &LogSearch{searcher: searcher, limit: limit, location: location}, nil
+}
+
+// Help returns help message
+func (l *LogSearch) Help() string {
+	return genHelpMsg(l.ReactOn(), "поиск по архиву чата, фильтры from:user, date:, after:, before: (2021-01-31)")
+}
+
+// ReactOn keys
+func (l *LogSearch) ReactOn() []string {
+	return []string{"log!", "архив!"}
+}
+
+// OnMessage searches archive for the text after command
+func (l *LogSearch) OnMessage(msg Message) (response Response) {
+	text := strings.TrimSpace(msg.Text)
+	var args string
+	for _, prefix := range l.ReactOn() {
+		if strings.HasPrefix(strings.ToLower(text), prefix) {
+			args = strings.TrimSpace(text[len(prefix):])
+			break
+		}
+	}
+	if args == "" {
+		return Response{}
+	}
+
+	q, err := search.ParseQuery(args, l.location)
+	if err != nil {
+		return Response{Text: fmt.Sprintf("не понял запрос, %v", err), Send: true}
+	}
+	res := l.searcher.Search(q, l.limit)
+	if len(res) == 0 {
+		return Response{Text: "ничего не нашлось", Send: true}
+	}
+
+	lines := make([]string, 0, len(res))
+	for _, r := range res {
+		line := fmt.Sprintf("%s %s: %s", r.Sent.In(l.location).Format("02.01.06 15:04"),
+			EscapeMarkDown(searchAuthor(r)), EscapeMarkDown(shorten(r.Text, 100)))
+		if r.Link != "" {
+			line += fmt.Sprintf(" [»](%s)", r.Link)
+		}
+		lines = append(lines, line)
+	}
+	return Response{Text: strings.Join(lines, "\n"), Send: true}
+}
+
+func searchAuthor(r search.Result) string {
+	if r.Username != "" {
+		return "@" + r.Username
+	}
+	return r.DisplayName
+}
@@ -0,0 +1,62 @@
+package bot
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/radio-t/super-bot/app/search"
+)
+
+type searcherMock struct {
+	query search.Query
+	res   []search.Result
+}
+
+func (s *searcherMock) Search(q search.Query, limit int) []search.Result {
+	s.query = q
+	if len(s.res) > limit {
+		return s.res[:limit]
+	}
+	return s.res
+}
+
+func TestLogSearch_OnMessage(t *testing.T) {
+	sent := time.Date(2021, 3, 6, 20, 1, 0, 0, time.UTC)
+	sm := &searcherMock{res: []search.Result{
+		{Document: search.Document{ID: 2, Sent: sent, Username: "user_1", Text: "про *докер*"},
+			Link: "https://chat.radio-t.com/logs/radio-t-745.html#msg-2"},
+		{Document: search.Document{ID: 1, Sent: sent.Add(-time.Minute), DisplayName: "John Doe", Text: "докер\nнужен"}},
+		{Document: search.Document{ID: 0, Sent: sent.Add(-time.Hour), Username: "umputun", Text: "старый докер"}},
+	}}
+	ls, err := NewLogSearch(sm, 2)
+	require.NoError(t, err)
+
+	tbl := []struct {
+		text string
+		resp Response
+	}{
+		{"log!", Response{}},
+		{"log! докер", Response{Text: "06.03.21 23:01 @user\\_1: про \\*докер\\* [»](https://chat.radio-t.com/logs/radio-t-745.html#msg-2)\n" +
+			"06.03.21 23:00 John Doe: докер нужен", Send: true}},
+		{"Архив! докер date:вчера", Response{Text: "не понял запрос, can't parse date \"вчера\"", Send: true}},
+	}
+	for i, tt := range tbl {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			assert.Equal(t, tt.resp, ls.OnMessage(Message{Text: tt.text}))
+		})
+	}
+
+	sm.res = nil
+	assert.Equal(t, Response{Text: "ничего не нашлось", Send: true}, ls.OnMessage(Message{Text: "log! k8s from:bobuk"}))
+	assert.Equal(t, "bobuk", sm.query.Author)
+}
+
+func TestShorten(t *testing.T) {
+	assert.Equal(t, "abc", shorten("abc", 5))
+	assert.Equal(t, "a b c", shorten(" a\nb  c ", 5))
+	assert.Equal(t, "абв…", shorten("абв где", 4))
+}
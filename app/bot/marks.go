@@ -0,0 +1,286 @@
+package bot
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/radio-t/super-bot/app/storage"
+)
+
+// Marks bot records chapter markers while the broadcast is live. Hosts post "mark! Docker news"
+// and the chapter is recorded at the offset from the broadcast start. When the broadcast ends
+// the bot posts the full chapter list with hh:mm:ss timecodes.
+type Marks struct {
+	MarksParams
+	store *storage.JSONFile
+	now   func() time.Time
+
+	lock  sync.Mutex
+	state struct {
+		Sessions []marksSession `json:"sessions"` // the last one is the current or most recent broadcast
+	}
+	wasLive bool
+}
+
+// MarksParams defines parameters for Marks bot
+type MarksParams struct {
+	Broadcast   BroadcastState // broadcast status provider, usually BroadcastStatus bot
+	SuperUser   SuperUser      // only super users can mark and edit
+	StoreFile   string         // json file to keep marks
+	ExportPath  string         // directory to write exported chapters to
+	MaxSessions int            // number of broadcasts to keep in the store
+}
+
+// BroadcastState reports if broadcast is live and when it started
+type BroadcastState interface {
+	Live() (live bool, started time.Time)
+}
+
+type marksSession struct {
+	Started time.Time     `json:"started"`
+	Ended   time.Time     `json:"ended,omitempty"`
+	Marks   []chapterMark `json:"marks"`
+}
+
+type chapterMark struct {
+	Offset time.Duration `json:"offset"`
+	Title  string        `json:"title"`
+	By     string        `json:"by"`
+}
+
+// sessionResumeWindow defines how far the stored open session start may be from the reported one
+// to be treated as the same broadcast, i.e. after bot restart in the middle of the show
+const sessionResumeWindow = 6 * time.Hour
+
+// NewMarks makes Marks bot and loads stored sessions
+func NewMarks(params MarksParams) (*Marks, error) {
+	log.Printf("[INFO] marks bot with %s", params.StoreFile)
+	store, err := storage.NewJSONFile(params.StoreFile)
+	if err != nil {
+		return nil, err
+	}
+	m := &Marks{MarksParams: params, store: store, now: time.Now}
+	if err = store.Load(&m.state); err != nil {
+		return nil, errors.Wrap(err, "can't load marks")
+	}
+	if m.MaxSessions == 0 {
+		m.MaxSessions = 10
+	}
+	return m, nil
+}
+
+// Help returns help message
+func (m *Marks) Help() string {
+	return genHelpMsg(m.ReactOn(), "отметить главу во время эфира: mark! Docker news, "+
+		"marks! - список, marks! export - сохранить (только для ведущих)")
+}
+
+// ReactOn keys
+func (m *Marks) ReactOn() []string {
+	return []string{"mark!", "marks!"}
+}
+
+// OnMessage records, edits and lists marks. Posts the chapter list once the broadcast is over
+func (m *Marks) OnMessage(msg Message) (response Response) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	live, started := m.Broadcast.Live()
+	if live && !m.wasLive {
+		m.startSession(started)
+	}
+	if !live && m.wasLive {
+		m.wasLive = false
+		if resp, ok := m.finishSession(); ok {
+			return resp
+		}
+	}
+	m.wasLive = live
+
+	text := strings.TrimSpace(msg.Text)
+	lc := strings.ToLower(text)
+	if !strings.HasPrefix(lc, "mark!") && !strings.HasPrefix(lc, "marks!") {
+		return Response{}
+	}
+	if !m.SuperUser.IsSuper(msg.From.Username) {
+		return Response{}
+	}
+
+	if strings.HasPrefix(lc, "marks!") {
+		args := strings.TrimSpace(text[len("marks!"):])
+		if contains([]string{"export", "экспорт"}, args) {
+			return Response{Text: m.export(), Send: true}
+		}
+		return Response{Text: m.list(), Send: true}
+	}
+
+	args := strings.TrimSpace(text[len("mark!"):])
+	fields := strings.Fields(args)
+	switch {
+	case len(fields) == 0:
+		return Response{}
+	case contains([]string{"edit", "del", "time"}, fields[0]):
+		return Response{Text: m.edit(fields), Send: true}
+	}
+
+	if !live {
+		return Response{Text: "эфир не идет, отмечать нечего", Send: true}
+	}
+	sess := &m.state.Sessions[len(m.state.Sessions)-1]
+	mark := chapterMark{Offset: m.now().Sub(sess.Started).Truncate(time.Second), Title: args, By: msg.From.Username}
+	sess.Marks = append(sess.Marks, mark)
+	sort.SliceStable(sess.Marks, func(i, j int) bool { return sess.Marks[i].Offset < sess.Marks[j].Offset })
+	m.save()
+	log.Printf("[INFO] chapter mark %q at %v by %s", mark.Title, mark.Offset, mark.By)
+	return Response{Text: fmt.Sprintf("отмечено %s %s", timecode(mark.Offset), EscapeMarkDown(mark.Title)), Send: true}
+}
+
+// startSession opens the new session or resumes the open one for the same broadcast. Should be called under lock
+func (m *Marks) startSession(started time.Time) {
+	if n := len(m.state.Sessions); n > 0 {
+		last := m.state.Sessions[n-1]
+		if last.Ended.IsZero() && started.Sub(last.Started) < sessionResumeWindow {
+			log.Printf("[DEBUG] resume marks session started at %v", last.Started)
+			return
+		}
+		if last.Ended.IsZero() { // stale open session, never finished properly
+			m.state.Sessions[n-1].Ended = started
+		}
+	}
+	m.state.Sessions = append(m.state.Sessions, marksSession{Started: started})
+	if len(m.state.Sessions) > m.MaxSessions {
+		m.state.Sessions = m.state.Sessions[len(m.state.Sessions)-m.MaxSessions:]
+	}
+	m.save()
+}
+
+// finishSession closes the current session and makes the chapters response. Should be called under lock
+func (m *Marks) finishSession() (Response, bool) {
+	n := len(m.state.Sessions)
+	if n == 0 || !m.state.Sessions[n-1].Ended.IsZero() {
+		return Response{}, false
+	}
+	m.state.Sessions[n-1].Ended = m.now()
+	m.save()
+	if len(m.state.Sessions[n-1].Marks) == 0 {
+		return Response{}, false
+	}
+	return Response{Text: "Главы выпуска:\n" + m.chapters(m.state.Sessions[n-1], true), Send: true}, true
+}
+
+// edit handles "edit N title", "del N" and "time N hh:mm:ss" for the current or the last session
+func (m *Marks) edit(fields []string) string {
+	if len(m.state.Sessions) == 0 {
+		return "глав нет"
+	}
+	if len(fields) < 2 {
+		return "нужен номер главы"
+	}
+	sess := &m.state.Sessions[len(m.state.Sessions)-1]
+	idx, err := strconv.Atoi(fields[1])
+	if err != nil || idx < 1 || idx > len(sess.Marks) {
+		return fmt.Sprintf("нет главы \"%s\"", EscapeMarkDown(fields[1]))
+	}
+	idx--
+
+	switch fields[0] {
+	case "edit":
+		if len(fields) < 3 {
+			return "нужно новое название"
+		}
+		sess.Marks[idx].Title = strings.Join(fields[2:], " ")
+	case "del":
+		sess.Marks = append(sess.Marks[:idx], sess.Marks[idx+1:]...)
+	case "time":
+		if len(fields) != 3 {
+			return "нужно время в формате hh:mm:ss"
+		}
+		offset, err := parseTimecode(fields[2])
+		if err != nil {
+			return fmt.Sprintf("неверное время \"%s\"", EscapeMarkDown(fields[2]))
+		}
+		sess.Marks[idx].Offset = offset
+		sort.SliceStable(sess.Marks, func(i, j int) bool { return sess.Marks[i].Offset < sess.Marks[j].Offset })
+	}
+	m.save()
+	return m.chapters(*sess, true)
+}
+
+func (m *Marks) list() string {
+	if len(m.state.Sessions) == 0 || len(m.state.Sessions[len(m.state.Sessions)-1].Marks) == 0 {
+		return "глав нет"
+	}
+	return m.chapters(m.state.Sessions[len(m.state.Sessions)-1], true)
+}
+
+// export writes chapters of the current or the last session to ExportPath
+func (m *Marks) export() string {
+	if len(m.state.Sessions) == 0 || len(m.state.Sessions[len(m.state.Sessions)-1].Marks) == 0 {
+		return "глав нет"
+	}
+	sess := m.state.Sessions[len(m.state.Sessions)-1]
+	if err := os.MkdirAll(m.ExportPath, 0750); err != nil {
+		log.Printf("[WARN] can't make %s, %v", m.ExportPath, err)
+		return "не удалось сохранить главы"
+	}
+	fname := filepath.Join(m.ExportPath, fmt.Sprintf("chapters-%s.txt", sess.Started.Format("20060102")))
+	if err := ioutil.WriteFile(fname, []byte(m.chapters(sess, false)), 0640); err != nil { //nolint:gosec
+		log.Printf("[WARN] can't write %s, %v", fname, err)
+		return "не удалось сохранить главы"
+	}
+	log.Printf("[INFO] chapters exported to %s", fname)
+	return fmt.Sprintf("главы сохранены в %s", EscapeMarkDown(fname))
+}
+
+// chapters lists marks of the session, titles escaped with md for chat messages, file export keeps them as is
+func (m *Marks) chapters(sess marksSession, md bool) string {
+	sb := strings.Builder{}
+	for i, mk := range sess.Marks {
+		title := mk.Title
+		if md {
+			title = EscapeMarkDown(title)
+		}
+		_, _ = sb.WriteString(fmt.Sprintf("%d. %s %s\n", i+1, timecode(mk.Offset), title))
+	}
+	return sb.String()
+}
+
+// save stores state, should be called under lock
+func (m *Marks) save() {
+	if err := m.store.Save(m.state); err != nil {
+		log.Printf("[WARN] can't save marks, %v", err)
+	}
+}
+
+// timecode formats duration as hh:mm:ss
+func timecode(d time.Duration) string {
+	d = d.Truncate(time.Second)
+	return fmt.Sprintf("%02d:%02d:%02d", int(d.Hours()), int(d.Minutes())%60, int(d.Seconds())%60)
+}
+
+// parseTimecode parses hh:mm:ss or mm:ss
+func parseTimecode(s string) (time.Duration, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, errors.Errorf("bad timecode %s", s)
+	}
+	var res time.Duration
+	for _, p := range parts {
+		v, err := strconv.Atoi(p)
+		if err != nil || v < 0 {
+			return 0, errors.Errorf("bad timecode %s", s)
+		}
+		res = res*60 + time.Duration(v)
+	}
+	return res * time.Second, nil
+}
@@ -0,0 +1,157 @@
+package bot
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/radio-t/super-bot/app/bot/mocks"
+)
+
+func TestMarks_OnMessage(t *testing.T) {
+	su := &mocks.SuperUser{}
+	su.On("IsSuper", "umputun").Return(true)
+	su.On("IsSuper", "user").Return(false)
+
+	bs := &broadcastStateMock{}
+	m, tmp := prepMarks(t, su, bs)
+	start := time.Date(2020, 2, 15, 20, 0, 0, 0, time.UTC)
+	now := start
+	m.now = func() time.Time { return now }
+
+	resp := m.OnMessage(Message{Text: "mark! docker_compose news", From: User{Username: "umputun"}})
+	assert.Equal(t, Response{Text: "эфир не идет, отмечать нечего", Send: true}, resp)
+
+	bs.live, bs.started = true, start
+	now = start.Add(5*time.Minute + 3*time.Second)
+	resp = m.OnMessage(Message{Text: "mark! docker_compose news", From: User{Username: "umputun"}})
+	assert.Equal(t, Response{Text: "отмечено 00:05:03 docker\\_compose news", Send: true}, resp)
+
+	resp = m.OnMessage(Message{Text: "mark! blah", From: User{Username: "user"}})
+	assert.Equal(t, Response{}, resp, "not super")
+
+	now = start.Add(time.Hour + 2*time.Minute)
+	resp = m.OnMessage(Message{Text: "mark! Go 1.16", From: User{Username: "umputun"}})
+	assert.Equal(t, Response{Text: "отмечено 01:02:00 Go 1.16", Send: true}, resp)
+
+	now = start.Add(time.Hour + 30*time.Minute)
+	resp = m.OnMessage(Message{Text: "mark! Темы слушателей", From: User{Username: "umputun"}})
+	assert.Equal(t, Response{Text: "отмечено 01:30:00 Темы слушателей", Send: true}, resp)
+
+	resp = m.OnMessage(Message{Text: "mark! edit 2 Go 1.16 released", From: User{Username: "umputun"}})
+	assert.Equal(t, Response{Text: "1. 00:05:03 docker\\_compose news\n2. 01:02:00 Go 1.16 released\n3. 01:30:00 Темы слушателей\n",
+		Send: true}, resp)
+
+	resp = m.OnMessage(Message{Text: "mark! time 3 00:01:00", From: User{Username: "umputun"}})
+	assert.Equal(t, Response{Text: "1. 00:01:00 Темы слушателей\n2. 00:05:03 docker\\_compose news\n3. 01:02:00 Go 1.16 released\n",
+		Send: true}, resp)
+
+	resp = m.OnMessage(Message{Text: "mark! del 1", From: User{Username: "umputun"}})
+	assert.Equal(t, Response{Text: "1. 00:05:03 docker\\_compose news\n2. 01:02:00 Go 1.16 released\n", Send: true}, resp)
+
+	resp = m.OnMessage(Message{Text: "mark! del 5", From: User{Username: "umputun"}})
+	assert.Equal(t, Response{Text: `нет главы "5"`, Send: true}, resp)
+
+	// restart in the middle of the broadcast resumes the session
+	m2, err := NewMarks(m.MarksParams)
+	require.NoError(t, err)
+	m2.now = m.now
+	bs.started = start.Add(2 * time.Hour)
+	resp = m2.OnMessage(Message{Text: "marks!", From: User{Username: "umputun"}})
+	assert.Equal(t, Response{Text: "1. 00:05:03 docker\\_compose news\n2. 01:02:00 Go 1.16 released\n", Send: true}, resp)
+
+	bs.live = false
+	resp = m2.OnMessage(Message{Text: "idle"})
+	assert.Equal(t, Response{Text: "Главы выпуска:\n1. 00:05:03 docker\\_compose news\n2. 01:02:00 Go 1.16 released\n", Send: true}, resp)
+	resp = m2.OnMessage(Message{Text: "idle"})
+	assert.Equal(t, Response{}, resp, "posted once")
+
+	resp = m2.OnMessage(Message{Text: "marks! export", From: User{Username: "umputun"}})
+	fname := path.Join(tmp, "export", "chapters-20200215.txt")
+	assert.Equal(t, Response{Text: "главы сохранены в " + EscapeMarkDown(fname), Send: true}, resp)
+	data, err := ioutil.ReadFile(fname)
+	require.NoError(t, err)
+	assert.Equal(t, "1. 00:05:03 docker_compose news\n2. 01:02:00 Go 1.16 released\n", string(data), "not escaped in file")
+}
+
+func TestMarks_afterBroadcast(t *testing.T) {
+	su := &mocks.SuperUser{}
+	su.On("IsSuper", "umputun").Return(true)
+	su.On("IsSuper", mock.Anything).Return(false)
+
+	start := time.Date(2020, 2, 15, 20, 0, 0, 0, time.UTC)
+	bs := &broadcastStateMock{live: true, started: start}
+	m, tmp := prepMarks(t, su, bs)
+	m.now = func() time.Time { return start.Add(10 * time.Minute) }
+	mb := NewMultiBot(m)
+
+	resp := mb.OnMessage(Message{Text: "mark! Docker news", From: User{Username: "umputun"}})
+	assert.Equal(t, "отмечено 00:10:00 Docker news", resp.Text)
+
+	bs.live = false
+	resp = mb.OnMessage(Message{Text: MsgBroadcastFinished, From: User{Username: "rtbot"}})
+	assert.Equal(t, "Главы выпуска:\n1. 00:10:00 Docker news\n", resp.Text)
+
+	resp = mb.OnMessage(Message{Text: "mark! time 1 00:12:30", From: User{Username: "umputun"}})
+	assert.Equal(t, "1. 00:12:30 Docker news\n", resp.Text)
+	resp = mb.OnMessage(Message{Text: "mark! edit 1 Docker и Podman", From: User{Username: "umputun"}})
+	assert.Equal(t, "1. 00:12:30 Docker и Podman\n", resp.Text)
+
+	resp = mb.OnMessage(Message{Text: "marks! export", From: User{Username: "umputun"}})
+	fname := path.Join(tmp, "export", "chapters-20200215.txt")
+	assert.Equal(t, "главы сохранены в "+fname, resp.Text)
+	data, err := ioutil.ReadFile(fname)
+	require.NoError(t, err)
+	assert.Equal(t, "1. 00:12:30 Docker и Podman\n", string(data))
+
+	resp = mb.OnMessage(Message{Text: "mark! late one", From: User{Username: "umputun"}})
+	assert.Equal(t, "эфир не идет, отмечать нечего", resp.Text)
+}
+
+func TestMarks_timecode(t *testing.T) {
+	tbl := []struct {
+		d  time.Duration
+		tc string
+	}{
+		{0, "00:00:00"},
+		{59*time.Second + 900*time.Millisecond, "00:00:59"},
+		{2*time.Hour + 3*time.Minute + 4*time.Second, "02:03:04"},
+	}
+	for i, tt := range tbl {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			assert.Equal(t, tt.tc, timecode(tt.d))
+			d, err := parseTimecode(tt.tc)
+			require.NoError(t, err)
+			assert.Equal(t, tt.d.Truncate(time.Second), d)
+		})
+	}
+
+	_, err := parseTimecode("12")
+	assert.Error(t, err)
+	_, err = parseTimecode("aa:bb")
+	assert.Error(t, err)
+}
+
+type broadcastStateMock struct {
+	live    bool
+	started time.Time
+}
+
+func (b *broadcastStateMock) Live() (live bool, started time.Time) { return b.live, b.started }
+
+func prepMarks(t *testing.T, su SuperUser, bs BroadcastState) (m *Marks, tmp string) {
+	tmp, err := ioutil.TempDir("", "marks")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = os.RemoveAll(tmp) })
+	m, err = NewMarks(MarksParams{Broadcast: bs, SuperUser: su, StoreFile: path.Join(tmp, "marks.json"),
+		ExportPath: path.Join(tmp, "export")})
+	require.NoError(t, err)
+	return m, tmp
+}
@@ -33,6 +33,27 @@ func (_m *TgBanClient) KickChatMember(config tgbotapi.KickChatMemberConfig) (tgb
 	return r0, r1
 }
 
+// RestrictChatMember provides a mock function with given fields: config
+func (_m *TgBanClient) RestrictChatMember(config tgbotapi.RestrictChatMemberConfig) (tgbotapi.APIResponse, error) {
+	ret := _m.Called(config)
+
+	var r0 tgbotapi.APIResponse
+	if rf, ok := ret.Get(0).(func(tgbotapi.RestrictChatMemberConfig) tgbotapi.APIResponse); ok {
+		r0 = rf(config)
+	} else {
+		r0 = ret.Get(0).(tgbotapi.APIResponse)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(tgbotapi.RestrictChatMemberConfig) error); ok {
+		r1 = rf(config)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // UnbanChatMember provides a mock function with given fields: config
 func (_m *TgBanClient) UnbanChatMember(config tgbotapi.ChatMemberConfig) (tgbotapi.APIResponse, error) {
 	ret := _m.Called(config)
@@ -1,14 +1,21 @@
 package bot
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
 	"strings"
 	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/radio-t/super-bot/app/search"
+	"github.com/radio-t/super-bot/app/storage"
 )
 
-// News bot, returns numArticles last articles in MD format from https://news.radio-t.com/api/v1/news/lastmd/5
+// News bot, returns numArticles last articles in MD format from https://news.radio-t.com/api/v1/news/lastmd/5,
+// searches recent articles and lists topics for the upcoming show. With Push running, announces new articles
 type News struct {
 	client      HTTPClient
 	newsAPI     string
@@ -16,11 +23,28 @@ type News struct {
 }
 
 type newsArticle struct {
-	Title string    `json:"title"`
-	Link  string    `json:"link"`
-	Ts    time.Time `json:"ats"`
+	ID       string    `json:"id"`
+	Title    string    `json:"title"`
+	Link     string    `json:"link"`
+	Snippet  string    `json:"snippet,omitempty"`
+	Ts       time.Time `json:"ats"`
+	Archived bool      `json:"archived,omitempty"` // discussed in one of the past shows
+	Deleted  bool      `json:"del,omitempty"`
 }
 
+// NewsPushParams defines announcements of new articles
+type NewsPushParams struct {
+	Submitter Submitter
+	StoreFile string        // json file with IDs of announced articles
+	Interval  time.Duration // how often news checked
+}
+
+const (
+	newsLookup     = 100 // how many recent articles searched and checked for topics
+	maxNewsTopics  = 20
+	maxAnnouncedID = 500 // how many IDs of announced articles kept
+)
+
 // NewNews makes new News bot
 func NewNews(client HTTPClient, api string, max int) *News {
 	log.Printf("[INFO] news bot with api %s", api)
@@ -28,41 +52,43 @@ func NewNews(client HTTPClient, api string, max int) *News {
 }
 
 // Help returns help message
-func (n News) Help() string {
-	return genHelpMsg(n.ReactOn(), "5 последних новостей для Радио-Т")
+func (n *News) Help() string {
+	return genHelpMsg(n.ReactOn(), "5 последних новостей для Радио-Т") +
+		genHelpMsg([]string{"news! <запрос>"}, "поиск по новостям, например: news! kubernetes") +
+		genHelpMsg([]string{"news! темы", "news! topic"}, "темы для ближайшего выпуска")
 }
 
-// OnMessage returns N last news articles
-func (n News) OnMessage(msg Message) (response Response) {
-	if !contains(n.ReactOn(), msg.Text) {
+// OnMessage returns N last news articles, found articles for "news! query" or topics for "news! topic"
+func (n *News) OnMessage(msg Message) (response Response) {
+	ok, query := n.request(msg.Text)
+	if !ok {
 		return Response{}
 	}
 
-	reqURL := fmt.Sprintf("%s/v1/news/last/%d", n.newsAPI, n.numArticles)
-	log.Printf("[DEBUG] request %s", reqURL)
-
-	req, err := makeHTTPRequest(reqURL)
-	if err != nil {
-		log.Printf("[WARN] failed to make request %s, error=%v", reqURL, err)
-		return Response{}
+	count := n.numArticles
+	if query != "" {
+		count = newsLookup
 	}
-
-	resp, err := n.client.Do(req)
+	articles, err := n.articles(count)
 	if err != nil {
-		log.Printf("[WARN] failed to send request %s, error=%v", reqURL, err)
+		log.Printf("[WARN] %v", err)
 		return Response{}
 	}
-	defer resp.Body.Close()
 
-	articles := []newsArticle{}
-	if err = json.NewDecoder(resp.Body).Decode(&articles); err != nil {
-		log.Printf("[WARN] failed to parse response, error %v", err)
-		return Response{}
+	switch {
+	case query == "":
+	case contains([]string{"topic", "topics", "темы"}, strings.ToLower(query)):
+		return Response{Text: n.topics(articles), Send: true}
+	default:
+		articles = n.search(articles, query)
+		if len(articles) == 0 {
+			return Response{Text: fmt.Sprintf("ничего не нашел в новостях на запрос %q", query), Send: true}
+		}
 	}
 
 	var lines []string
 	for _, a := range articles {
-		lines = append(lines, fmt.Sprintf("- [%s](%s) %s", a.Title, a.Link, a.Ts.Format("2006-01-02")))
+		lines = append(lines, fmt.Sprintf("- [%s](%s) %s", newsTitle(a.Title), a.Link, a.Ts.Format("2006-01-02")))
 	}
 	return Response{
 		Text: strings.Join(lines, "\n") + "\n- [все новости и темы](https://news.radio-t.com)",
@@ -70,7 +96,157 @@ func (n News) OnMessage(msg Message) (response Response) {
 	}
 }
 
+// request checks for news command and returns query after it, if any
+func (n *News) request(text string) (react bool, query string) {
+	for _, prefix := range n.ReactOn() {
+		if text == prefix {
+			return true, ""
+		}
+		if strings.HasPrefix(text, prefix+" ") {
+			return true, strings.TrimSpace(strings.TrimPrefix(text, prefix))
+		}
+	}
+	return false, ""
+}
+
+// search returns up to numArticles articles having all words of the query in the title or snippet
+func (n *News) search(articles []newsArticle, query string) (res []newsArticle) {
+	words := search.Tokenize(query)
+	if len(words) == 0 {
+		return nil
+	}
+	for _, a := range articles {
+		terms := map[string]bool{}
+		for _, t := range search.Tokenize(a.Title + " " + a.Snippet) {
+			terms[t] = true
+		}
+		found := true
+		for _, w := range words {
+			found = found && terms[w]
+		}
+		if found {
+			res = append(res, a)
+		}
+		if len(res) >= n.numArticles {
+			break
+		}
+	}
+	return res
+}
+
+// topics lists articles not discussed yet, i.e. queued for the upcoming show
+func (n *News) topics(articles []newsArticle) string {
+	var lines []string
+	for _, a := range articles {
+		if a.Archived || a.Deleted {
+			continue
+		}
+		if len(lines) >= maxNewsTopics {
+			lines = append(lines, "- …")
+			break
+		}
+		lines = append(lines, fmt.Sprintf("- [%s](%s)", newsTitle(a.Title), a.Link))
+	}
+	if len(lines) == 0 {
+		return "тем для выпуска пока нет"
+	}
+	return "темы для выпуска:\n" + strings.Join(lines, "\n")
+}
+
+// Push announces new articles every params.Interval. Articles are deduped by IDs kept in the store,
+// the first check without saved state only remembers the current articles. Blocking, stops on ctx done
+func (n *News) Push(ctx context.Context, params NewsPushParams) {
+	store, err := storage.NewJSONFile(params.StoreFile)
+	if err != nil {
+		log.Printf("[WARN] can't make news store, %v", err)
+		return
+	}
+	announced := []string{}
+	if err = store.Load(&announced); err != nil {
+		log.Printf("[WARN] can't load announced news, %v", err)
+	}
+	log.Printf("[INFO] news push every %v, %d announced articles", params.Interval, len(announced))
+
+	ticker := time.NewTicker(params.Interval)
+	defer ticker.Stop()
+	for {
+		if announced, err = n.push(ctx, params.Submitter, announced); err != nil {
+			log.Printf("[WARN] news push failed, %v", err)
+		}
+		if err = store.Save(announced); err != nil {
+			log.Printf("[WARN] can't save announced news, %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// push submits articles not announced yet and returns updated list of announced IDs.
+// Checks newsLookup last articles, not numArticles, to catch all of a burst added between checks
+func (n *News) push(ctx context.Context, submitter Submitter, announced []string) ([]string, error) {
+	articles, err := n.articles(newsLookup)
+	if err != nil {
+		return announced, err
+	}
+
+	seen := map[string]bool{}
+	for _, id := range announced {
+		seen[id] = true
+	}
+	first := len(announced) == 0
+	var lines []string
+	for i := len(articles) - 1; i >= 0; i-- { // the oldest first
+		a := articles[i]
+		if a.ID == "" || seen[a.ID] || a.Deleted {
+			continue
+		}
+		seen[a.ID] = true
+		announced = append(announced, a.ID)
+		if !first {
+			log.Printf("[INFO] new article %s", a.Link)
+			lines = append(lines, fmt.Sprintf("📰 [%s](%s)", newsTitle(a.Title), a.Link))
+		}
+	}
+	if len(announced) > maxAnnouncedID {
+		announced = announced[len(announced)-maxAnnouncedID:]
+	}
+	if len(lines) == 0 {
+		return announced, nil
+	}
+	return announced, submitter.SubmitTo(ctx, 0, Response{Text: strings.Join(lines, "\n"), Send: true})
+}
+
+// newsTitle cleans article title for markdown link text, brackets removed as they break the link
+func newsTitle(title string) string {
+	return strings.TrimSpace(strings.NewReplacer("[", "", "]", "").Replace(title))
+}
+
+// articles gets count last articles from news api
+func (n *News) articles(count int) ([]newsArticle, error) {
+	reqURL := fmt.Sprintf("%s/v1/news/last/%d", n.newsAPI, count)
+	log.Printf("[DEBUG] request %s", reqURL)
+
+	req, err := makeHTTPRequest(reqURL)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to make request %s", reqURL)
+	}
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to send request %s", reqURL)
+	}
+	defer resp.Body.Close()
+
+	articles := []newsArticle{}
+	if err = json.NewDecoder(resp.Body).Decode(&articles); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse response from %s", reqURL)
+	}
+	return articles, nil
+}
+
 // ReactOn keys
-func (n News) ReactOn() []string {
+func (n *News) ReactOn() []string {
 	return []string{"news!", "новости!"}
 }
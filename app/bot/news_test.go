@@ -2,15 +2,25 @@ package bot
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/radio-t/super-bot/app/bot/mocks"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
+
+	"github.com/radio-t/super-bot/app/storage"
 )
 
 func TestNewsBot_ReactionOnNewsRequest(t *testing.T) {
@@ -71,3 +81,106 @@ func TestNewsBot_ReactionOnUnexpectedMessage(t *testing.T) {
 	b := NewNews(mockHTTP, "", 5)
 	require.Equal(t, Response{}, b.OnMessage(Message{Text: "unexpected"}))
 }
+
+func TestNewsBot_SearchAndTopics(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/news/last/100", r.URL.Path)
+		articles := []newsArticle{
+			{ID: "1", Title: "Новый релиз Kubernetes", Link: "link1", Ts: time.Date(2020, 2, 10, 0, 0, 0, 0, time.UTC)},
+			{ID: "2", Title: "Go 1.14", Link: "link2", Snippet: "релизы и модули", Ts: time.Date(2020, 2, 9, 0, 0, 0, 0, time.UTC)},
+			{ID: "3", Title: "Старая новость про релиз", Link: "link3", Archived: true, Ts: time.Date(2020, 1, 9, 0, 0, 0, 0, time.UTC)},
+			{ID: "4", Title: "Удаленная", Link: "link4", Deleted: true},
+			{ID: "5", Title: "[Go] generics", Link: "link5"},
+		}
+		require.NoError(t, json.NewEncoder(w).Encode(articles))
+	}))
+	defer ts.Close()
+	b := NewNews(&http.Client{Timeout: time.Second}, ts.URL, 2)
+
+	tbl := []struct {
+		text string
+		resp Response
+	}{
+		{"news! релизы", Response{Text: "- [Новый релиз Kubernetes](link1) 2020-02-10\n- [Go 1.14](link2) 2020-02-09" +
+			"\n- [все новости и темы](https://news.radio-t.com)", Send: true}},
+		{"news! kubernetes релиз", Response{Text: "- [Новый релиз Kubernetes](link1) 2020-02-10" +
+			"\n- [все новости и темы](https://news.radio-t.com)", Send: true}},
+		{"news! generics", Response{Text: "- [Go generics](link5) 0001-01-01" +
+			"\n- [все новости и темы](https://news.radio-t.com)", Send: true}},
+		{"новости! rust", Response{Text: `ничего не нашел в новостях на запрос "rust"`, Send: true}},
+		{"news! темы", Response{Text: "темы для выпуска:\n- [Новый релиз Kubernetes](link1)\n- [Go 1.14](link2)" +
+			"\n- [Go generics](link5)", Send: true}},
+		{"news! topic", Response{Text: "темы для выпуска:\n- [Новый релиз Kubernetes](link1)\n- [Go 1.14](link2)" +
+			"\n- [Go generics](link5)", Send: true}},
+		{"news!rust", Response{}},
+	}
+	for i, tt := range tbl {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			assert.Equal(t, tt.resp, b.OnMessage(Message{Text: tt.text}))
+		})
+	}
+}
+
+func TestNewsBot_Push(t *testing.T) {
+	var articles []newsArticle
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/news/last/100", r.URL.Path)
+		require.NoError(t, json.NewEncoder(w).Encode(articles))
+	}))
+	defer ts.Close()
+
+	tmp, err := ioutil.TempDir("", "news")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmp)
+	store, err := storage.NewJSONFile(filepath.Join(tmp, "news.json"))
+	require.NoError(t, err)
+
+	b := NewNews(&http.Client{Timeout: time.Second}, ts.URL, 5)
+	submitter := &MockSubmitter{}
+	articles = []newsArticle{{ID: "2", Title: "title2", Link: "link2"}, {ID: "1", Title: "title1", Link: "link1"}}
+
+	announced, err := b.push(context.Background(), submitter, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1", "2"}, announced, "the first check only remembers articles")
+
+	articles = append([]newsArticle{{ID: "4", Title: "[title4]", Link: "link4"}, {ID: "3", Title: "title3", Link: "link3"},
+		{ID: "5", Title: "deleted", Link: "link5", Deleted: true}}, articles...)
+	submitter.On("SubmitTo", mock.Anything, int64(0), Response{Text: "📰 [title3](link3)\n📰 [title4](link4)", Send: true}).
+		Return(nil).Once()
+	announced, err = b.push(context.Background(), submitter, announced)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1", "2", "3", "4"}, announced)
+
+	announced, err = b.push(context.Background(), submitter, announced)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1", "2", "3", "4"}, announced, "nothing new")
+	submitter.AssertExpectations(t)
+
+	// burst of articles, more than numArticles, announced at once
+	var burst []string
+	for i := 7; i <= 16; i++ {
+		id := strconv.Itoa(i)
+		articles = append([]newsArticle{{ID: id, Title: "title" + id, Link: "link" + id}}, articles...)
+	}
+	for i := 7; i <= 16; i++ {
+		burst = append(burst, fmt.Sprintf("📰 [title%d](link%d)", i, i))
+	}
+	submitter.On("SubmitTo", mock.Anything, int64(0), Response{Text: strings.Join(burst, "\n"), Send: true}).
+		Return(nil).Once()
+	announced, err = b.push(context.Background(), submitter, announced)
+	require.NoError(t, err)
+	assert.Equal(t, 14, len(announced))
+	submitter.AssertExpectations(t)
+
+	// push loop keeps announced IDs in the store
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	articles = []newsArticle{{ID: "6", Title: "title6", Link: "link6"}}
+	require.NoError(t, store.Save([]string{"1"}))
+	submitter.On("SubmitTo", mock.Anything, int64(0), Response{Text: "📰 [title6](link6)", Send: true}).Return(nil).Once()
+	b.Push(ctx, NewsPushParams{Submitter: submitter, StoreFile: filepath.Join(tmp, "news.json"), Interval: time.Hour})
+	saved := []string{}
+	require.NoError(t, store.Load(&saved))
+	assert.Equal(t, []string{"1", "6"}, saved)
+	submitter.AssertExpectations(t)
+}
@@ -1,23 +1,54 @@
 package bot
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
+	"math/rand"
 	"net/http"
 	"regexp"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
+
+	"github.com/go-pkgz/lcw"
+	"github.com/pkg/errors"
+
+	"github.com/radio-t/super-bot/app/search"
+	"github.com/radio-t/super-bot/app/storage"
 )
 
 // Podcasts search bot, returns search result via site-api see https://radio-t.com/api-docs/
 // GET /search?q=text-to-search&skip=10&limit=5, example: : https://radio-t.com/site-api/search?q=mongo&limit=10
+// Also looks up episodes by number, the latest and a random one.
+// With SyncNotes running, search answered from the local index of all episodes, site-api search used as a fallback.
+// Index results paged by maxResults with inline buttons, handled by OnCallback
 type Podcasts struct {
 	client     HTTPClient
 	siteAPI    string
 	maxResults int
+	superUser  SuperUser
+	cache      lcw.LoadingCache // site-api responses of episode lookups
+	notes      *search.NotesIndex
+
+	lock  sync.Mutex
+	pages map[string]searchPages // "chatID:msgID" of the query to result pages
+}
+
+// searchPages is paged result of a search query
+type searchPages struct {
+	user    User // the user made the query
+	pages   []string
+	created time.Time
 }
 
+const (
+	searchPagesTTL = time.Hour // how long results can be paged
+	maxSearchPages = 10
+)
+
 type siteAPIResp struct {
 	URL        string    `json:"url"`
 	Title      string    `json:"title"`
@@ -28,19 +59,30 @@ type siteAPIResp struct {
 	ShowNotes  string    `json:"show_notes,omitempty"`
 	Body       string    `json:"body"`
 	ShowNum    int       `json:"show_num,omitempty"`
+	AudioURL   string    `json:"audio_url,omitempty"`
 }
 
 // NewPodcasts makes new Podcasts bot
-func NewPodcasts(client HTTPClient, api string, maxResults int) *Podcasts {
+// superUser allowed to page anyone's search results, can be nil
+func NewPodcasts(client HTTPClient, api string, maxResults int, superUser SuperUser) *Podcasts {
 	log.Printf("[INFO] podcasts bot with api %s", api)
-	return &Podcasts{client: client, siteAPI: api, maxResults: maxResults}
+	c, _ := lcw.NewExpirableCache(lcw.MaxKeys(1000), lcw.TTL(30*time.Minute))
+	return &Podcasts{client: client, siteAPI: api, maxResults: maxResults, superUser: superUser, cache: c,
+		notes: search.NewNotesIndex(), pages: map[string]searchPages{}}
 }
 
 // Help returns help message
 func (p *Podcasts) Help() string {
-	return genHelpMsg(p.ReactOn(), "искать в описаниях подкастов, например: search! lambda")
+	return genHelpMsg(searchCommands, "искать в описаниях подкастов, например: search! lambda") +
+		genHelpMsg([]string{"show!"}, "выпуск по номеру, например: show! 800") +
+		genHelpMsg([]string{"last!", "random!"}, "последний или случайный выпуск")
 }
 
+var searchCommands = []string{"search!", "подкаст!"}
+
+// maxEpisodeTopics defines how many show notes in episode responses
+const maxEpisodeTopics = 10
+
 // OnMessage returns result of search via https://radio-t.com/site-api/search?
 func (p *Podcasts) OnMessage(msg Message) (response Response) {
 
@@ -51,11 +93,19 @@ func (p *Podcasts) OnMessage(msg Message) (response Response) {
 		}
 	}()
 
+	if resp, ok := p.episode(msg.Text); ok {
+		return resp
+	}
+
 	ok, reqText := p.request(msg.Text)
 	if !ok {
 		return Response{}
 	}
 
+	if p.notes.Size() > 0 {
+		return p.searchNotes(msg, strings.Replace(reqText, "+", " ", -1))
+	}
+
 	reqURL := fmt.Sprintf("%s/search?limit=%d&q=%s", p.siteAPI, p.maxResults, reqText)
 	req, err := http.NewRequest("GET", reqURL, nil)
 	if err != nil {
@@ -88,30 +138,23 @@ func (p *Podcasts) OnMessage(msg Message) (response Response) {
 
 func (p *Podcasts) makeBotResponse(sr []siteAPIResp, reqText string) string {
 
-	makeRepLine := func(nl noteWithLink) string {
-		if nl.link != "" {
-			return fmt.Sprintf("[%s](%s)", nl.text, nl.link)
-		}
-		return nl.text
-	}
-
 	if len(sr) == 0 {
 		return fmt.Sprintf("ничего не нашел на запрос %q", reqText)
 	}
 
 	var res string
 	for _, s := range sr {
-		nls := p.notesWithLinks(s)
+		nls := notesWithLinks(s)
 		nlsStr := ""
 		for _, nl := range nls {
 
 			if strings.Contains(strings.ToLower(nl.text), strings.ToLower(reqText)) {
-				nlsStr += "●  " + makeRepLine(nl) + "\n"
+				nlsStr += "●  " + noteLine(nl.text, nl.link) + "\n"
 				continue
 			}
 
 			if strings.Contains(strings.ToLower(nl.link), strings.ToLower(reqText)) {
-				nlsStr += "○  " + makeRepLine(nl) + "\n"
+				nlsStr += "○  " + noteLine(nl.text, nl.link) + "\n"
 				continue
 			}
 		}
@@ -125,6 +168,165 @@ func (p *Podcasts) makeBotResponse(sr []siteAPIResp, reqText string) string {
 	return res
 }
 
+// searchNotes answers from the notes index, the first page of results with buttons to the next ones
+func (p *Podcasts) searchNotes(msg Message, query string) Response {
+	results := p.notes.Search(query, p.maxResults*maxSearchPages)
+	if len(results) <= p.maxResults {
+		return Response{Text: notesResponse(results, query), Send: true}
+	}
+
+	sp := searchPages{user: msg.From, created: time.Now()}
+	for i := 0; i < len(results); i += p.maxResults {
+		end := i + p.maxResults
+		if end > len(results) {
+			end = len(results)
+		}
+		sp.pages = append(sp.pages, notesResponse(results[i:end], query))
+	}
+
+	p.lock.Lock()
+	p.expirePages(sp.created)
+	p.pages[fmt.Sprintf("%d:%d", msg.ChatID, msg.ID)] = sp
+	p.lock.Unlock()
+	return searchPage(msg.ID, sp.pages, 0)
+}
+
+// OnCallback switches page of search results on "search:msgID:page" button. Only the user made the query
+// or super-user can do it
+func (p *Podcasts) OnCallback(cb Callback) (response Response, answer string) {
+	parts := strings.Split(cb.Data, ":")
+	if len(parts) != 3 || parts[0] != "search" {
+		return Response{}, ""
+	}
+	msgID, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return Response{}, ""
+	}
+	page, err := strconv.Atoi(parts[2])
+	if err != nil {
+		return Response{}, ""
+	}
+
+	p.lock.Lock()
+	p.expirePages(time.Now())
+	sp, ok := p.pages[fmt.Sprintf("%d:%d", cb.ChatID, msgID)]
+	p.lock.Unlock()
+	if !ok {
+		return Response{}, "результаты устарели, повтори поиск"
+	}
+	if cb.From.ID != sp.user.ID && (p.superUser == nil || !p.superUser.IsSuper(cb.From.Username)) {
+		return Response{}, "листать может только автор запроса"
+	}
+	if page < 0 || page >= len(sp.pages) {
+		return Response{}, ""
+	}
+	return searchPage(msgID, sp.pages, page), ""
+}
+
+// expirePages removes results older than searchPagesTTL, should be called under lock
+func (p *Podcasts) expirePages(now time.Time) {
+	for k, sp := range p.pages {
+		if now.Sub(sp.created) > searchPagesTTL {
+			delete(p.pages, k)
+		}
+	}
+}
+
+// searchPage makes response with the page of results and buttons to the previous and the next pages
+func searchPage(msgID int, pages []string, page int) Response {
+	resp := Response{Text: pages[page] + fmt.Sprintf("_страница %d из %d_", page+1, len(pages)), Send: true}
+	if page > 0 {
+		resp.Buttons = append(resp.Buttons, Button{Text: "◀", Data: fmt.Sprintf("search:%d:%d", msgID, page-1)})
+	}
+	if page < len(pages)-1 {
+		resp.Buttons = append(resp.Buttons, Button{Text: "▶", Data: fmt.Sprintf("search:%d:%d", msgID, page+1)})
+	}
+	return resp
+}
+
+// notesResponse makes search response from the index results, ● marks notes matched by text, ○ by link only
+func notesResponse(results []search.NotesResult, query string) string {
+	if len(results) == 0 {
+		return fmt.Sprintf("ничего не нашел на запрос %q", query)
+	}
+	var res string
+	for _, r := range results {
+		res += fmt.Sprintf("[Радио-Т #%d](%s) _%s_\n", r.Num, r.URL, r.Date.Format("02 Jan 06"))
+		for _, m := range r.Matches {
+			if m.InText {
+				res += "●  " + noteLine(m.Text, m.Link) + "\n"
+				continue
+			}
+			res += "○  " + noteLine(m.Text, m.Link) + "\n"
+		}
+		res += "\n"
+	}
+	return res
+}
+
+func noteLine(text, link string) string {
+	if link != "" {
+		return fmt.Sprintf("[%s](%s)", text, link)
+	}
+	return text
+}
+
+// SyncNotes mirrors all episodes from site-api to the local notes index, kept in storeFile between restarts.
+// The first sync gets all episodes, the next ones every interval only the recent. Blocking, stops on ctx done
+func (p *Podcasts) SyncNotes(ctx context.Context, storeFile string, interval time.Duration) {
+	store, err := storage.NewJSONFile(storeFile)
+	if err != nil {
+		log.Printf("[WARN] can't make notes store, %v", err)
+		return
+	}
+	episodes := []search.Episode{}
+	if err = store.Load(&episodes); err != nil {
+		log.Printf("[WARN] can't load notes from %s, %v", storeFile, err)
+	}
+	p.notes.Add(episodes...)
+	log.Printf("[INFO] loaded %d episodes to notes index", p.notes.Size())
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err = p.syncNotes(store); err != nil {
+			log.Printf("[WARN] notes sync failed, %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// syncNotes adds new and changed episodes to the index and saves them
+func (p *Podcasts) syncNotes(store *storage.JSONFile) error {
+	count := 10
+	if p.notes.Size() == 0 {
+		count = 10000 // all episodes
+	}
+	posts := []siteAPIResp{}
+	if err := p.siteAPIGet(fmt.Sprintf("%s/last/%d?categories=podcast", p.siteAPI, count), &posts); err != nil {
+		return err
+	}
+	episodes := make([]search.Episode, 0, len(posts))
+	for _, post := range posts {
+		if post.ShowNum == 0 {
+			continue
+		}
+		ep := search.Episode{Num: post.ShowNum, Title: post.Title, URL: post.URL, Date: post.Date}
+		for _, nl := range notesWithLinks(post) {
+			if strings.TrimSpace(nl.text) != "" {
+				ep.Notes = append(ep.Notes, search.Note{Text: nl.text, Link: nl.link})
+			}
+		}
+		episodes = append(episodes, ep)
+	}
+	p.notes.Add(episodes...)
+	return errors.Wrap(store.Save(p.notes.Episodes()), "failed to save notes")
+}
+
 type noteWithLink struct {
 	text string
 	link string
@@ -134,7 +336,7 @@ type noteWithLink struct {
 var linkRe = regexp.MustCompile(`<a\s+(?:[^>]*?\s+)?href="([^"]*)"`)
 
 // notesWithLinks gets notes and matching links from body
-func (p *Podcasts) notesWithLinks(s siteAPIResp) (res []noteWithLink) {
+func notesWithLinks(s siteAPIResp) (res []noteWithLink) {
 
 	// show notes may start with multiple \n, strip them all
 	showNotes := s.ShowNotes
@@ -160,9 +362,170 @@ func (p *Podcasts) notesWithLinks(s siteAPIResp) (res []noteWithLink) {
 	return res
 }
 
+// episode responds on show!, last! and random! commands
+func (p *Podcasts) episode(text string) (response Response, ok bool) {
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		return Response{}, false
+	}
+
+	var num int
+	switch strings.ToLower(fields[0]) {
+	case "show!":
+		if len(fields) != 2 {
+			return Response{Text: "номер выпуска? например: show! 800", Send: true}, true
+		}
+		n, err := strconv.Atoi(strings.TrimPrefix(fields[1], "#"))
+		if err != nil || n <= 0 {
+			return Response{Text: "номер выпуска? например: show! 800", Send: true}, true
+		}
+		num = n
+	case "last!":
+		if len(fields) != 1 {
+			return Response{}, false
+		}
+	case "random!":
+		if len(fields) != 1 {
+			return Response{}, false
+		}
+		last, err := p.lastEpisode()
+		if err != nil || last.ShowNum <= 1 {
+			log.Printf("[WARN] can't get the last episode, %v", err)
+			return Response{}, true
+		}
+		num = 1 + rand.Intn(last.ShowNum-1) //nolint:gosec
+	default:
+		return Response{}, false
+	}
+
+	var post siteAPIResp
+	var err error
+	if num == 0 {
+		post, err = p.lastEpisode()
+	} else {
+		post, err = p.showEpisode(num)
+	}
+	if err == errNoEpisode {
+		return Response{Text: fmt.Sprintf("выпуск %d не найден", num), Send: true}, true
+	}
+	if err != nil {
+		log.Printf("[WARN] can't get episode, %v", err)
+		return Response{}, true
+	}
+	return Response{Text: episodeText(post, maxEpisodeTopics), Send: true, Preview: true}, true
+}
+
+var errNoEpisode = errors.New("no such episode")
+
+// showEpisode gets the episode by number, via cache
+func (p *Podcasts) showEpisode(num int) (siteAPIResp, error) {
+	res, err := p.cache.Get(fmt.Sprintf("show:%d", num), func() (interface{}, error) {
+		post := siteAPIResp{}
+		err := p.siteAPIGet(fmt.Sprintf("%s/podcast/%d", p.siteAPI, num), &post)
+		if err == nil && post.URL == "" {
+			return nil, errNoEpisode
+		}
+		return post, err
+	})
+	if err != nil {
+		return siteAPIResp{}, err
+	}
+	return res.(siteAPIResp), nil
+}
+
+// lastEpisode gets the newest episode, via cache
+func (p *Podcasts) lastEpisode() (siteAPIResp, error) {
+	res, err := p.cache.Get("last", func() (interface{}, error) {
+		posts := []siteAPIResp{}
+		if err := p.siteAPIGet(fmt.Sprintf("%s/last/1?categories=podcast", p.siteAPI), &posts); err != nil {
+			return nil, err
+		}
+		if len(posts) == 0 {
+			return nil, errNoEpisode
+		}
+		return posts[0], nil
+	})
+	if err != nil {
+		return siteAPIResp{}, err
+	}
+	return res.(siteAPIResp), nil
+}
+
+// siteAPIGet requests site api and decodes json response to v, not found status is errNoEpisode
+func (p *Podcasts) siteAPIGet(reqURL string, v interface{}) error {
+	req, err := http.NewRequest("GET", reqURL, nil)
+	if err != nil {
+		return errors.Wrapf(err, "failed to make request %s", reqURL)
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return errors.Wrapf(err, "failed to send request %s", reqURL)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return errNoEpisode
+	}
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("request %s returned %s", reqURL, resp.Status)
+	}
+	return errors.Wrapf(json.NewDecoder(resp.Body).Decode(v), "failed to parse response from %s", reqURL)
+}
+
+// episodeText makes markdown message about the episode, with cover image shown as the link preview.
+// Show notes limited to maxTopics and shortened
+func episodeText(post siteAPIResp, maxTopics int) string {
+	res := ""
+	if post.Image != "" {
+		res += fmt.Sprintf("[​](%s)", post.Image)
+	}
+	res += fmt.Sprintf("🎙 *%s*", EscapeMarkDown(post.Title))
+	if post.ShowNum > 0 && !strings.Contains(post.Title, strconv.Itoa(post.ShowNum)) {
+		res += fmt.Sprintf(" #%d", post.ShowNum)
+	}
+	if !post.Date.IsZero() {
+		res += fmt.Sprintf(" _%s_", post.Date.Format("02 Jan 06"))
+	}
+	res += fmt.Sprintf(" - [на сайте](%s)\n", post.URL)
+
+	topics := 0
+	for _, nl := range notesWithLinks(post) {
+		if strings.TrimSpace(nl.text) == "" {
+			continue
+		}
+		if topics >= maxTopics {
+			res += "…\n"
+			break
+		}
+		topics++
+		note := shorten(nl.text, 100)
+		if nl.link != "" {
+			note = fmt.Sprintf("[%s](%s)", strings.NewReplacer("[", "", "]", "").Replace(note), nl.link)
+		} else {
+			note = EscapeMarkDown(note)
+		}
+		res += "● " + note + "\n"
+	}
+
+	if audio := audioURL(post); audio != "" {
+		res += fmt.Sprintf("[слушать](%s)", audio)
+	}
+	return strings.TrimSuffix(res, "\n")
+}
+
+// audioURL returns audio link of the episode, made from the file name if api has no audio url
+func audioURL(post siteAPIResp) string {
+	if post.AudioURL != "" {
+		return post.AudioURL
+	}
+	if post.FileName != "" {
+		return "https://cdn.radio-t.com/" + strings.TrimSuffix(post.FileName, ".mp3") + ".mp3"
+	}
+	return ""
+}
+
 func (p *Podcasts) request(text string) (react bool, reqText string) {
 
-	for _, prefix := range p.ReactOn() {
+	for _, prefix := range searchCommands {
 		if strings.HasPrefix(text, prefix) {
 			return true, strings.Replace(strings.TrimSpace(strings.TrimPrefix(text, prefix)), " ", "+", -1)
 		}
@@ -172,5 +535,5 @@ func (p *Podcasts) request(text string) (react bool, reqText string) {
 
 // ReactOn keys
 func (p *Podcasts) ReactOn() []string {
-	return []string{"search!", "подкаст!"}
+	return append(append([]string{}, searchCommands...), "show!", "last!", "random!")
 }
@@ -1,14 +1,24 @@
 package bot
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/radio-t/super-bot/app/bot/mocks"
+	"github.com/radio-t/super-bot/app/search"
 )
 
 func TestPodcastBotReturnsOnlyTopicsWithSearchedNotes(t *testing.T) {
@@ -29,7 +39,7 @@ func TestPodcastBotReturnsOnlyTopicsWithSearchedNotes(t *testing.T) {
 	defer ts.Close()
 
 	client := http.Client{Timeout: time.Second}
-	d := NewPodcasts(&client, ts.URL, 5)
+	d := NewPodcasts(&client, ts.URL, 5, nil)
 
 	resp := d.OnMessage(Message{Text: "search! Lambda"})
 	require.Equal(t, `[Радио-Т #0](http://example.com) _01 Jan 01_
@@ -61,7 +71,7 @@ func TestPodcasts_OnMessage(t *testing.T) {
 	defer ts.Close()
 
 	client := http.Client{Timeout: time.Second}
-	d := NewPodcasts(&client, ts.URL, 5)
+	d := NewPodcasts(&client, ts.URL, 5, nil)
 
 	require.Equal(
 		t,
@@ -100,7 +110,7 @@ func TestPodcasts_OnMessageWithLinks(t *testing.T) {
 	defer ts.Close()
 
 	client := http.Client{Timeout: time.Second}
-	d := NewPodcasts(&client, ts.URL, 5)
+	d := NewPodcasts(&client, ts.URL, 5, nil)
 
 	require.Equal(
 		t,
@@ -115,7 +125,7 @@ func TestPodcasts_OnMessageWithLinks(t *testing.T) {
 
 func TestPodcasts_OnMessageIgnore(t *testing.T) {
 
-	d := NewPodcasts(&http.Client{}, "http://example.com", 5)
+	d := NewPodcasts(&http.Client{}, "http://example.com", 5, nil)
 
 	response := d.OnMessage(Message{Text: "/xyz something"})
 	require.False(t, response.Send)
@@ -128,7 +138,7 @@ func TestPodcasts_OnMessageFailed(t *testing.T) {
 	defer ts.Close()
 
 	client := http.Client{Timeout: time.Second}
-	d := NewPodcasts(&client, ts.URL, 5)
+	d := NewPodcasts(&client, ts.URL, 5, nil)
 
 	require.Equal(t, Response{}, d.OnMessage(Message{Text: "/search something"}))
 }
@@ -142,8 +152,7 @@ func TestPodcasts_notesWithLinks(t *testing.T) {
 		Body:      "<p><img src=\"https://radio-t.com/images/radio-t/rt503.jpg\" alt=\"\" /></p>\n\n<ul>\n<li><a href=\"https://www.mongodb.com/cloud\">Mongo в облаке — чем это хорошо</a>.</li>\n<li><a href=\"http://arstechnica.com/information-technology/2016/07/the-wrt54gl-a-54mbps-router-from-2005-still-makes-millions-for-linksys/\">WRT54GL Linksys живее всех</a>.</li>\n<li><a href=\"https://code.visualstudio.com/updates\">VSCode поддался</a>.</li>\n<li><a href=\"http://venturebeat.com/2016/07/06/mozilla-is-building-context-graph-a-recommender-system-for-the-web/\">Mozilla строит свой Context Graph</a>.</li>\n<li><a href=\"http://www.businessinsider.com/cymettria-cyber-deception-2016-7\">Военное искуство для борьбы с хакерами</a>.</li>\n<li><a href=\"https://medium.com/@0x1AD2/atom-treasures-82a64ac391c\">Вдруг — Atom плагины</a>.</li>\n<li><a href=\"http://qz.com/726338/the-code-that-took-america-to-the-moon-was-just-published-to-github-and-its-like-a-1960s-time-capsule/\">Лунный код открыт</a>.</li>\n<li>Темы наших слушателей</li>\n</ul>\n\n<p><em>Спонсор этого выпуска <a href=\"https://www.digitalocean.com\">DigitalOcean</a></em></p>\n\n<p><a href=\"https://cdn.radio-t.com/rt_podcast503.mp3\">аудио</a> • <a href=\"http://chat.radio-t.com/logs/radio-t-503.html\">лог чата</a>\n<audio src=\"https://cdn.radio-t.com/rt_podcast503.mp3\" preload=\"none\"></audio></p>\n",
 	}
 
-	p := Podcasts{}
-	r := p.notesWithLinks(s)
+	r := notesWithLinks(s)
 
 	exp := []noteWithLink{
 		{text: "Mongo в облаке — чем это хорошо.", link: "https://www.mongodb.com/cloud"},
@@ -166,8 +175,7 @@ func TestPodcasts_notesWithLinks2(t *testing.T) {
 		Body:      "<p><img src=\"https://radio-t.com/images/radio-t/rt271.jpg\" alt=\"\" /></p>\n\n<ul>\n<li>Почему <a href=\"http://37signals.com/svn/posts/3071-why-we-dont-hire-programmers-based-on-puzzles-api-quizzes-math-riddles-or-other-parlor-trick\">квесты</a> не помогают</li>\n<li>Как сделать <a href=\"http://java.dzone.com/articles/how-make-your-cv-not-suck\">резюме</a> менее гадким</li>\n<li>SLB от Bobuk</li>\n<li>SLB от Umputun</li>\n<li>Какой длины строка еще работает</li>\n<li>Проблемы и решения mongo <a href=\"http://blog.pythonisito.com/2011/12/mongodbs-write-lock.html\">лока</a></li>\n<li>Темы наших слушателей</li>\n</ul>\n\n<p><a href=\"https://cdn.radio-t.com/rt_podcast271.mp3\">аудио</a> • <a href=\"https://cdn.radio-t.com/torrents/rt_podcast271.mp3.torrent\">radio-t.torrent</a> • <a href=\"http://chat.radio-t.com/logs/radio-t-271.html\">лог чата</a><audio src=\"https://cdn.radio-t.com/rt_podcast271.mp3\" preload=\"none\"></audio></p>\n",
 	}
 
-	p := Podcasts{}
-	r := p.notesWithLinks(s)
+	r := notesWithLinks(s)
 
 	exp := []noteWithLink{
 		{text: "Почему квесты не помогают", link: "http://37signals.com/svn/posts/3071-why-we-dont-hire-programmers-based-on-puzzles-api-quizzes-math-riddles-or-other-parlor-trick"},
@@ -179,3 +187,203 @@ func TestPodcasts_notesWithLinks2(t *testing.T) {
 	}
 	assert.Equal(t, exp, r)
 }
+
+func TestPodcasts_Episodes(t *testing.T) {
+	var requests []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.String())
+		post := siteAPIResp{URL: "https://radio-t.com/p/2022/05/14/podcast-800/", Title: "Радио-Т 800", ShowNum: 800,
+			Date: time.Date(2022, 5, 14, 23, 0, 0, 0, time.UTC), FileName: "rt_podcast800",
+			ShowNotes: "Go 1.18\nDocker\nТемы наших слушателей\n"}
+		switch r.URL.Path {
+		case "/podcast/800":
+			require.NoError(t, json.NewEncoder(w).Encode(post))
+		case "/last/1":
+			assert.Equal(t, "categories=podcast", r.URL.RawQuery)
+			post.ShowNum, post.Title, post.URL = 801, "Радио-Т 801", "https://radio-t.com/p/2022/05/21/podcast-801/"
+			require.NoError(t, json.NewEncoder(w).Encode([]siteAPIResp{post}))
+		case "/podcast/9999":
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			if strings.HasPrefix(r.URL.Path, "/podcast/") {
+				require.NoError(t, json.NewEncoder(w).Encode(post))
+				return
+			}
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	d := NewPodcasts(&http.Client{Timeout: time.Second}, ts.URL, 5, nil)
+
+	tbl := []struct {
+		text string
+		resp Response
+	}{
+		{"show! 800", Response{Text: "🎙 *Радио-Т 800* _14 May 22_ - [на сайте](https://radio-t.com/p/2022/05/14/podcast-800/)\n" +
+			"● Go 1.18\n● Docker\n[слушать](https://cdn.radio-t.com/rt_podcast800.mp3)", Send: true, Preview: true}},
+		{"show! #800", Response{Text: "🎙 *Радио-Т 800* _14 May 22_ - [на сайте](https://radio-t.com/p/2022/05/14/podcast-800/)\n" +
+			"● Go 1.18\n● Docker\n[слушать](https://cdn.radio-t.com/rt_podcast800.mp3)", Send: true, Preview: true}},
+		{"show! 9999", Response{Text: "выпуск 9999 не найден", Send: true}},
+		{"show! abc", Response{Text: "номер выпуска? например: show! 800", Send: true}},
+		{"last!", Response{Text: "🎙 *Радио-Т 801* _14 May 22_ - [на сайте](https://radio-t.com/p/2022/05/21/podcast-801/)\n" +
+			"● Go 1.18\n● Docker\n[слушать](https://cdn.radio-t.com/rt_podcast800.mp3)", Send: true, Preview: true}},
+		{"last! something", Response{}},
+		{"эфир?", Response{}},
+	}
+
+	for i, tt := range tbl {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			assert.Equal(t, tt.resp, d.OnMessage(Message{Text: tt.text}))
+		})
+	}
+	assert.Equal(t, []string{"/podcast/800", "/podcast/9999", "/last/1?categories=podcast"}, requests, "cached")
+
+	resp := d.OnMessage(Message{Text: "random!"})
+	assert.True(t, resp.Send)
+	assert.Contains(t, resp.Text, "🎙 *Радио-Т")
+}
+
+func TestPodcasts_SyncNotes(t *testing.T) {
+	siteDown := false
+	var requests []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.String())
+		if siteDown || r.URL.Path == "/search" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		posts := []siteAPIResp{
+			{URL: "https://radio-t.com/p/801/", ShowNum: 801, Date: time.Date(2022, 5, 21, 23, 0, 0, 0, time.UTC),
+				ShowNotes: "Новые контейнеры в Kubernetes\nТемы наших слушателей",
+				Body:      `<li><a href="https://kubernetes.io/blog/">Новые контейнеры</a></li>`},
+			{URL: "https://radio-t.com/p/800/", ShowNum: 800, Date: time.Date(2022, 5, 14, 23, 0, 0, 0, time.UTC),
+				ShowNotes: "Docker и контейнер для всех\nПро Go",
+				Body:      `<li><a href="https://docker.com">Docker</a></li><li><a href="https://golang.org">Go</a></li>`},
+			{Title: "no show number"},
+		}
+		require.NoError(t, json.NewEncoder(w).Encode(posts))
+	}))
+	defer ts.Close()
+
+	tmp, err := ioutil.TempDir("", "notes")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmp)
+	storeFile := filepath.Join(tmp, "episodes.json")
+
+	d := NewPodcasts(&http.Client{Timeout: time.Second}, ts.URL, 5, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		d.SyncNotes(ctx, storeFile, time.Hour)
+		close(done)
+	}()
+	require.Eventually(t, func() bool { _, err := os.Stat(storeFile); return err == nil }, time.Second, 10*time.Millisecond)
+	cancel()
+	<-done
+	assert.Equal(t, []string{"/last/10000?categories=podcast"}, requests, "all episodes on the first sync")
+
+	tbl := []struct {
+		text string
+		resp string
+	}{
+		{"search! контейнерами", "[Радио-Т #801](https://radio-t.com/p/801/) _21 May 22_\n" +
+			"●  [Новые контейнеры в Kubernetes](https://kubernetes.io/blog/)\n\n" +
+			"[Радио-Т #800](https://radio-t.com/p/800/) _14 May 22_\n●  [Docker и контейнер для всех](https://docker.com)\n\n"},
+		{"search! kubernets", "[Радио-Т #801](https://radio-t.com/p/801/) _21 May 22_\n" +
+			"●  [Новые контейнеры в Kubernetes](https://kubernetes.io/blog/)\n\n"},
+		{"search! golang", "[Радио-Т #800](https://radio-t.com/p/800/) _14 May 22_\n○  [Про Go](https://golang.org)\n\n"},
+		{"search! слушатели", `ничего не нашел на запрос "слушатели"`},
+		{"search! docker lambda", `ничего не нашел на запрос "docker lambda"`},
+	}
+	for i, tt := range tbl {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			assert.Equal(t, Response{Text: tt.resp, Send: true}, d.OnMessage(Message{Text: tt.text}))
+		})
+	}
+
+	// restarted with the site down, search works from the saved episodes
+	siteDown = true
+	requests = nil
+	d = NewPodcasts(&http.Client{Timeout: time.Second}, ts.URL, 5, nil)
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	d.SyncNotes(ctx, storeFile, time.Hour)
+	assert.Equal(t, []string{"/last/10?categories=podcast"}, requests, "recent episodes only")
+	resp := d.OnMessage(Message{Text: "search! Docker"})
+	assert.Equal(t, "[Радио-Т #800](https://radio-t.com/p/800/) _14 May 22_\n●  [Docker и контейнер для всех](https://docker.com)\n\n",
+		resp.Text)
+}
+
+func TestPodcasts_SearchPages(t *testing.T) {
+	su := &mocks.SuperUser{}
+	su.On("IsSuper", "admin").Return(true)
+	su.On("IsSuper", "other").Return(false)
+
+	d := NewPodcasts(&http.Client{}, "http://example.com", 2, su)
+	for i := 1; i <= 5; i++ {
+		d.notes.Add(search.Episode{Num: i, URL: fmt.Sprintf("https://radio-t.com/p/%d/", i),
+			Date: time.Date(2022, 5, i, 0, 0, 0, 0, time.UTC), Notes: []search.Note{{Text: "Новости Go"}}})
+	}
+	d.notes.Add(search.Episode{Num: 6, URL: "https://radio-t.com/p/6/", Notes: []search.Note{{Text: "Rust"}}})
+	user := User{ID: 1, Username: "user"}
+
+	resp := d.OnMessage(Message{ID: 10, ChatID: 123, From: user, Text: "search! go"})
+	assert.Equal(t, Response{Text: "[Радио-Т #5](https://radio-t.com/p/5/) _05 May 22_\n●  Новости Go\n\n" +
+		"[Радио-Т #4](https://radio-t.com/p/4/) _04 May 22_\n●  Новости Go\n\n_страница 1 из 3_", Send: true,
+		Buttons: []Button{{Text: "▶", Data: "search:10:1"}}}, resp)
+
+	resp, answer := d.OnCallback(Callback{Data: "search:10:1", From: user, ChatID: 123, MsgID: 11})
+	assert.Equal(t, "", answer)
+	assert.Equal(t, Response{Text: "[Радио-Т #3](https://radio-t.com/p/3/) _03 May 22_\n●  Новости Go\n\n" +
+		"[Радио-Т #2](https://radio-t.com/p/2/) _02 May 22_\n●  Новости Go\n\n_страница 2 из 3_", Send: true,
+		Buttons: []Button{{Text: "◀", Data: "search:10:0"}, {Text: "▶", Data: "search:10:2"}}}, resp)
+
+	resp, _ = d.OnCallback(Callback{Data: "search:10:2", From: User{ID: 2, Username: "admin"}, ChatID: 123, MsgID: 11})
+	assert.Equal(t, Response{Text: "[Радио-Т #1](https://radio-t.com/p/1/) _01 May 22_\n●  Новости Go\n\n" +
+		"_страница 3 из 3_", Send: true, Buttons: []Button{{Text: "◀", Data: "search:10:1"}}}, resp, "super-user can page")
+
+	resp, answer = d.OnCallback(Callback{Data: "search:10:0", From: User{ID: 3, Username: "other"}, ChatID: 123, MsgID: 11})
+	assert.Equal(t, Response{}, resp)
+	assert.Equal(t, "листать может только автор запроса", answer)
+
+	resp, answer = d.OnCallback(Callback{Data: "search:10:5", From: user, ChatID: 123, MsgID: 11})
+	assert.Equal(t, Response{}, resp, "no such page")
+	assert.Equal(t, "", answer)
+
+	resp, answer = d.OnCallback(Callback{Data: "search:10:0", From: user, ChatID: 456, MsgID: 11})
+	assert.Equal(t, Response{}, resp, "other chat")
+	assert.Equal(t, "результаты устарели, повтори поиск", answer)
+
+	// single page without buttons
+	resp = d.OnMessage(Message{ID: 12, ChatID: 123, From: user, Text: "search! rust"})
+	assert.Equal(t, Response{Text: "[Радио-Т #6](https://radio-t.com/p/6/) _01 Jan 01_\n●  Rust\n\n", Send: true}, resp)
+
+	// expired
+	d.lock.Lock()
+	sp := d.pages["123:10"]
+	sp.created = time.Now().Add(-searchPagesTTL - time.Minute)
+	d.pages["123:10"] = sp
+	d.lock.Unlock()
+	resp, answer = d.OnCallback(Callback{Data: "search:10:1", From: user, ChatID: 123, MsgID: 11})
+	assert.Equal(t, Response{}, resp)
+	assert.Equal(t, "результаты устарели, повтори поиск", answer)
+	assert.Empty(t, d.pages)
+}
+
+func TestPodcasts_episodeText(t *testing.T) {
+	notes := ""
+	for i := 0; i < 12; i++ {
+		notes += fmt.Sprintf("тема %d %s\n", i, strings.Repeat("очень ", 30))
+	}
+	post := siteAPIResp{URL: "https://radio-t.com/p/2022/05/14/podcast-800/", Title: "Выпуск_1", ShowNum: 800,
+		Image: "https://radio-t.com/images/rt800.jpg", AudioURL: "https://cdn.radio-t.com/rt_podcast800.mp3", ShowNotes: notes}
+	text := episodeText(post, 3)
+	lines := strings.Split(text, "\n")
+	require.Equal(t, 6, len(lines))
+	assert.Equal(t, "[​](https://radio-t.com/images/rt800.jpg)🎙 *Выпуск\\_1* #800 - [на сайте](https://radio-t.com/p/2022/05/14/podcast-800/)", lines[0])
+	assert.Equal(t, 103, len([]rune(lines[1])), "shortened")
+	assert.True(t, strings.HasSuffix(lines[1], "…"))
+	assert.Equal(t, "…", lines[4])
+	assert.Equal(t, "[слушать](https://cdn.radio-t.com/rt_podcast800.mp3)", lines[5])
+}
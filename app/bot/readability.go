@@ -0,0 +1,387 @@
+package bot
+
+import (
+	"html"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// article is a content of the page extracted for excerpt
+type article struct {
+	Title       string
+	Description string
+	Text        string // main text, paragraphs separated by \n
+}
+
+var (
+	reCharset  = regexp.MustCompile(`(?i)charset\s*=\s*["']?([\w-]+)`)
+	reUnlikely = regexp.MustCompile(`(?i)comment|footer|sidebar|menu|nav|share|social|promo|banner|related|subscribe|cookie|popup|breadcrumb`)
+	reLikely   = regexp.MustCompile(`(?i)article|content|post|entry|story|text|body|main`)
+)
+
+// cp1251 maps bytes 0x80-0xFF of windows-1251 to runes
+var cp1251 = []rune("ЂЃ‚ѓ„…†‡€‰Љ‹ЊЌЋЏђ‘’“”•–—\ufffd™љ›њќћџ\u00a0ЎўЈ¤Ґ¦§Ё©Є«¬\u00ad®Ї°±Ііґµ¶·ё№є»јЅѕї" +
+	"АБВГДЕЖЗИЙКЛМНОПРСТУФХЦЧШЩЪЫЬЭЮЯабвгдежзийклмнопрстуфхцчшщъыьэюя")
+
+// decodePage converts the page to utf-8. Charset taken from content type or meta tag,
+// windows-1251 decoded, anything else treated as utf-8
+func decodePage(page []byte, contentType string) string {
+	charset := ""
+	if m := reCharset.FindStringSubmatch(contentType); m != nil {
+		charset = m[1]
+	} else {
+		head := page
+		if len(head) > 2048 {
+			head = head[:2048]
+		}
+		if m := reCharset.FindSubmatch(head); m != nil {
+			charset = string(m[1])
+		}
+	}
+
+	switch strings.ToLower(charset) {
+	case "windows-1251", "cp1251", "x-cp1251":
+		res := make([]rune, len(page))
+		for i, b := range page {
+			if b < 0x80 {
+				res[i] = rune(b)
+				continue
+			}
+			res[i] = cp1251[b-0x80]
+		}
+		return string(res)
+	}
+	if utf8.Valid(page) {
+		return string(page)
+	}
+	return strings.ToValidUTF8(string(page), "")
+}
+
+// extractArticle gets title, description and the main text of html page. Title and description taken
+// from OpenGraph, twitter and html meta tags. The main text is the biggest group of paragraphs with the same parent,
+// paragraphs in navigation, comments and similar blocks ignored
+func extractArticle(page string) article {
+	type element struct {
+		name     string
+		id       int
+		unlikely bool
+	}
+	var (
+		res             article
+		meta            = map[string]string{}
+		stack           []element
+		title, h1, para strings.Builder
+		inTitle, inH1   bool
+		paraParent      = -1
+		nextID          int
+		scores          = map[int]float64{}
+		texts           = map[int][]string{}
+	)
+
+	unlikely := func() bool {
+		for _, e := range stack {
+			if e.unlikely {
+				return true
+			}
+		}
+		return false
+	}
+	endPara := func() {
+		text := strings.Join(strings.Fields(para.String()), " ")
+		para.Reset()
+		if paraParent < 0 || utf8.RuneCountInString(text) < 25 {
+			paraParent = -1
+			return
+		}
+		scores[paraParent] += 1 + float64(strings.Count(text, ",")) + minFloat(float64(len([]rune(text)))/100, 3)
+		texts[paraParent] = append(texts[paraParent], text)
+		paraParent = -1
+	}
+	pop := func(name string) {
+		for i := len(stack) - 1; i >= 0; i-- {
+			if stack[i].name != name {
+				continue
+			}
+			for _, e := range stack[i:] {
+				switch e.name {
+				case "p":
+					endPara()
+				case "title":
+					inTitle = false
+				case "h1":
+					inH1 = false
+				}
+			}
+			stack = stack[:i]
+			return
+		}
+	}
+
+	tokenizeHTML(page, func(t htmlToken) {
+		switch t.kind {
+		case htmlText:
+			switch {
+			case inTitle:
+				title.WriteString(t.text)
+			case paraParent >= 0:
+				para.WriteString(t.text)
+			}
+			if inH1 && h1.Len() < 500 {
+				h1.WriteString(t.text)
+			}
+		case htmlStart:
+			switch t.name {
+			case "meta":
+				key := strings.ToLower(t.attrs["property"])
+				if key == "" {
+					key = strings.ToLower(t.attrs["name"])
+				}
+				if key != "" && meta[key] == "" {
+					meta[key] = strings.TrimSpace(t.attrs["content"])
+				}
+				return
+			case "br":
+				if paraParent >= 0 {
+					para.WriteString(" ")
+				}
+				return
+			case "img", "link", "input", "hr", "source", "wbr", "area", "base", "col", "embed", "param", "track":
+				return
+			}
+			if t.selfClosing {
+				return
+			}
+			if isBlockTag(t.name) && len(stack) > 0 && stack[len(stack)-1].name == "p" {
+				pop("p") // html closes paragraph on the next block
+			}
+			e := element{name: t.name, id: nextID}
+			nextID++
+			switch t.name {
+			case "nav", "header", "footer", "aside", "form", "figure", "button", "select":
+				e.unlikely = true
+			default:
+				classID := t.attrs["class"] + " " + t.attrs["id"]
+				e.unlikely = reUnlikely.MatchString(classID) && !reLikely.MatchString(classID)
+			}
+			switch t.name {
+			case "title":
+				inTitle = title.Len() == 0
+			case "h1":
+				inH1 = h1.Len() == 0 && !unlikely()
+			case "p":
+				if len(stack) > 0 && !unlikely() && !e.unlikely {
+					paraParent = stack[len(stack)-1].id
+				}
+			}
+			stack = append(stack, e)
+		case htmlEnd:
+			pop(t.name)
+		}
+	})
+	endPara()
+
+	res.Title = firstNonEmpty(meta["og:title"], meta["twitter:title"], title.String(), h1.String())
+	res.Description = firstNonEmpty(meta["og:description"], meta["twitter:description"], meta["description"])
+	best, bestScore := -1, 0.0
+	for id, score := range scores {
+		if score > bestScore || (score == bestScore && id < best) {
+			best, bestScore = id, score
+		}
+	}
+	if best >= 0 {
+		res.Text = strings.Join(texts[best], "\n")
+	}
+	return res
+}
+
+// isBlockTag checks if the tag closes open paragraph
+func isBlockTag(name string) bool {
+	switch name {
+	case "p", "div", "ul", "ol", "table", "section", "article", "blockquote", "pre", "h1", "h2", "h3", "h4", "h5", "h6",
+		"header", "footer", "nav", "aside", "form", "figure", "hr", "main", "dl":
+		return true
+	}
+	return false
+}
+
+// firstNonEmpty returns the first non-empty value with collapsed spaces
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v = strings.Join(strings.Fields(v), " "); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func minFloat(a, b float64) float64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+const (
+	htmlText = iota
+	htmlStart
+	htmlEnd
+)
+
+// htmlToken is a piece of html page, text is unescaped
+type htmlToken struct {
+	kind        int
+	name        string // lower case tag name
+	attrs       map[string]string
+	selfClosing bool
+	text        string
+}
+
+// tokenizeHTML is a tolerant html tokenizer, calls fn for each text, start and end tag.
+// Comments, doctype and content of script, style and similar elements skipped
+func tokenizeHTML(s string, fn func(t htmlToken)) {
+	for i := 0; i < len(s); {
+		lt := strings.IndexByte(s[i:], '<')
+		if lt < 0 {
+			fn(htmlToken{kind: htmlText, text: html.UnescapeString(s[i:])})
+			return
+		}
+		if lt > 0 {
+			fn(htmlToken{kind: htmlText, text: html.UnescapeString(s[i : i+lt])})
+		}
+		i += lt
+		rest := s[i:]
+
+		switch {
+		case strings.HasPrefix(rest, "<!--"):
+			end := strings.Index(rest[4:], "-->")
+			if end < 0 {
+				return
+			}
+			i += 4 + end + 3
+		case strings.HasPrefix(rest, "<!") || strings.HasPrefix(rest, "<?"):
+			end := strings.IndexByte(rest, '>')
+			if end < 0 {
+				return
+			}
+			i += end + 1
+		case strings.HasPrefix(rest, "</"):
+			end := strings.IndexByte(rest, '>')
+			if end < 0 {
+				return
+			}
+			if name := strings.Fields(rest[2:end]); len(name) > 0 {
+				fn(htmlToken{kind: htmlEnd, name: strings.ToLower(name[0])})
+			}
+			i += end + 1
+		case len(rest) > 1 && isASCIILetter(rest[1]):
+			t, size := parseTag(rest)
+			fn(t)
+			i += size
+			switch t.name {
+			case "script", "style", "noscript", "template", "textarea", "svg":
+				if t.selfClosing {
+					continue
+				}
+				end := indexEndTag(s[i:], t.name)
+				if end < 0 {
+					return
+				}
+				i += end
+			}
+		default:
+			fn(htmlToken{kind: htmlText, text: "<"})
+			i++
+		}
+	}
+}
+
+// indexEndTag returns position of the end tag with the name, case insensitive, or -1
+func indexEndTag(s, name string) int {
+	for i := 0; ; {
+		pos := strings.Index(s[i:], "</")
+		if pos < 0 {
+			return -1
+		}
+		i += pos
+		if end := i + 2 + len(name); end <= len(s) && strings.EqualFold(s[i+2:end], name) {
+			return i
+		}
+		i += 2
+	}
+}
+
+// parseTag parses start tag at the beginning of s, returns the token and its size
+func parseTag(s string) (t htmlToken, size int) {
+	t = htmlToken{kind: htmlStart, attrs: map[string]string{}}
+	j := 1
+	for j < len(s) && !isTagSpace(s[j]) && s[j] != '>' && s[j] != '/' {
+		j++
+	}
+	t.name = strings.ToLower(s[1:j])
+
+	for j < len(s) {
+		for j < len(s) && isTagSpace(s[j]) {
+			j++
+		}
+		if j >= len(s) {
+			break
+		}
+		switch s[j] {
+		case '>':
+			return t, j + 1
+		case '/':
+			t.selfClosing = j+1 < len(s) && s[j+1] == '>'
+			j++
+			continue
+		}
+
+		start := j
+		for j < len(s) && !isTagSpace(s[j]) && s[j] != '=' && s[j] != '>' && s[j] != '/' {
+			j++
+		}
+		key := strings.ToLower(s[start:j])
+		if key == "" {
+			j++
+			continue
+		}
+		for j < len(s) && isTagSpace(s[j]) {
+			j++
+		}
+		val := ""
+		if j < len(s) && s[j] == '=' {
+			j++
+			for j < len(s) && isTagSpace(s[j]) {
+				j++
+			}
+			if j < len(s) && (s[j] == '"' || s[j] == '\'') {
+				quote := s[j]
+				end := strings.IndexByte(s[j+1:], quote)
+				if end < 0 {
+					return t, len(s)
+				}
+				val = s[j+1 : j+1+end]
+				j += end + 2
+			} else {
+				start = j
+				for j < len(s) && !isTagSpace(s[j]) && s[j] != '>' {
+					j++
+				}
+				val = s[start:j]
+			}
+		}
+		if _, ok := t.attrs[key]; !ok {
+			t.attrs[key] = html.UnescapeString(val)
+		}
+	}
+	return t, len(s)
+}
+
+func isTagSpace(c byte) bool {
+	return c == ' ' || c == '\n' || c == '\t' || c == '\r' || c == '\f'
+}
+
+func isASCIILetter(c byte) bool {
+	return c < utf8.RuneSelf && unicode.IsLetter(rune(c))
+}
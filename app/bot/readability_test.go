@@ -0,0 +1,77 @@
+package bot
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExtractArticle(t *testing.T) {
+	tbl := []struct {
+		page string
+		res  article
+	}{
+		{`<html><head><meta name="twitter:title" content="Twitter title"><title>Page title</title>
+			<meta name="description" content="Meta description"></head><body><h1>Header</h1></body></html>`,
+			article{Title: "Twitter title", Description: "Meta description"}},
+		{`<!DOCTYPE html><html><head><title>
+				Page &amp; title
+			</title><script>var s = "<p>not a paragraph, but long enough to be counted</p>";</script>
+			<style>p { color: red; }</style></head>
+			<body><!-- <p>commented out paragraph, long enough to be counted</p> -->
+			<header class="site-header"><p>Header paragraph, long enough to be counted as text</p></header>
+			<article><h1>Article header</h1>
+				<p>First paragraph of the article,<br>with a line break and a <a href="/link">link</a>.
+				<p>Second paragraph without closing tag, also long enough
+				<div class="share-buttons"><p>Share on social networks, long enough to be counted</p></div>
+				<p>Third paragraph, with some commas, to have more score.</p>
+			</article>
+			<div class="sidebar"><p>Sidebar text, long enough to be counted, with, many, commas, here</p></div>
+			<footer><p>Footer paragraph, long enough to be counted as text</p></footer>
+			</body></html>`,
+			article{Title: "Page & title", Text: "First paragraph of the article, with a line break and a link.\n" +
+				"Second paragraph without closing tag, also long enough\n" +
+				"Third paragraph, with some commas, to have more score."}},
+		{`<body><h1 class=title>Only &quot;header&quot;</h1><div><p>short</p></div></body>`,
+			article{Title: `Only "header"`}},
+		{`<BODY><DIV ID=main><P>Upper case tags, unquoted attributes and entities &#8212; ok</P>` +
+			`<p data-x='a>b' hidden>Attribute with angle bracket in quotes, also fine</p></DIV>`,
+			article{Text: "Upper case tags, unquoted attributes and entities — ok\nAttribute with angle bracket in quotes, also fine"}},
+		{`<p>Broken page without closing tags, long enough to be counted <b`, article{}},
+		{`text < with less sign and no tags at all`, article{}},
+	}
+	for i, tt := range tbl {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			assert.Equal(t, tt.res, extractArticle(tt.page))
+		})
+	}
+}
+
+func TestTokenizeHTML(t *testing.T) {
+	var res []string
+	tokenizeHTML(`a<br/><img src="x.png" alt='1 > 0'><p class=x  hidden>b&lt;</P><script>if (a</b) {}</SCRIPT >c<`,
+		func(tok htmlToken) {
+			switch tok.kind {
+			case htmlText:
+				res = append(res, "text:"+tok.text)
+			case htmlStart:
+				res = append(res, "start:"+tok.name+":"+tok.attrs["class"]+tok.attrs["alt"]+":"+strconv.FormatBool(tok.selfClosing))
+			case htmlEnd:
+				res = append(res, "end:"+tok.name)
+			}
+		})
+	assert.Equal(t, []string{"text:a", "start:br::true", "start:img:1 > 0:false", "start:p:x:false", "text:b<", "end:p",
+		"start:script::false", "end:script", "text:c", "text:<"}, res)
+}
+
+func TestDecodePage(t *testing.T) {
+	cp := []byte{0xcf, 0xf0, 0xe8, 0xe2, 0xe5, 0xf2, 0x20, 0xa8, 0xb8} // "Привет Ёё" in windows-1251
+	assert.Equal(t, "Привет Ёё", decodePage(cp, "text/html; charset=windows-1251"))
+	page := append([]byte(`<meta charset="cp1251">`), cp...)
+	assert.Equal(t, `<meta charset="cp1251">Привет Ёё`, decodePage(page, "text/html"))
+	assert.Equal(t, "Привет", decodePage([]byte("Привет"), ""))
+	assert.Equal(t, " ", decodePage(cp[5:7], "text/html; charset=utf-8"), "invalid utf-8 dropped")
+	assert.True(t, strings.HasPrefix(decodePage([]byte("текст"), "text/html; charset=koi8-r"), "текст"), "unknown as utf-8")
+}
@@ -0,0 +1,355 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/radio-t/super-bot/app/storage"
+)
+
+// Reminders bot, pings user with a mention at the requested time.
+// Supports relative "remind! 30m text" and absolute "remind! сб 22:50 text" forms,
+// all absolute times are in Europe/Moscow zone. Reminders persisted to StoreFile.
+type Reminders struct {
+	ReminderParams
+	location *time.Location
+	store    *storage.JSONFile
+	now      func() time.Time
+
+	lock  sync.Mutex
+	state struct {
+		LastID int        `json:"last_id"`
+		Items  []reminder `json:"items"`
+	}
+}
+
+// ReminderParams defines parameters for Reminders bot
+type ReminderParams struct {
+	Submitter     Submitter     // push path for fired reminders
+	SuperUser     SuperUser     // super users allowed to cancel any reminder
+	StoreFile     string        // json file to keep reminders
+	MaxPerUser    int           // max number of active reminders per user
+	CheckInterval time.Duration // how often to check for due reminders
+}
+
+type reminder struct {
+	ID     int       `json:"id"`
+	ChatID int64     `json:"chat_id"`
+	User   User      `json:"user"`
+	At     time.Time `json:"at"`
+	Text   string    `json:"text"`
+}
+
+const maxRemindIn = 366 * Day // the most distant reminder
+
+var (
+	reRelative = regexp.MustCompile(`^(\d+)(s|sec|с|сек|m|min|м|мин|h|ч|d|д)$`)
+	reClock    = regexp.MustCompile(`^([01]?\d|2[0-3]):([0-5]\d)$`)
+	weekdays   = map[string]time.Weekday{
+		"вс": time.Sunday, "пн": time.Monday, "вт": time.Tuesday, "ср": time.Wednesday,
+		"чт": time.Thursday, "пт": time.Friday, "сб": time.Saturday,
+		"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+		"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+	}
+)
+
+// NewReminders makes Reminders bot, loads stored reminders and starts checker goroutine
+func NewReminders(ctx context.Context, params ReminderParams) (*Reminders, error) {
+	log.Printf("[INFO] reminders bot with %s, max per user %d", params.StoreFile, params.MaxPerUser)
+	location, err := time.LoadLocation("Europe/Moscow")
+	if err != nil {
+		return nil, errors.Wrap(err, "can't load location")
+	}
+
+	store, err := storage.NewJSONFile(params.StoreFile)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Reminders{ReminderParams: params, location: location, store: store, now: time.Now}
+	if err = store.Load(&r.state); err != nil {
+		return nil, errors.Wrap(err, "can't load reminders")
+	}
+	log.Printf("[DEBUG] loaded %d reminders", len(r.state.Items))
+
+	if r.CheckInterval == 0 {
+		r.CheckInterval = 10 * time.Second
+	}
+	go r.checker(ctx)
+	return r, nil
+}
+
+// Help returns help message
+func (r *Reminders) Help() string {
+	return genHelpMsg(r.ReactOn(), "напомнить, например: remind! 30m проверить звук, remind! сб 22:50 начать эфир. "+
+		"remind! list - мои напоминания, remind! cancel 12 - отменить")
+}
+
+// ReactOn keys
+func (r *Reminders) ReactOn() []string {
+	return []string{"remind!", "напомни!"}
+}
+
+// OnMessage adds, lists or cancels reminders
+func (r *Reminders) OnMessage(msg Message) (response Response) {
+	ok, args := r.request(msg.Text)
+	if !ok {
+		return Response{}
+	}
+
+	fields := strings.Fields(args)
+	switch {
+	case len(fields) == 0 || contains([]string{"list", "список"}, fields[0]):
+		return Response{Text: r.list(msg.From), Send: true}
+	case contains([]string{"cancel", "отмена"}, fields[0]) && len(fields) == 2:
+		return Response{Text: r.cancel(msg.From, fields[1]), Send: true}
+	}
+
+	at, text, err := r.parse(args)
+	if err != nil {
+		return Response{Text: fmt.Sprintf("не понял когда напомнить, %v", err), Send: true}
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.MaxPerUser > 0 && r.countFor(msg.From) >= r.MaxPerUser {
+		return Response{Text: fmt.Sprintf("слишком много напоминаний, не больше %d", r.MaxPerUser), Send: true}
+	}
+
+	r.state.LastID++
+	rm := reminder{ID: r.state.LastID, ChatID: msg.ChatID, User: msg.From, At: at, Text: text}
+	r.state.Items = append(r.state.Items, rm)
+	r.save()
+	log.Printf("[INFO] reminder %d for %v at %v added", rm.ID, msg.From, at)
+
+	return Response{
+		Text: fmt.Sprintf("напомню %s в %s (через %s), #%d", mention(msg.From), at.In(r.location).Format("02.01 15:04"),
+			HumanizeDuration(at.Sub(r.now()).Round(time.Second)), rm.ID),
+		Send: true,
+	}
+}
+
+// parse extracts reminder time and text from "30m text", "22:50 text", "сб 22:50 text" and "завтра 10:00 text"
+func (r *Reminders) parse(args string) (at time.Time, text string, err error) {
+	fields := strings.Fields(args)
+	if len(fields) < 2 {
+		return at, "", errors.New("нужно время и текст")
+	}
+
+	now := r.now().In(r.location)
+	first := strings.ToLower(fields[0])
+
+	if d, ok := parseRelative(first); ok {
+		if d > maxRemindIn {
+			return at, "", errors.Errorf("слишком далеко, не больше %s", HumanizeDuration(maxRemindIn))
+		}
+		return now.Add(d), strings.Join(fields[1:], " "), nil
+	}
+
+	if m := reClock.FindStringSubmatch(first); m != nil { // "22:50 text", today or tomorrow
+		at = clockAt(now, m)
+		if !at.After(now) {
+			at = at.AddDate(0, 0, 1)
+		}
+		return at, strings.Join(fields[1:], " "), nil
+	}
+
+	if len(fields) < 3 {
+		return at, "", errors.New("нужно время и текст")
+	}
+	m := reClock.FindStringSubmatch(fields[1])
+	if m == nil {
+		return at, "", errors.Errorf("неизвестное время %q", fields[1])
+	}
+	at = clockAt(now, m)
+
+	switch {
+	case contains([]string{"сегодня", "today"}, first):
+	case contains([]string{"завтра", "tomorrow"}, first):
+		at = at.AddDate(0, 0, 1)
+	default:
+		wd, found := weekdays[first]
+		if !found {
+			return at, "", errors.Errorf("неизвестный день %q", fields[0])
+		}
+		days := (int(wd) - int(now.Weekday()) + 7) % 7
+		at = at.AddDate(0, 0, days)
+		if !at.After(now) {
+			at = at.AddDate(0, 0, 7)
+		}
+	}
+
+	if !at.After(now) {
+		return at, "", errors.New("это время уже прошло")
+	}
+	return at, strings.Join(fields[2:], " "), nil
+}
+
+func (r *Reminders) list(user User) string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	var lines []string
+	for _, rm := range r.state.Items {
+		if rm.User.ID != user.ID {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("#%d %s - %s", rm.ID, rm.At.In(r.location).Format("02.01 15:04"),
+			EscapeMarkDown(rm.Text)))
+	}
+	if len(lines) == 0 {
+		return "напоминаний нет"
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (r *Reminders) cancel(user User, idStr string) string {
+	id, err := strconv.Atoi(strings.TrimPrefix(idStr, "#"))
+	if err != nil {
+		return fmt.Sprintf("неверный номер %q", idStr)
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	for i, rm := range r.state.Items {
+		if rm.ID != id {
+			continue
+		}
+		if rm.User.ID != user.ID && (r.SuperUser == nil || !r.SuperUser.IsSuper(user.Username)) {
+			return "можно отменить только свое напоминание"
+		}
+		r.state.Items = append(r.state.Items[:i], r.state.Items[i+1:]...)
+		r.save()
+		log.Printf("[INFO] reminder %d canceled by %v", id, user)
+		return fmt.Sprintf("напоминание #%d отменено", id)
+	}
+	return fmt.Sprintf("напоминание #%d не найдено", id)
+}
+
+func (r *Reminders) checker(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(r.CheckInterval):
+			r.fire(ctx)
+		}
+	}
+}
+
+// fire submits all due reminders and removes them from the list. Due reminders taken under lock
+// and submitted without it, failed ones returned to the list
+func (r *Reminders) fire(ctx context.Context) {
+	r.lock.Lock()
+	now := r.now()
+	var due, rest []reminder
+	for _, rm := range r.state.Items {
+		if rm.At.After(now) {
+			rest = append(rest, rm)
+			continue
+		}
+		due = append(due, rm)
+	}
+	r.state.Items = rest
+	r.lock.Unlock()
+	if len(due) == 0 {
+		return
+	}
+
+	sort.Slice(due, func(i, j int) bool { return due[i].At.Before(due[j].At) })
+	var failed []reminder
+	for _, rm := range due {
+		resp := Response{Text: fmt.Sprintf("%s напоминаю: %s", mention(rm.User), EscapeMarkDown(rm.Text)), Send: true}
+		if err := r.Submitter.SubmitTo(ctx, rm.ChatID, resp); err != nil {
+			log.Printf("[WARN] can't submit reminder %d, %v", rm.ID, err)
+			failed = append(failed, rm) // retry on the next check
+			continue
+		}
+		log.Printf("[INFO] reminder %d for %v fired", rm.ID, rm.User)
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.state.Items = append(r.state.Items, failed...)
+	r.save()
+}
+
+func (r *Reminders) countFor(user User) (count int) {
+	for _, rm := range r.state.Items {
+		if rm.User.ID == user.ID {
+			count++
+		}
+	}
+	return count
+}
+
+// save stores state, should be called under lock
+func (r *Reminders) save() {
+	if err := r.store.Save(r.state); err != nil {
+		log.Printf("[WARN] can't save reminders, %v", err)
+	}
+}
+
+func (r *Reminders) request(text string) (react bool, args string) {
+	for _, prefix := range r.ReactOn() {
+		if strings.HasPrefix(strings.ToLower(text), prefix) {
+			return true, strings.TrimSpace(text[len(prefix):])
+		}
+	}
+	return false, ""
+}
+
+// parseRelative parses "30m", "2ч", "1d" as well as go durations like "1h30m".
+// Durations beyond maxRemindIn returned as maxRemindIn+1 to avoid overflow
+func parseRelative(s string) (time.Duration, bool) {
+	if m := reRelative.FindStringSubmatch(s); m != nil {
+		n, err := strconv.ParseInt(m[1], 10, 64)
+		if (err != nil && !errors.Is(err, strconv.ErrRange)) || n == 0 {
+			return 0, false
+		}
+		unit := Day
+		switch m[2] {
+		case "s", "sec", "с", "сек":
+			unit = time.Second
+		case "m", "min", "м", "мин":
+			unit = time.Minute
+		case "h", "ч":
+			unit = time.Hour
+		}
+		if err != nil || n > int64(maxRemindIn/unit) {
+			return maxRemindIn + 1, true
+		}
+		return time.Duration(n) * unit, true
+	}
+	if d, err := time.ParseDuration(s); err == nil && d > 0 {
+		return d, true
+	}
+	return 0, false
+}
+
+// clockAt returns time of the same day as now with hours and minutes from reClock match
+func clockAt(now time.Time, m []string) time.Time {
+	hh, _ := strconv.Atoi(m[1])
+	mm, _ := strconv.Atoi(m[2])
+	return time.Date(now.Year(), now.Month(), now.Day(), hh, mm, 0, 0, now.Location())
+}
+
+// mention makes markdown mention of the user, works for users without username too
+func mention(u User) string {
+	name := "@" + u.Username
+	if u.Username == "" {
+		name = strings.TrimSpace(u.DisplayName)
+	}
+	return fmt.Sprintf("[%s](tg://user?id=%d)", name, u.ID)
+}
@@ -0,0 +1,147 @@
+package bot
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReminders_parse(t *testing.T) {
+	r := prepReminders(t, nil)
+	msk := r.location
+	r.now = func() time.Time { return time.Date(2020, 2, 12, 20, 0, 0, 0, msk) } // wednesday
+
+	tbl := []struct {
+		args string
+		at   time.Time
+		text string
+		fail bool
+	}{
+		{"30m проверить звук", time.Date(2020, 2, 12, 20, 30, 0, 0, msk), "проверить звук", false},
+		{"2ч blah", time.Date(2020, 2, 12, 22, 0, 0, 0, msk), "blah", false},
+		{"1h30m blah", time.Date(2020, 2, 12, 21, 30, 0, 0, msk), "blah", false},
+		{"1д blah", time.Date(2020, 2, 13, 20, 0, 0, 0, msk), "blah", false},
+		{"22:50 blah", time.Date(2020, 2, 12, 22, 50, 0, 0, msk), "blah", false},
+		{"10:00 blah", time.Date(2020, 2, 13, 10, 0, 0, 0, msk), "blah", false},
+		{"сб 22:50 начать эфир", time.Date(2020, 2, 15, 22, 50, 0, 0, msk), "начать эфир", false},
+		{"Ср 19:00 blah", time.Date(2020, 2, 19, 19, 0, 0, 0, msk), "blah", false},
+		{"ср 21:00 blah", time.Date(2020, 2, 12, 21, 0, 0, 0, msk), "blah", false},
+		{"завтра 09:15 blah", time.Date(2020, 2, 13, 9, 15, 0, 0, msk), "blah", false},
+		{"сегодня 09:15 blah", time.Time{}, "", true},
+		{"когда-нибудь 09:15 blah", time.Time{}, "", true},
+		{"сб 25:00 blah", time.Time{}, "", true},
+		{"30m", time.Time{}, "", true},
+		{"367d blah", time.Time{}, "", true},
+		{"9999999999999999h blah", time.Time{}, "", true},
+		{"99999999999999999999999d blah", time.Time{}, "", true},
+		{"2562047h blah", time.Time{}, "", true},
+		{"blah blah", time.Time{}, "", true},
+	}
+
+	for i, tt := range tbl {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			at, text, err := r.parse(tt.args)
+			if tt.fail {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.at.Unix(), at.Unix())
+			assert.Equal(t, tt.text, text)
+		})
+	}
+}
+
+func TestReminders_OnMessage(t *testing.T) {
+	su := &MockSubmitter{}
+	r := prepReminders(t, su)
+	r.now = func() time.Time { return time.Date(2020, 2, 12, 20, 0, 0, 0, r.location) }
+	user := User{ID: 1, Username: "user"}
+
+	resp := r.OnMessage(Message{Text: "remind! 30m проверить звук", From: user, ChatID: 123})
+	assert.Equal(t, Response{Text: "напомню [@user](tg://user?id=1) в 12.02 20:30 (через 30мин), #1", Send: true}, resp)
+
+	resp = r.OnMessage(Message{Text: "напомни! сб 22:50 начать эфир", From: user, ChatID: 123})
+	assert.True(t, resp.Send)
+
+	resp = r.OnMessage(Message{Text: "remind! 1h limited", From: user, ChatID: 123})
+	assert.Equal(t, Response{Text: "слишком много напоминаний, не больше 2", Send: true}, resp)
+
+	resp = r.OnMessage(Message{Text: "remind! list", From: user})
+	assert.Equal(t, Response{Text: "#1 12.02 20:30 - проверить звук\n#2 15.02 22:50 - начать эфир", Send: true}, resp)
+
+	resp = r.OnMessage(Message{Text: "remind!", From: User{ID: 2, Username: "user2"}})
+	assert.Equal(t, Response{Text: "напоминаний нет", Send: true}, resp)
+
+	resp = r.OnMessage(Message{Text: "remind! cancel 2", From: User{ID: 2, Username: "user2"}})
+	assert.Equal(t, Response{Text: "можно отменить только свое напоминание", Send: true}, resp)
+
+	resp = r.OnMessage(Message{Text: "remind! cancel #2", From: user})
+	assert.Equal(t, Response{Text: "напоминание #2 отменено", Send: true}, resp)
+
+	resp = r.OnMessage(Message{Text: "remind! cancel 2", From: user})
+	assert.Equal(t, Response{Text: "напоминание #2 не найдено", Send: true}, resp)
+
+	resp = r.OnMessage(Message{Text: "not a command", From: user})
+	assert.Equal(t, Response{}, resp)
+
+	// restored from the store
+	r2, err := NewReminders(context.Background(), r.ReminderParams)
+	require.NoError(t, err)
+	r2.now = r.now
+	resp = r2.OnMessage(Message{Text: "remind! list", From: user})
+	assert.Equal(t, Response{Text: "#1 12.02 20:30 - проверить звук", Send: true}, resp)
+}
+
+func TestReminders_fire(t *testing.T) {
+	su := &MockSubmitter{}
+	r := prepReminders(t, su)
+	now := time.Date(2020, 2, 12, 20, 0, 0, 0, r.location)
+	r.now = func() time.Time { return now }
+
+	r.OnMessage(Message{Text: "remind! 30m проверить *звук*", From: User{ID: 1, Username: "user"}, ChatID: 123})
+	r.OnMessage(Message{Text: "remind! 2h later", From: User{ID: 2, DisplayName: "John Doe"}, ChatID: 123})
+
+	r.fire(context.Background())
+	su.AssertNotCalled(t, "SubmitTo", mock.Anything, mock.Anything, mock.Anything)
+
+	su.On("SubmitTo", mock.Anything, int64(123),
+		Response{Text: "[@user](tg://user?id=1) напоминаю: проверить \\*звук\\*", Send: true}).Return(nil).Once()
+	now = now.Add(31 * time.Minute)
+	r.fire(context.Background())
+	su.AssertExpectations(t)
+	assert.Equal(t, 1, len(r.state.Items))
+
+	r.fire(context.Background())
+	su.AssertNumberOfCalls(t, "SubmitTo", 1)
+
+	// failed reminder kept for the next check
+	su.On("SubmitTo", mock.Anything, int64(123), mock.Anything).Return(errors.New("blah")).Once()
+	now = now.Add(2 * time.Hour)
+	r.fire(context.Background())
+	su.AssertNumberOfCalls(t, "SubmitTo", 2)
+	require.Equal(t, 1, len(r.state.Items))
+	assert.Equal(t, "later", r.state.Items[0].Text)
+}
+
+func prepReminders(t *testing.T, su Submitter) *Reminders {
+	tmp, err := ioutil.TempDir("", "reminders")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = os.RemoveAll(tmp) })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	r, err := NewReminders(ctx, ReminderParams{Submitter: su, StoreFile: path.Join(tmp, "reminders.json"),
+		MaxPerUser: 2, CheckInterval: time.Hour})
+	require.NoError(t, err)
+	return r
+}
@@ -0,0 +1,170 @@
+package bot
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/radio-t/super-bot/app/storage"
+)
+
+// SiteWatcher bot announces new posts on the site, podcast episodes and prep topics.
+// The last seen post of each category is kept in the store, so restarts neither miss nor repeat announcements
+type SiteWatcher struct {
+	SiteWatcherParams
+	store *storage.JSONFile
+
+	lastCheck time.Time
+	state     struct {
+		LastSeen map[string]string `json:"last_seen"` // category -> url of the newest post
+	}
+}
+
+// SiteWatcherParams defines watched site and categories
+type SiteWatcherParams struct {
+	Client        HTTPClient
+	SiteAPI       string        // i.e. https://radio-t.com/site-api
+	CheckDuration time.Duration // how often site checked
+	StoreFile     string
+	Categories    []string       // "podcast" and "prep" supported
+	Notifiers     []PrepNotifier // notified on new prep post
+	MaxTopics     int            // show notes in the episode announcement, 5 by default
+}
+
+// PrepNotifier gets notified on new prep topic detected
+type PrepNotifier interface {
+	NewPrep(prepURL string)
+}
+
+// maxSitePosts is how many recent posts of a category checked, older new posts are not announced
+const maxSitePosts = 5
+
+// NewSiteWatcher makes SiteWatcher bot with state kept in params.StoreFile
+func NewSiteWatcher(params SiteWatcherParams) (*SiteWatcher, error) {
+	log.Printf("[INFO] site watcher bot with api %s, categories %v", params.SiteAPI, params.Categories)
+	store, err := storage.NewJSONFile(params.StoreFile)
+	if err != nil {
+		return nil, err
+	}
+	if params.MaxTopics == 0 {
+		params.MaxTopics = 5
+	}
+	w := &SiteWatcher{SiteWatcherParams: params, store: store}
+	if err := store.Load(&w.state); err != nil {
+		return nil, err
+	}
+	if w.state.LastSeen == nil {
+		w.state.LastSeen = map[string]string{}
+	}
+	return w, nil
+}
+
+// OnMessage reacts on any message and, from time to time (every CheckDuration) hits site api
+// and gets the latest posts of watched categories. Posts newer than the last seen one are announced,
+// the first check of a category without saved state only remembers the latest post
+func (w *SiteWatcher) OnMessage(Message) (response Response) {
+	if time.Since(w.lastCheck) < w.CheckDuration {
+		return Response{}
+	}
+	w.lastCheck = time.Now()
+
+	var texts []string
+	for _, category := range w.Categories {
+		posts, err := w.newPosts(category)
+		if err != nil {
+			log.Printf("[WARN] failed to check for new %s posts, %v", category, err)
+			continue
+		}
+		for _, post := range posts {
+			log.Printf("[INFO] detected new %s post %s", category, post.URL)
+			switch category {
+			case "prep":
+				for _, n := range w.Notifiers {
+					n.NewPrep(post.URL)
+				}
+				texts = append(texts, fmt.Sprintf("Сбор тем начался - %s", post.URL))
+				response.Pin = true
+			case "podcast":
+				texts = append(texts, w.announcement(post))
+				response.Preview = true
+			}
+		}
+	}
+
+	if len(texts) == 0 {
+		return Response{}
+	}
+	response.Text = strings.Join(texts, "\n\n")
+	response.Send = true
+	return response
+}
+
+// newPosts returns posts of the category published after the last seen one, the oldest first
+func (w *SiteWatcher) newPosts(category string) ([]siteAPIResp, error) {
+	reqURL := fmt.Sprintf("%s/last/%d?categories=%s", w.SiteAPI, maxSitePosts, category)
+	req, err := http.NewRequest("GET", reqURL, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to make request %s", reqURL)
+	}
+	resp, err := w.Client.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to send request %s", reqURL)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("request %s returned %d", reqURL, resp.StatusCode)
+	}
+
+	posts := []siteAPIResp{}
+	if err = json.NewDecoder(resp.Body).Decode(&posts); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse response from %s", reqURL)
+	}
+	if len(posts) == 0 || posts[0].URL == "" {
+		return nil, nil
+	}
+
+	lastSeen := w.state.LastSeen[category]
+	if lastSeen == posts[0].URL {
+		return nil, nil
+	}
+	w.state.LastSeen[category] = posts[0].URL
+	if err = w.store.Save(w.state); err != nil {
+		log.Printf("[WARN] can't save site watcher state, %v", err)
+	}
+	if lastSeen == "" {
+		log.Printf("[INFO] the latest %s post is %s", category, posts[0].URL)
+		return nil, nil
+	}
+
+	var res []siteAPIResp
+	for _, p := range posts {
+		if p.URL == lastSeen {
+			break
+		}
+		res = append([]siteAPIResp{p}, res...)
+	}
+	if len(res) == len(posts) {
+		res = res[len(res)-1:] // last seen post is too old, announce the newest only
+	}
+	return res, nil
+}
+
+// announcement makes markdown message about a new episode, with cover image shown as the link preview
+func (w *SiteWatcher) announcement(post siteAPIResp) string {
+	return episodeText(post, w.MaxTopics)
+}
+
+// Help returns help message
+func (w *SiteWatcher) Help() string {
+	return ""
+}
+
+// ReactOn keys
+func (w *SiteWatcher) ReactOn() []string {
+	return []string{}
+}
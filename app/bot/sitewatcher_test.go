@@ -0,0 +1,180 @@
+package bot
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/radio-t/super-bot/app/bot/mocks"
+)
+
+func TestSiteWatcher_Prep(t *testing.T) {
+	tbl := []struct {
+		body   string
+		err    error
+		status int
+		resp   Response
+	}{
+		{
+			`[{"url":"https://radio-t.com/p/2020/02/11/prep-689/","title":"Темы для 689","date":"2020-02-11T23:04:21Z","categories":["prep"]}]`,
+			nil, 200, Response{},
+		},
+		{
+			`[{"url":"https://radio-t.com/p/2020/02/11/prep-689/","title":"Темы для 689","date":"2020-02-11T23:04:21Z","categories":["prep"]}]`,
+			nil, 200, Response{},
+		},
+		{
+			"errrrr", nil, 400, Response{},
+		},
+		{
+			"", errors.New("error"), 200, Response{},
+		},
+		{
+			`[{"url":"https://radio-t.com/p/2020/02/11/prep-690/","title":"Темы для 690","date":"2020-02-11T23:04:21Z","categories":["prep"]}]`,
+			nil, 200, Response{Text: "Сбор тем начался - https://radio-t.com/p/2020/02/11/prep-690/", Send: true, Pin: true, Preview: false},
+		},
+		{
+			`[{"url":"https://radio-t.com/p/2020/02/11/prep-690/","title":"Темы для 690","date":"2020-02-11T23:04:21Z","categories":["prep"]}]`,
+			nil, 200, Response{},
+		},
+	}
+
+	mockHTTP := &mocks.HTTPClient{}
+	n := &prepNotifierMock{}
+	w := prepSiteWatcher(t, SiteWatcherParams{Client: mockHTTP, SiteAPI: "http://example.com",
+		CheckDuration: time.Millisecond * 10, Categories: []string{"prep"}, Notifiers: []PrepNotifier{n}})
+
+	for i, tt := range tbl {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			mockHTTP.On("Do", mock.Anything).Return(&http.Response{
+				Body:       ioutil.NopCloser(strings.NewReader(tt.body)),
+				StatusCode: tt.status,
+			}, tt.err).Times(1)
+			resp := w.OnMessage(Message{})
+			assert.Equal(t, tt.resp, resp)
+			time.Sleep(time.Millisecond * 11)
+		})
+	}
+	assert.Equal(t, []string{"https://radio-t.com/p/2020/02/11/prep-690/"}, n.urls)
+	req := mockHTTP.Calls[0].Arguments.Get(0).(*http.Request)
+	assert.Equal(t, "http://example.com/last/5?categories=prep", req.URL.String())
+}
+
+func TestSiteWatcher_checkDuration(t *testing.T) {
+	mockHTTP := &mocks.HTTPClient{}
+	w := prepSiteWatcher(t, SiteWatcherParams{Client: mockHTTP, SiteAPI: "http://example.com",
+		CheckDuration: time.Millisecond * 50, Categories: []string{"prep"}})
+
+	mockHTTP.On("Do", mock.Anything).Return(&http.Response{
+		Body:       ioutil.NopCloser(strings.NewReader(`[{"url":"blah1","title":"Темы для 689","categories":["prep"]}]`)),
+		StatusCode: 200,
+	}, nil).Times(1)
+
+	mockHTTP.On("Do", mock.Anything).Return(&http.Response{
+		Body:       ioutil.NopCloser(strings.NewReader(`[{"url":"blah2","title":"Темы для 689","categories":["prep"]}]`)),
+		StatusCode: 200,
+	}, nil).Times(1)
+
+	for i := 0; i < 10; i++ {
+		w.OnMessage(Message{})
+		time.Sleep(6 * time.Millisecond)
+	}
+
+	mockHTTP.AssertNumberOfCalls(t, "Do", 2)
+	mockHTTP.AssertExpectations(t)
+}
+
+func TestSiteWatcher_Restart(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "sitewatcher")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmp)
+	storeFile := filepath.Join(tmp, "site.json")
+
+	reply := func(m *mocks.HTTPClient, body string) {
+		m.On("Do", mock.Anything).Return(&http.Response{Body: ioutil.NopCloser(strings.NewReader(body)),
+			StatusCode: 200}, nil).Once()
+	}
+
+	mockHTTP := &mocks.HTTPClient{}
+	w, err := NewSiteWatcher(SiteWatcherParams{Client: mockHTTP, SiteAPI: "http://example.com", StoreFile: storeFile,
+		Categories: []string{"podcast"}})
+	require.NoError(t, err)
+	reply(mockHTTP, `[{"url":"https://radio-t.com/p/2022/05/07/podcast-799/","title":"Радио-Т 799"}]`)
+	assert.Equal(t, Response{}, w.OnMessage(Message{}), "the first check remembers the latest post")
+
+	// restarted, two episodes published meanwhile
+	mockHTTP = &mocks.HTTPClient{}
+	w, err = NewSiteWatcher(SiteWatcherParams{Client: mockHTTP, SiteAPI: "http://example.com", StoreFile: storeFile,
+		Categories: []string{"podcast"}})
+	require.NoError(t, err)
+	reply(mockHTTP, `[{"url":"https://radio-t.com/p/2022/05/21/podcast-801/","title":"Радио-Т 801"},
+		{"url":"https://radio-t.com/p/2022/05/14/podcast-800/","title":"Радио-Т 800"},
+		{"url":"https://radio-t.com/p/2022/05/07/podcast-799/","title":"Радио-Т 799"}]`)
+	resp := w.OnMessage(Message{})
+	assert.Equal(t, "🎙 *Радио-Т 800* - [на сайте](https://radio-t.com/p/2022/05/14/podcast-800/)\n\n"+
+		"🎙 *Радио-Т 801* - [на сайте](https://radio-t.com/p/2022/05/21/podcast-801/)", resp.Text)
+	assert.True(t, resp.Send)
+	assert.True(t, resp.Preview)
+
+	// restarted again, nothing new
+	mockHTTP = &mocks.HTTPClient{}
+	w, err = NewSiteWatcher(SiteWatcherParams{Client: mockHTTP, SiteAPI: "http://example.com", StoreFile: storeFile,
+		Categories: []string{"podcast"}})
+	require.NoError(t, err)
+	reply(mockHTTP, `[{"url":"https://radio-t.com/p/2022/05/21/podcast-801/","title":"Радио-Т 801"}]`)
+	assert.Equal(t, Response{}, w.OnMessage(Message{}))
+}
+
+func TestSiteWatcher_announcement(t *testing.T) {
+	w := SiteWatcher{SiteWatcherParams: SiteWatcherParams{MaxTopics: 2}}
+	post := siteAPIResp{
+		URL:       "https://radio-t.com/p/2022/05/14/podcast-800/",
+		Title:     "Радио-Т 800",
+		ShowNum:   800,
+		Image:     "https://radio-t.com/images/radio-t/rt800.jpg",
+		FileName:  "rt_podcast800",
+		ShowNotes: "\n\nGo 1.18 [вышел]\nDocker_compose v2\nЕще тема\nТемы наших слушателей\n",
+		Body: "<ul>\n<li><a href=\"https://go.dev/blog/go1.18\">Go 1.18 [вышел]</a></li>\n<li>Docker_compose v2</li>\n" +
+			"<li>Еще тема</li>\n<li>Темы наших слушателей</li>\n</ul>",
+	}
+	assert.Equal(t, "[​](https://radio-t.com/images/radio-t/rt800.jpg)🎙 *Радио-Т 800* - "+
+		"[на сайте](https://radio-t.com/p/2022/05/14/podcast-800/)\n"+
+		"● [Go 1.18 вышел](https://go.dev/blog/go1.18)\n"+
+		"● Docker\\_compose v2\n"+
+		"…\n"+
+		"[слушать](https://cdn.radio-t.com/rt_podcast800.mp3)", w.announcement(post))
+
+	post.AudioURL = "https://cdn.radio-t.com/rt_podcast800.mp3?x=1"
+	post.Title = "Выпуск"
+	post.ShowNotes, post.Image = "", ""
+	assert.Equal(t, "🎙 *Выпуск* #800 - [на сайте](https://radio-t.com/p/2022/05/14/podcast-800/)\n"+
+		"[слушать](https://cdn.radio-t.com/rt_podcast800.mp3?x=1)", w.announcement(post))
+}
+
+func prepSiteWatcher(t *testing.T, params SiteWatcherParams) *SiteWatcher {
+	tmp, err := ioutil.TempDir("", "sitewatcher")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = os.RemoveAll(tmp) })
+	params.StoreFile = filepath.Join(tmp, "site.json")
+	w, err := NewSiteWatcher(params)
+	require.NoError(t, err)
+	return w
+}
+
+type prepNotifierMock struct {
+	urls []string
+}
+
+func (p *prepNotifierMock) NewPrep(prepURL string) {
+	p.urls = append(p.urls, prepURL)
+}
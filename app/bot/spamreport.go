@@ -0,0 +1,86 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+//go:generate mockery -name SpamClassifier -case snake
+
+// SpamReport bot lets super-users teach spam classifier with "spam!" reply and check it with "spamcheck!"
+type SpamReport struct {
+	classifier SpamClassifier
+	superUser  SuperUser
+}
+
+// SpamLearner learns spam samples reported by moderators
+type SpamLearner interface {
+	LearnSpam(text, reporter string) error
+}
+
+// SpamClassifier learns spam samples and scores texts
+type SpamClassifier interface {
+	SpamLearner
+	Explain(text string, n int) (prob float64, tokens []string, ok bool)
+}
+
+// NewSpamReport makes SpamReport bot
+func NewSpamReport(classifier SpamClassifier, superUser SuperUser) *SpamReport {
+	log.Printf("[INFO] spam report bot")
+	return &SpamReport{classifier: classifier, superUser: superUser}
+}
+
+// Help returns help message
+func (s *SpamReport) Help() string {
+	return genHelpMsg([]string{"spam!"}, "ответом на сообщение, добавить его в спам (только для админов)") +
+		genHelpMsg([]string{"spamcheck!"}, "оценка текста или сообщения классификатором спама (только для админов)")
+}
+
+// ReactOn keys
+func (s *SpamReport) ReactOn() []string {
+	return []string{"spam!", "spamcheck!"}
+}
+
+// OnMessage learns replied message as spam or reports its score
+func (s *SpamReport) OnMessage(msg Message) (response Response) {
+	text := strings.TrimSpace(msg.Text)
+	cmd := strings.ToLower(strings.SplitN(text, " ", 2)[0])
+	if (cmd != "spam!" && cmd != "spamcheck!") || !s.superUser.IsSuper(msg.From.Username) {
+		return Response{}
+	}
+
+	if cmd == "spam!" {
+		if msg.ReplyTo == nil || messageText(*msg.ReplyTo) == "" {
+			return Response{Text: "spam! надо отправить ответом на сообщение", Send: true}
+		}
+		if err := s.classifier.LearnSpam(messageText(*msg.ReplyTo), msg.From.Username); err != nil {
+			log.Printf("[WARN] can't learn spam, %v", err)
+			return Response{Text: fmt.Sprintf("не получилось, %v", err), Send: true}
+		}
+		return Response{Text: "запомнил как спам", Send: true}
+	}
+
+	sample := strings.TrimSpace(text[len(cmd):])
+	if msg.ReplyTo != nil {
+		sample = messageText(*msg.ReplyTo)
+	}
+	if sample == "" {
+		return Response{Text: "spamcheck! текст, или ответом на сообщение", Send: true}
+	}
+	prob, tokens, ok := s.classifier.Explain(sample, 5)
+	if !ok {
+		return Response{Text: "классификатор еще не обучен, нужно больше примеров спама", Send: true}
+	}
+	return Response{Text: fmt.Sprintf("вероятность спама %.2f, признаки: %s", prob,
+		EscapeMarkDown(strings.Join(tokens, ", "))), Send: true}
+}
+
+// messageText returns text of the message with image caption
+func messageText(msg Message) string {
+	text := msg.Text
+	if msg.Image != nil {
+		text = strings.TrimSpace(text + " " + msg.Image.Caption)
+	}
+	return strings.TrimSpace(text)
+}
@@ -0,0 +1,49 @@
+package bot
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/radio-t/super-bot/app/bot/mocks"
+)
+
+func TestSpamReport_OnMessage(t *testing.T) {
+	su := &mocks.SuperUser{}
+	su.On("IsSuper", "admin").Return(true)
+	su.On("IsSuper", "user").Return(false)
+	sc := &mocks.SpamClassifier{}
+	sc.On("LearnSpam", "заработок без вложений", "admin").Return(nil).Once()
+	sc.On("LearnSpam", "???", "admin").Return(errors.New("nothing to learn")).Once()
+	sc.On("Explain", "пишите в лс", 5).Return(0.97, []string{"лс", "пиш_"}, true).Once()
+	sc.On("Explain", "привет", 5).Return(0.0, nil, false).Once()
+
+	s := NewSpamReport(sc, su)
+	admin, user := User{Username: "admin"}, User{Username: "user"}
+	spamMsg := &Message{Text: "заработок", Image: &Image{Caption: "без вложений"}}
+
+	tbl := []struct {
+		msg  Message
+		resp Response
+	}{
+		{Message{Text: "spam!", From: user, ReplyTo: spamMsg}, Response{}},
+		{Message{Text: "spam!", From: admin}, Response{Text: "spam! надо отправить ответом на сообщение", Send: true}},
+		{Message{Text: "spam!", From: admin, ReplyTo: spamMsg}, Response{Text: "запомнил как спам", Send: true}},
+		{Message{Text: "Spam!", From: admin, ReplyTo: &Message{Text: "???"}},
+			Response{Text: "не получилось, nothing to learn", Send: true}},
+		{Message{Text: "spamcheck! пишите в лс", From: admin}, Response{Text: "вероятность спама 0.97, признаки: лс, пиш\\_", Send: true}},
+		{Message{Text: "spamcheck!", From: admin, ReplyTo: &Message{Text: "привет"}},
+			Response{Text: "классификатор еще не обучен, нужно больше примеров спама", Send: true}},
+		{Message{Text: "spamcheck!", From: admin}, Response{Text: "spamcheck! текст, или ответом на сообщение", Send: true}},
+		{Message{Text: "spammer! ok", From: admin}, Response{}},
+	}
+
+	for i, tt := range tbl {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			assert.Equal(t, tt.resp, s.OnMessage(tt.msg))
+		})
+	}
+	sc.AssertExpectations(t)
+}
@@ -0,0 +1,234 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/radio-t/super-bot/app/storage"
+)
+
+// Stats bot reports chat statistics for today and for the current (or last) show.
+// Aggregation is incremental, background refresher reads only new lines from reporter's daily JSONL logs.
+type Stats struct {
+	StatsParams
+	location *time.Location
+
+	lock      sync.Mutex
+	tail      *storage.LogTail
+	firstSeen map[string]time.Time
+	today     *periodStats
+	show      *periodStats
+}
+
+// StatsParams defines parameters for Stats bot
+type StatsParams struct {
+	LogsPath        string        // location of reporter's *.log files
+	BotUsername     string        // the bot's broadcast messages define show boundaries
+	RefreshInterval time.Duration // how often to read new log records
+	TopSize         int           // number of top posters and domains to report
+}
+
+type periodStats struct {
+	from     time.Time
+	messages int
+	users    map[string]int
+	domains  map[string]int
+	minutes  map[time.Time]int
+	newUsers map[string]bool
+}
+
+// NewStats makes Stats bot and starts background aggregator
+func NewStats(ctx context.Context, params StatsParams) (*Stats, error) {
+	log.Printf("[INFO] stats bot with logs %s", params.LogsPath)
+	location, err := time.LoadLocation("Europe/Moscow")
+	if err != nil {
+		return nil, errors.Wrap(err, "can't load location")
+	}
+	s := &Stats{StatsParams: params, location: location, tail: storage.NewLogTail(params.LogsPath),
+		firstSeen: map[string]time.Time{}}
+	if s.RefreshInterval == 0 {
+		s.RefreshInterval = time.Minute
+	}
+	if s.TopSize == 0 {
+		s.TopSize = 5
+	}
+	go s.aggregator(ctx)
+	return s, nil
+}
+
+// Help returns help message
+func (s *Stats) Help() string {
+	return genHelpMsg(s.ReactOn(), "статистика чата за сегодня и за выпуск")
+}
+
+// ReactOn keys
+func (s *Stats) ReactOn() []string {
+	return []string{"stats!", "статистика!"}
+}
+
+// OnMessage returns stats for today and the current show
+func (s *Stats) OnMessage(msg Message) (response Response) {
+	if !contains(s.ReactOn(), msg.Text) {
+		return Response{}
+	}
+
+	if err := s.Refresh(); err != nil {
+		log.Printf("[WARN] can't refresh stats, %v", err)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.today == nil {
+		return Response{Text: "статистики пока нет", Send: true}
+	}
+	text := "*Сегодня*\n" + s.report(s.today)
+	if s.show != nil {
+		text += "\n*Выпуск*\n" + s.report(s.show)
+	}
+	return Response{Text: text, Send: true}
+}
+
+func (s *Stats) aggregator(ctx context.Context) {
+	if err := s.Refresh(); err != nil {
+		log.Printf("[WARN] can't refresh stats, %v", err)
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(s.RefreshInterval):
+			if err := s.Refresh(); err != nil {
+				log.Printf("[WARN] can't refresh stats, %v", err)
+			}
+		}
+	}
+}
+
+// Refresh reads new records from the log files
+func (s *Stats) Refresh() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.tail.Read(func(fileName string, line []byte) {
+		msg := Message{}
+		if err := json.Unmarshal(line, &msg); err != nil {
+			log.Printf("[DEBUG] skip bad log line in %s, %v", fileName, err)
+			return
+		}
+		s.add(msg)
+	})
+}
+
+// add accounts one message in today's and show's stats. Should be called under lock
+func (s *Stats) add(msg Message) {
+	sent := msg.Sent.In(s.location)
+	day := time.Date(sent.Year(), sent.Month(), sent.Day(), 0, 0, 0, 0, s.location)
+	if s.today == nil || !s.today.from.Equal(day) {
+		s.today = newPeriodStats(day)
+	}
+
+	if s.BotUsername != "" && msg.From.Username == s.BotUsername {
+		if strings.Contains(msg.Text, MsgBroadcastStarted) {
+			s.show = newPeriodStats(sent)
+		}
+		return // bot's messages are not counted
+	}
+
+	name := authorName(msg.From)
+	if name == "" {
+		return
+	}
+	_, seen := s.firstSeen[name]
+	if !seen {
+		s.firstSeen[name] = sent
+	}
+
+	for _, p := range []*periodStats{s.today, s.show} {
+		if p == nil {
+			continue
+		}
+		p.messages++
+		p.users[name]++
+		p.minutes[sent.Truncate(time.Minute)]++
+		if !seen {
+			p.newUsers[name] = true
+		}
+		for _, d := range messageDomains(msg) {
+			p.domains[d]++
+		}
+	}
+}
+
+func (s *Stats) report(p *periodStats) string {
+	lines := []string{fmt.Sprintf("сообщений: %d, участников: %d, новых: %d", p.messages, len(p.users), len(p.newUsers))}
+	if top := topN(p.users, s.TopSize); top != "" {
+		lines = append(lines, "активнее всех: "+top)
+	}
+	if top := topN(p.domains, s.TopSize); top != "" {
+		lines = append(lines, "ссылки на: "+top)
+	}
+
+	var busiest time.Time
+	for m, c := range p.minutes {
+		if c > p.minutes[busiest] || (c == p.minutes[busiest] && m.Before(busiest)) {
+			busiest = m
+		}
+	}
+	if !busiest.IsZero() {
+		lines = append(lines, fmt.Sprintf("самая жаркая минута: %s, %d сообщений", busiest.In(s.location).Format("15:04"),
+			p.minutes[busiest]))
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+func newPeriodStats(from time.Time) *periodStats {
+	return &periodStats{from: from, users: map[string]int{}, domains: map[string]int{},
+		minutes: map[time.Time]int{}, newUsers: map[string]bool{}}
+}
+
+// topN returns "key (count)" list for n keys with the highest counts, keys escaped for markdown
+func topN(m map[string]int, n int) string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if m[keys[i]] != m[keys[j]] {
+			return m[keys[i]] > m[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	if len(keys) > n {
+		keys = keys[:n]
+	}
+	res := make([]string, 0, len(keys))
+	for _, k := range keys {
+		res = append(res, fmt.Sprintf("%s (%d)", EscapeMarkDown(k), m[k]))
+	}
+	return strings.Join(res, ", ")
+}
+
+// messageDomains extracts domains of all links in the message
+func messageDomains(msg Message) (res []string) {
+	for _, l := range entityLinks(msg) {
+		if !strings.Contains(l, "://") {
+			l = "https://" + l
+		}
+		u, err := url.Parse(l)
+		if err != nil || u.Host == "" {
+			continue
+		}
+		res = append(res, strings.TrimPrefix(strings.ToLower(u.Hostname()), "www."))
+	}
+	return res
+}
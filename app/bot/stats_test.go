@@ -0,0 +1,98 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStats_OnMessage(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "stats")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ts := time.Date(2020, 2, 15, 17, 0, 0, 0, time.UTC) // 20:00 msk
+	writeLog(t, path.Join(tmp, "20200214.log"), false,
+		Message{From: User{Username: "old"}, Sent: ts.Add(-24 * time.Hour), Text: "yesterday"},
+	)
+	writeLog(t, path.Join(tmp, "20200215.log"), false,
+		Message{From: User{Username: "old"}, Sent: ts, Text: "before the show"},
+		Message{From: User{Username: "rtbot"}, Sent: ts.Add(time.Hour), Text: MsgBroadcastStarted},
+		Message{From: User{Username: "user_1"}, Sent: ts.Add(time.Hour + time.Second), Text: "look at github.com/umputun",
+			Entities: &[]Entity{{Type: "url", Offset: 8, Length: 18}}},
+		Message{From: User{Username: "user_1"}, Sent: ts.Add(time.Hour + 2*time.Second), Text: "and this",
+			Entities: &[]Entity{{Type: "text_link", Offset: 4, Length: 4, URL: "https://www.github.com/radio-t"}}},
+		Message{From: User{DisplayName: "John Doe"}, Sent: ts.Add(time.Hour + 2*time.Minute), Text: "hi"},
+	)
+
+	s, err := NewStats(ctx, StatsParams{LogsPath: tmp, BotUsername: "rtbot", RefreshInterval: time.Hour})
+	require.NoError(t, err)
+
+	assert.Equal(t, Response{}, s.OnMessage(Message{Text: "blah"}))
+
+	resp := s.OnMessage(Message{Text: "stats!"})
+	assert.Equal(t, Response{Text: "*Сегодня*\nсообщений: 4, участников: 3, новых: 2\n" +
+		"активнее всех: @user\\_1 (2), @old (1), John Doe (1)\nссылки на: github.com (2)\n" +
+		"самая жаркая минута: 21:00, 2 сообщений\n\n" +
+		"*Выпуск*\nсообщений: 3, участников: 2, новых: 2\nактивнее всех: @user\\_1 (2), John Doe (1)\n" +
+		"ссылки на: github.com (2)\nсамая жаркая минута: 21:00, 2 сообщений\n", Send: true}, resp)
+
+	// incremental append, including incomplete line
+	writeLog(t, path.Join(tmp, "20200215.log"), true,
+		Message{From: User{Username: "old"}, Sent: ts.Add(time.Hour + 3*time.Minute), Text: "again"},
+	)
+	fh, err := os.OpenFile(path.Join(tmp, "20200215.log"), os.O_APPEND|os.O_WRONLY, 0600)
+	require.NoError(t, err)
+	_, err = fh.WriteString(`{"From":{"Username":"partial"`)
+	require.NoError(t, err)
+	require.NoError(t, fh.Close())
+
+	require.NoError(t, s.Refresh())
+	assert.Equal(t, 4, s.show.messages)
+	assert.Equal(t, 5, s.today.messages)
+
+	// the next day resets today's stats, show continues
+	writeLog(t, path.Join(tmp, "20200216.log"), false,
+		Message{From: User{Username: "user_1"}, Sent: ts.Add(8 * time.Hour), Text: "after midnight"},
+	)
+	require.NoError(t, s.Refresh())
+	assert.Equal(t, 5, s.show.messages)
+	assert.Equal(t, 1, s.today.messages)
+	assert.Equal(t, 0, len(s.today.newUsers))
+}
+
+func TestStats_NoLogs(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "stats")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	s, err := NewStats(context.Background(), StatsParams{LogsPath: tmp, RefreshInterval: time.Hour})
+	require.NoError(t, err)
+	assert.Equal(t, Response{Text: "статистики пока нет", Send: true}, s.OnMessage(Message{Text: "статистика!"}))
+}
+
+func writeLog(t *testing.T, fname string, appendMode bool, msgs ...Message) {
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if appendMode {
+		flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+	fh, err := os.OpenFile(fname, flags, 0600) //nolint
+	require.NoError(t, err)
+	defer fh.Close()
+	for _, m := range msgs {
+		data, err := json.Marshal(m)
+		require.NoError(t, err)
+		_, err = fh.Write(append(data, '\n'))
+		require.NoError(t, err)
+	}
+}
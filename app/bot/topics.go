@@ -0,0 +1,267 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/radio-t/super-bot/app/storage"
+)
+
+// Topics bot collects listeners' topic suggestions for the next show.
+// тема! adds a suggestion or upvotes the existing one, темы! lists the queue,
+// super users can export the list as markdown for the prep post. The list is reset on new prep post.
+type Topics struct {
+	superUser SuperUser
+	store     *storage.JSONFile
+	maxList   int
+
+	lock  sync.Mutex
+	state struct {
+		LastID  int     `json:"last_id"`
+		PrepURL string  `json:"prep_url,omitempty"`
+		Items   []topic `json:"items"`
+	}
+}
+
+type topic struct {
+	ID     int       `json:"id"`
+	Text   string    `json:"text"`
+	Links  []string  `json:"links,omitempty"`
+	Author User      `json:"author"`
+	Added  time.Time `json:"added"`
+	Voters []int     `json:"voters"` // user IDs, author included
+}
+
+var reTopicLink = regexp.MustCompile(`https?://\S+`)
+
+// NewTopics makes Topics bot with state kept in storeFile
+func NewTopics(superUser SuperUser, storeFile string, maxList int) (*Topics, error) {
+	log.Printf("[INFO] topics bot with %s", storeFile)
+	store, err := storage.NewJSONFile(storeFile)
+	if err != nil {
+		return nil, err
+	}
+	t := &Topics{superUser: superUser, store: store, maxList: maxList}
+	if err := store.Load(&t.state); err != nil {
+		return nil, err
+	}
+	log.Printf("[DEBUG] loaded %d topics", len(t.state.Items))
+	return t, nil
+}
+
+// Help returns help message
+func (t *Topics) Help() string {
+	return genHelpMsg([]string{"тема!"}, "предложить тему для следующего выпуска, тема! +12 - голос за тему #12") +
+		genHelpMsg([]string{"темы!"}, "список предложенных тем, темы! md - в markdown (только для админов)")
+}
+
+// ReactOn keys
+func (t *Topics) ReactOn() []string {
+	return []string{"тема!", "темы!"}
+}
+
+// OnMessage adds, upvotes and lists topics
+func (t *Topics) OnMessage(msg Message) (response Response) {
+	text := strings.TrimSpace(msg.Text)
+	switch {
+	case strings.HasPrefix(strings.ToLower(text), "темы!"):
+		args := strings.TrimSpace(strings.TrimPrefix(strings.ToLower(text), "темы!"))
+		if contains([]string{"md", "markdown", "export"}, args) {
+			if !t.superUser.IsSuper(msg.From.Username) {
+				return Response{}
+			}
+			return Response{Text: "```\n" + t.Markdown() + "```", Send: true}
+		}
+		return Response{Text: t.list(), Send: true}
+
+	case strings.HasPrefix(strings.ToLower(text), "тема!"):
+		args := strings.TrimSpace(text[len("тема!"):])
+		if args == "" {
+			return Response{}
+		}
+		if strings.HasPrefix(args, "+") {
+			return Response{Text: t.upvote(msg.From, strings.TrimPrefix(args, "+")), Send: true}
+		}
+		return Response{Text: t.add(msg, args), Send: true}
+	}
+	return Response{}
+}
+
+// NewPrep resets topics collected for the previous show, implements PrepNotifier
+func (t *Topics) NewPrep(prepURL string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.state.PrepURL == prepURL {
+		return
+	}
+	log.Printf("[INFO] reset %d topics on new prep post %s", len(t.state.Items), prepURL)
+	t.state.PrepURL = prepURL
+	t.state.Items = nil
+	t.save()
+}
+
+// Markdown returns all topics as markdown list, ordered by votes
+func (t *Topics) Markdown() string {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	// backticks dropped to keep the code block of "темы! md" intact
+	escape := func(s string) string { return EscapeMarkDown(strings.ReplaceAll(s, "`", "'")) }
+	sb := strings.Builder{}
+	for _, tp := range t.sorted() {
+		line := escape(tp.Text)
+		if len(tp.Links) > 0 && strings.TrimSpace(strings.Replace(tp.Text, tp.Links[0], "", 1)) != "" {
+			line = fmt.Sprintf("[%s](%s)", escape(strings.TrimSpace(strings.Replace(tp.Text, tp.Links[0], "", 1))), tp.Links[0])
+		}
+		_, _ = sb.WriteString(fmt.Sprintf("- %s - %s (+%d)\n", line, escape(authorName(tp.Author)), len(tp.Voters)))
+	}
+	return sb.String()
+}
+
+func (t *Topics) add(msg Message, text string) string {
+	links := t.links(msg, text)
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	for i, tp := range t.state.Items {
+		if !sameLinks(tp.Links, links) {
+			continue
+		}
+		if t.vote(i, msg.From.ID) {
+			t.save()
+			return fmt.Sprintf("такая тема уже есть, #%d, голос учтен", tp.ID)
+		}
+		return fmt.Sprintf("такая тема уже есть, #%d", tp.ID)
+	}
+
+	t.state.LastID++
+	t.state.Items = append(t.state.Items, topic{ID: t.state.LastID, Text: text, Links: links,
+		Author: msg.From, Added: time.Now(), Voters: []int{msg.From.ID}})
+	t.save()
+	log.Printf("[INFO] topic %d added by %v", t.state.LastID, msg.From)
+	return fmt.Sprintf("тема #%d добавлена", t.state.LastID)
+}
+
+func (t *Topics) upvote(user User, idStr string) string {
+	id, err := strconv.Atoi(strings.TrimSpace(idStr))
+	if err != nil {
+		return fmt.Sprintf("неверный номер темы %q", idStr)
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	for i, tp := range t.state.Items {
+		if tp.ID != id {
+			continue
+		}
+		if !t.vote(i, user.ID) {
+			return fmt.Sprintf("голос за тему #%d уже учтен", id)
+		}
+		t.save()
+		return fmt.Sprintf("+1 теме #%d, всего %d", id, len(t.state.Items[i].Voters))
+	}
+	return fmt.Sprintf("тема #%d не найдена", id)
+}
+
+// vote adds voter to the topic with index i, returns false if already voted. Should be called under lock
+func (t *Topics) vote(i, userID int) bool {
+	for _, v := range t.state.Items[i].Voters {
+		if v == userID {
+			return false
+		}
+	}
+	t.state.Items[i].Voters = append(t.state.Items[i].Voters, userID)
+	return true
+}
+
+func (t *Topics) list() string {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	items := t.sorted()
+	if len(items) == 0 {
+		return "тем пока нет, предложить можно так: тема! <текст и ссылка>"
+	}
+	if t.maxList > 0 && len(items) > t.maxList {
+		items = items[:t.maxList]
+	}
+
+	lines := make([]string, 0, len(items))
+	for _, tp := range items {
+		// no italic for the author, markdown can't escape inside of it
+		lines = append(lines, fmt.Sprintf("#%d [+%d] %s - %s", tp.ID, len(tp.Voters), EscapeMarkDown(tp.Text),
+			EscapeMarkDown(authorName(tp.Author))))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// sorted returns copy of topics ordered by votes, older first for the same votes. Should be called under lock
+func (t *Topics) sorted() []topic {
+	res := make([]topic, len(t.state.Items))
+	copy(res, t.state.Items)
+	sort.SliceStable(res, func(i, j int) bool { return len(res[i].Voters) > len(res[j].Voters) })
+	return res
+}
+
+// links extracts urls from message entities, falls back to regex for messages without entities
+func (t *Topics) links(msg Message, text string) []string {
+	if res := entityLinks(msg); len(res) > 0 {
+		return res
+	}
+	return reTopicLink.FindAllString(text, -1)
+}
+
+// save stores state, should be called under lock
+func (t *Topics) save() {
+	if err := t.store.Save(t.state); err != nil {
+		log.Printf("[WARN] can't save topics, %v", err)
+	}
+}
+
+// sameLinks checks if both lists have at least one link in common, links normalized before comparison
+func sameLinks(l1, l2 []string) bool {
+	for _, a := range l1 {
+		for _, b := range l2 {
+			if normalizeURL(a) == normalizeURL(b) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// normalizeURL drops scheme, www prefix, tracking params, fragment and trailing slash
+func normalizeURL(link string) string {
+	u, err := url.Parse(strings.TrimSpace(link))
+	if err != nil || u.Host == "" {
+		return strings.ToLower(strings.TrimSuffix(link, "/"))
+	}
+
+	q := u.Query()
+	for k := range q {
+		if strings.HasPrefix(k, "utm_") || k == "ref" || k == "fbclid" {
+			q.Del(k)
+		}
+	}
+	res := strings.TrimPrefix(strings.ToLower(u.Host), "www.") + strings.TrimSuffix(u.Path, "/")
+	if enc := q.Encode(); enc != "" {
+		res += "?" + enc
+	}
+	return res
+}
+
+func authorName(u User) string {
+	if u.Username != "" {
+		return "@" + u.Username
+	}
+	return strings.TrimSpace(u.DisplayName)
+}
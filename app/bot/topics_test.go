@@ -0,0 +1,113 @@
+package bot
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/radio-t/super-bot/app/bot/mocks"
+)
+
+func TestTopics_OnMessage(t *testing.T) {
+	su := &mocks.SuperUser{}
+	su.On("IsSuper", "umputun").Return(true)
+	su.On("IsSuper", "user_1").Return(false)
+	tp, storeFile := prepTopics(t, su)
+
+	u1, u2 := User{ID: 1, Username: "user_1"}, User{ID: 2, DisplayName: "John Doe"}
+
+	resp := tp.OnMessage(Message{Text: "темы!", From: u1})
+	assert.Equal(t, Response{Text: "тем пока нет, предложить можно так: тема! <текст и ссылка>", Send: true}, resp)
+
+	resp = tp.OnMessage(Message{Text: "тема! новый Go https://go.dev/blog/go1.16?utm_source=tg", From: u1})
+	assert.Equal(t, Response{Text: "тема #1 добавлена", Send: true}, resp)
+
+	resp = tp.OnMessage(Message{Text: "тема! про *докер* и `compose`", From: u1})
+	assert.Equal(t, Response{Text: "тема #2 добавлена", Send: true}, resp)
+
+	resp = tp.OnMessage(Message{Text: "Тема! смотрите http://www.go.dev/blog/go1.16/", From: u2})
+	assert.Equal(t, Response{Text: "такая тема уже есть, #1, голос учтен", Send: true}, resp)
+
+	resp = tp.OnMessage(Message{Text: "тема! https://go.dev/blog/go1.16", From: u2})
+	assert.Equal(t, Response{Text: "такая тема уже есть, #1", Send: true}, resp)
+
+	resp = tp.OnMessage(Message{Text: "тема! +2", From: u2})
+	assert.Equal(t, Response{Text: "+1 теме #2, всего 2", Send: true}, resp)
+
+	resp = tp.OnMessage(Message{Text: "тема! +2", From: u2})
+	assert.Equal(t, Response{Text: "голос за тему #2 уже учтен", Send: true}, resp)
+
+	resp = tp.OnMessage(Message{Text: "тема! +22", From: u2})
+	assert.Equal(t, Response{Text: "тема #22 не найдена", Send: true}, resp)
+
+	resp = tp.OnMessage(Message{Text: "тема! про k8s", From: u2})
+	assert.Equal(t, Response{Text: "тема #3 добавлена", Send: true}, resp)
+
+	resp = tp.OnMessage(Message{Text: "темы!", From: u1})
+	assert.Equal(t, Response{Text: "#1 [+2] новый Go https://go.dev/blog/go1.16?utm\\_source=tg - @user\\_1\n" +
+		"#2 [+2] про \\*докер\\* и \\`compose\\` - @user\\_1\n#3 [+1] про k8s - John Doe", Send: true}, resp)
+
+	resp = tp.OnMessage(Message{Text: "темы! md", From: u1})
+	assert.Equal(t, Response{}, resp, "not super")
+
+	resp = tp.OnMessage(Message{Text: "темы! md", From: User{Username: "umputun"}})
+	assert.Equal(t, Response{Text: "```\n- [новый Go](https://go.dev/blog/go1.16?utm_source=tg) - @user\\_1 (+2)\n" +
+		"- про \\*докер\\* и 'compose' - @user\\_1 (+2)\n- про k8s - John Doe (+1)\n```", Send: true}, resp)
+
+	resp = tp.OnMessage(Message{Text: "тема!", From: u1})
+	assert.Equal(t, Response{}, resp)
+
+	// state restored
+	tp2, err := NewTopics(su, storeFile, 10)
+	require.NoError(t, err)
+	assert.Equal(t, 3, len(tp2.state.Items))
+
+	tp2.NewPrep("https://radio-t.com/p/2021/03/02/prep-745/")
+	resp = tp2.OnMessage(Message{Text: "темы!", From: u1})
+	assert.Equal(t, Response{Text: "тем пока нет, предложить можно так: тема! <текст и ссылка>", Send: true}, resp)
+	resp = tp2.OnMessage(Message{Text: "тема! blah", From: u1})
+	assert.Equal(t, Response{Text: "тема #4 добавлена", Send: true}, resp)
+	tp2.NewPrep("https://radio-t.com/p/2021/03/02/prep-745/")
+	assert.Equal(t, 1, len(tp2.state.Items), "same prep post, no reset")
+}
+
+func TestTopics_linksFromEntities(t *testing.T) {
+	tp, _ := prepTopics(t, nil)
+	msg := Message{Text: "тема! статья про go", Entities: &[]Entity{
+		{Type: "text_link", Offset: 6, Length: 6, URL: "https://example.com/go"},
+	}}
+	assert.Equal(t, []string{"https://example.com/go"}, tp.links(msg, "статья про go"))
+
+	msg = Message{Text: "тема! example.com/go", Entities: &[]Entity{{Type: "url", Offset: 6, Length: 14}}}
+	assert.Equal(t, []string{"example.com/go"}, tp.links(msg, "example.com/go"))
+}
+
+func TestTopics_normalizeURL(t *testing.T) {
+	tbl := []struct {
+		inp, out string
+	}{
+		{"https://www.Example.com/path/", "example.com/path"},
+		{"http://example.com/path?utm_source=tg&utm_medium=x&id=1#top", "example.com/path?id=1"},
+		{"example.com/path/", "example.com/path"},
+	}
+	for i, tt := range tbl {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			assert.Equal(t, tt.out, normalizeURL(tt.inp))
+		})
+	}
+}
+
+func prepTopics(t *testing.T, su SuperUser) (tp *Topics, storeFile string) {
+	tmp, err := ioutil.TempDir("", "topics")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = os.RemoveAll(tmp) })
+	storeFile = path.Join(tmp, "topics.json")
+	tp, err = NewTopics(su, storeFile, 10)
+	require.NoError(t, err)
+	return tp, storeFile
+}
@@ -0,0 +1,82 @@
+package bot
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// recentUsers keeps up to max recently seen users, to translate user name to ID (mandatory for tg calls)
+type recentUsers struct {
+	max   int
+	lock  sync.Mutex
+	users map[int]userInfo
+}
+
+type userInfo struct {
+	User
+	ts       time.Time
+	lastText string
+}
+
+func newRecentUsers(max int) *recentUsers {
+	return &recentUsers{max: max, users: map[int]userInfo{}}
+}
+
+// seen records message author, removes 10% of the oldest users on overflow
+func (r *recentUsers) seen(msg Message) {
+	if msg.From.ID == 0 {
+		return
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.users[msg.From.ID] = userInfo{User: msg.From, ts: time.Now(), lastText: messageText(msg)}
+	if len(r.users) <= r.max {
+		return
+	}
+	users := make([]userInfo, 0, len(r.users))
+	for _, u := range r.users {
+		users = append(users, u)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ts.Before(users[j].ts) })
+	for i := 0; i <= r.max/10 && i < len(users); i++ {
+		delete(r.users, users[i].ID)
+	}
+}
+
+// target resolves user from the replied message (if target is empty), numeric ID or recently seen @username.
+// Returns the user with markdown-safe name to use in response
+func (r *recentUsers) target(target string, msg Message) (user userInfo, name string, ok bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if target == "" {
+		if msg.ReplyTo == nil || msg.ReplyTo.From.ID == 0 {
+			return userInfo{}, "", false
+		}
+		user, ok = r.users[msg.ReplyTo.From.ID]
+		if !ok {
+			user = userInfo{User: msg.ReplyTo.From}
+		}
+		user.lastText = messageText(*msg.ReplyTo)
+		return user, mention(user.User), true
+	}
+
+	if id, err := strconv.Atoi(target); err == nil && id != 0 {
+		user, ok = r.users[id]
+		if !ok {
+			user = userInfo{User: User{ID: id, DisplayName: target}}
+		}
+		return user, mention(user.User), true
+	}
+
+	for _, u := range r.users {
+		if u.Username != "" && strings.EqualFold(u.Username, strings.TrimPrefix(target, "@")) {
+			return u, EscapeMarkDown(target), true
+		}
+	}
+	return userInfo{}, "", false
+}
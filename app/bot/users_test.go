@@ -0,0 +1,53 @@
+package bot
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecentUsers_seen(t *testing.T) {
+	r := newRecentUsers(10)
+	for i := 1; i <= 11; i++ {
+		r.seen(Message{Text: "hi", From: User{ID: i}})
+		time.Sleep(time.Millisecond)
+	}
+	r.seen(Message{Text: "no id"})
+	assert.Equal(t, 9, len(r.users))
+	_, found := r.users[1]
+	assert.False(t, found, "the oldest removed")
+	_, found = r.users[11]
+	assert.True(t, found)
+}
+
+func TestRecentUsers_target(t *testing.T) {
+	r := newRecentUsers(10)
+	r.seen(Message{Text: "hi", From: User{ID: 1, Username: "user_1"}})
+	r.seen(Message{Text: "hello", Image: &Image{Caption: "pic"}, From: User{ID: 2, DisplayName: "No Name"}})
+
+	u, name, ok := r.target("@USER_1", Message{})
+	assert.True(t, ok)
+	assert.Equal(t, userInfo{User: User{ID: 1, Username: "user_1"}, ts: u.ts, lastText: "hi"}, u)
+	assert.Equal(t, "@USER\\_1", name)
+
+	u, name, ok = r.target("2", Message{})
+	assert.True(t, ok)
+	assert.Equal(t, "hello pic", u.lastText)
+	assert.Equal(t, "[No Name](tg://user?id=2)", name)
+
+	u, name, ok = r.target("3", Message{})
+	assert.True(t, ok)
+	assert.Equal(t, User{ID: 3, DisplayName: "3"}, u.User)
+	assert.Equal(t, "[3](tg://user?id=3)", name)
+
+	u, name, ok = r.target("", Message{ReplyTo: &Message{Text: "spam", From: User{ID: 4, Username: "spammer"}}})
+	assert.True(t, ok)
+	assert.Equal(t, userInfo{User: User{ID: 4, Username: "spammer"}, lastText: "spam"}, u)
+	assert.Equal(t, "[@spammer](tg://user?id=4)", name)
+
+	_, _, ok = r.target("@unknown", Message{})
+	assert.False(t, ok)
+	_, _, ok = r.target("", Message{})
+	assert.False(t, ok)
+}
@@ -0,0 +1,235 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/radio-t/super-bot/app/storage"
+)
+
+// Warnings bot lets super-users warn users with escalating sanctions. Each warning expires after Expiry,
+// the number of active warnings defines the step of Ladder, i.e. warning, 1h mute, 1d mute and kick.
+// Restrictions applied by the listener, on BanTarget and BanInterval or Kick of the response
+type Warnings struct {
+	WarningsParams
+	store       *storage.JSONFile
+	now         func() time.Time
+	location    *time.Location
+	recentUsers *recentUsers
+
+	lock  sync.Mutex
+	state struct {
+		Users map[int][]warning `json:"users"`
+	}
+}
+
+// WarningsParams defines parameters for Warnings bot
+type WarningsParams struct {
+	SuperUser SuperUser        // only super users can warn
+	StoreFile string           // json file to keep warnings
+	Expiry    time.Duration    // warning lifetime, default 30 days
+	Ladder    []WarnStep       // sanction for the 1st, 2nd and so on active warning, the last one repeats
+	Recorder  SanctionRecorder // optional, moderation registry
+}
+
+// WarnStep is a sanction for a warning, zero value is a plain warning
+type WarnStep struct {
+	Mute time.Duration
+	Kick bool
+}
+
+type warning struct {
+	Time   time.Time `json:"time"`
+	Issuer string    `json:"issuer"`
+	Reason string    `json:"reason,omitempty"`
+}
+
+// DefaultWarnLadder is a warning, one hour mute, one day mute and kick
+var DefaultWarnLadder = []WarnStep{{}, {Mute: time.Hour}, {Mute: 24 * time.Hour}, {Kick: true}}
+
+// ParseWarnLadder makes ladder from comma separated steps, i.e. "warn,1h,1d,kick"
+func ParseWarnLadder(s string) ([]WarnStep, error) {
+	var res []WarnStep
+	for _, step := range strings.Split(s, ",") {
+		step = strings.ToLower(strings.TrimSpace(step))
+		switch step {
+		case "warn":
+			res = append(res, WarnStep{})
+		case "kick":
+			res = append(res, WarnStep{Kick: true})
+		default:
+			d, ok := parseBanDuration(step)
+			if !ok {
+				return nil, errors.Errorf("bad warn step %q", step)
+			}
+			res = append(res, WarnStep{Mute: d})
+		}
+	}
+	return res, nil
+}
+
+// NewWarnings makes Warnings bot and loads stored warnings
+func NewWarnings(params WarningsParams) (*Warnings, error) {
+	log.Printf("[INFO] warnings bot with %s, ladder %+v", params.StoreFile, params.Ladder)
+	location, err := time.LoadLocation("Europe/Moscow")
+	if err != nil {
+		return nil, errors.Wrap(err, "can't load location")
+	}
+	store, err := storage.NewJSONFile(params.StoreFile)
+	if err != nil {
+		return nil, err
+	}
+	w := &Warnings{WarningsParams: params, store: store, now: time.Now, location: location,
+		recentUsers: newRecentUsers(5000)}
+	if err = store.Load(&w.state); err != nil {
+		return nil, errors.Wrap(err, "can't load warnings")
+	}
+	if w.state.Users == nil {
+		w.state.Users = map[int][]warning{}
+	}
+	if w.Expiry == 0 {
+		w.Expiry = 30 * 24 * time.Hour
+	}
+	if len(w.Ladder) == 0 {
+		w.Ladder = DefaultWarnLadder
+	}
+	return w, nil
+}
+
+// Help returns help message
+func (w *Warnings) Help() string {
+	return genHelpMsg([]string{"warn!"}, "предупредить, ответом или @user, с причиной (только для админов), "+
+		"unwarn! - снять предупреждения") +
+		genHelpMsg([]string{"warns!"}, "мои предупреждения")
+}
+
+// ReactOn keys
+func (w *Warnings) ReactOn() []string {
+	return []string{"warn!", "unwarn!", "warns!"}
+}
+
+// OnMessage warns, clears warnings and reports user's standing
+func (w *Warnings) OnMessage(msg Message) (response Response) {
+	w.recentUsers.seen(msg)
+
+	text := strings.TrimSpace(msg.Text)
+	cmd := strings.ToLower(strings.SplitN(text, " ", 2)[0])
+	if !contains(w.ReactOn(), cmd) {
+		return Response{}
+	}
+	args := strings.Fields(text[len(cmd):])
+
+	if cmd == "warns!" && (len(args) == 0 || !w.SuperUser.IsSuper(msg.From.Username)) {
+		return Response{Text: w.standing(msg.From, "у тебя"), Send: true}
+	}
+	if !w.SuperUser.IsSuper(msg.From.Username) {
+		return Response{}
+	}
+
+	target := ""
+	if msg.ReplyTo == nil && len(args) > 0 {
+		target, args = args[0], args[1:]
+	}
+	user, name, ok := w.recentUsers.target(target, msg)
+	if !ok {
+		return Response{Text: "кого? ответом на сообщение, @user или ID", Send: true}
+	}
+
+	switch cmd {
+	case "warns!":
+		return Response{Text: w.standing(user.User, "у "+name), Send: true}
+	case "unwarn!":
+		w.lock.Lock()
+		delete(w.state.Users, user.ID)
+		w.save()
+		w.lock.Unlock()
+		log.Printf("[INFO] warnings of %v cleared by %v", user.User, msg.From)
+		return Response{Text: fmt.Sprintf("предупреждения %s сняты", name), Send: true}
+	}
+
+	if w.SuperUser.IsSuper(user.Username) {
+		return Response{}
+	}
+	return w.warn(user.User, name, msg, strings.Join(args, " "))
+}
+
+func (w *Warnings) warn(user User, name string, msg Message, reason string) Response {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	issuer := "@" + msg.From.Username
+	active := append(w.active(user.ID), warning{Time: w.now(), Issuer: issuer, Reason: reason})
+	w.state.Users[user.ID] = active
+	w.save()
+	log.Printf("[INFO] %v warned by %v, %d active, reason: %q", user, msg.From, len(active), reason)
+	if w.Recorder != nil {
+		w.Recorder.Record(Sanction{ChatID: msg.ChatID, User: user, Action: ActionWarn, Issuer: issuer, Reason: reason})
+	}
+
+	step := w.Ladder[len(w.Ladder)-1]
+	if len(active) <= len(w.Ladder) {
+		step = w.Ladder[len(active)-1]
+	}
+
+	text := fmt.Sprintf("%s, предупреждение %d/%d", name, len(active), len(w.Ladder))
+	if reason != "" {
+		text += ": " + EscapeMarkDown(reason)
+	}
+	resp := Response{Text: text, Send: true}
+	switch {
+	case step.Kick:
+		resp.Text += ", до свидания"
+		resp.Kick, resp.BanTarget = true, &user
+	case step.Mute > 0:
+		resp.Text += ", помолчи " + HumanizeDuration(step.Mute)
+		resp.BanInterval, resp.BanTarget = step.Mute, &user
+	}
+	return resp
+}
+
+// standing reports active warnings of the user
+func (w *Warnings) standing(user User, who string) string {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	active := w.active(user.ID)
+	if len(active) == 0 {
+		return who + " нет предупреждений"
+	}
+	last := active[len(active)-1]
+	res := fmt.Sprintf("%s %d из %d предупреждений, последнее", who, len(active), len(w.Ladder))
+	if last.Reason != "" {
+		res += ": " + EscapeMarkDown(last.Reason) + ","
+	}
+	return res + " истекает " + last.Time.Add(w.Expiry).In(w.location).Format("02.01.06 15:04")
+}
+
+// active returns not expired warnings of the user, should be called under lock
+func (w *Warnings) active(userID int) []warning {
+	var res []warning
+	for _, wr := range w.state.Users[userID] {
+		if w.now().Sub(wr.Time) < w.Expiry {
+			res = append(res, wr)
+		}
+	}
+	return res
+}
+
+// save drops expired warnings and writes the state, should be called under lock
+func (w *Warnings) save() {
+	for id := range w.state.Users {
+		if active := w.active(id); len(active) > 0 {
+			w.state.Users[id] = active
+			continue
+		}
+		delete(w.state.Users, id)
+	}
+	if err := w.store.Save(w.state); err != nil {
+		log.Printf("[WARN] can't save warnings, %v", err)
+	}
+}
@@ -0,0 +1,103 @@
+package bot
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/radio-t/super-bot/app/bot/mocks"
+)
+
+func TestParseWarnLadder(t *testing.T) {
+	tbl := []struct {
+		inp string
+		res []WarnStep
+		err bool
+	}{
+		{"warn,1h,1d,kick", DefaultWarnLadder, false},
+		{"warn, 30m , KICK", []WarnStep{{}, {Mute: 30 * time.Minute}, {Kick: true}}, false},
+		{"warn,blah", nil, true},
+		{"", nil, true},
+	}
+	for i, tt := range tbl {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			res, err := ParseWarnLadder(tt.inp)
+			if tt.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.res, res)
+		})
+	}
+}
+
+func TestWarnings_OnMessage(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "warnings")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	su := &mocks.SuperUser{}
+	su.On("IsSuper", "admin").Return(true)
+	su.On("IsSuper", mock.Anything).Return(false)
+	rec := &MockSanctionRecorder{}
+	rec.On("Record", mock.Anything).Return()
+
+	params := WarningsParams{SuperUser: su, StoreFile: path.Join(tmp, "warnings.json"), Recorder: rec,
+		Ladder: []WarnStep{{}, {Mute: time.Hour}, {Kick: true}}}
+	w, err := NewWarnings(params)
+	require.NoError(t, err)
+	assert.Equal(t, 30*24*time.Hour, w.Expiry)
+	now := time.Date(2021, 3, 6, 18, 0, 0, 0, time.UTC)
+	w.now = func() time.Time { return now }
+
+	admin := User{ID: 100, Username: "admin"}
+	user := User{ID: 1, Username: "user1"}
+	w.OnMessage(Message{Text: "привет", From: user})
+
+	assert.Equal(t, Response{Text: "у тебя нет предупреждений", Send: true}, w.OnMessage(Message{Text: "warns!", From: user}))
+	assert.Equal(t, Response{}, w.OnMessage(Message{Text: "warn! @admin", From: user}), "not super")
+	assert.Equal(t, Response{}, w.OnMessage(Message{Text: "warn! @admin", From: admin}), "super can't be warned")
+	assert.Equal(t, Response{Text: "кого? ответом на сообщение, @user или ID", Send: true},
+		w.OnMessage(Message{Text: "warn! @nobody", From: admin}))
+
+	assert.Equal(t, Response{Text: "@user1, предупреждение 1/3: флуд", Send: true},
+		w.OnMessage(Message{Text: "warn! @user1 флуд", From: admin}))
+	rec.AssertCalled(t, "Record", Sanction{User: user, Action: ActionWarn, Issuer: "@admin", Reason: "флуд"})
+
+	now = now.Add(time.Hour)
+	assert.Equal(t, Response{Text: "[@user1](tg://user?id=1), предупреждение 2/3: оффтоп, помолчи 1ч", Send: true,
+		BanInterval: time.Hour, BanTarget: &user},
+		w.OnMessage(Message{Text: "warn! оффтоп", From: admin, ReplyTo: &Message{From: user}}))
+
+	assert.Equal(t, Response{Text: "у тебя 2 из 3 предупреждений, последнее: оффтоп, истекает 05.04.21 22:00", Send: true},
+		w.OnMessage(Message{Text: "warns! @admin", From: user}), "non-super sees own standing only")
+	assert.Equal(t, Response{Text: "у [@user1](tg://user?id=1) 2 из 3 предупреждений, последнее: оффтоп, истекает 05.04.21 22:00", Send: true},
+		w.OnMessage(Message{Text: "warns! 1", From: admin}))
+
+	assert.Equal(t, Response{Text: "[@user1](tg://user?id=1), предупреждение 3/3, до свидания", Send: true, Kick: true, BanTarget: &user},
+		w.OnMessage(Message{Text: "warn! 1", From: admin}))
+	assert.Equal(t, Response{Text: "[@user1](tg://user?id=1), предупреждение 4/3, до свидания", Send: true, Kick: true, BanTarget: &user},
+		w.OnMessage(Message{Text: "warn! 1", From: admin}), "last step repeats")
+
+	// reload from store
+	w2, err := NewWarnings(params)
+	require.NoError(t, err)
+	assert.Equal(t, w.state, w2.state)
+
+	// first warning expired
+	now = now.Add(30*24*time.Hour - 30*time.Minute)
+	assert.Equal(t, Response{Text: "у тебя 3 из 3 предупреждений, последнее истекает 05.04.21 22:00", Send: true},
+		w.OnMessage(Message{Text: "warns!", From: user}))
+
+	assert.Equal(t, Response{Text: "предупреждения @user1 сняты", Send: true},
+		w.OnMessage(Message{Text: "unwarn! @user1", From: admin}))
+	assert.Equal(t, Response{Text: "у тебя нет предупреждений", Send: true}, w.OnMessage(Message{Text: "warns!", From: user}))
+}
@@ -1,12 +1,11 @@
 package bot
 
 import (
+	"sort"
 	"strings"
 	"unicode"
 
-	"golang.org/x/text/runes"
-	"golang.org/x/text/transform"
-	"golang.org/x/text/unicode/norm"
+	"github.com/radio-t/super-bot/app/confusable"
 )
 
 // WTFSteroidChecker check if command wtf{!,?} is written with additional characters
@@ -15,41 +14,14 @@ type WTFSteroidChecker struct {
 	message string
 }
 
-// WTFUnicodeLibrary contains unicode characters and strings that looks like "w","t","f","!","?"
+// WTFUnicodeLibrary contains unicode characters and strings that looks like "w","t","f","!","?" in wtf command only,
+// the common lookalike letters are replaced by confusable.Skeleton
 func (w *WTFSteroidChecker) WTFUnicodeLibrary() map[string][]string {
 	repl := make(map[string][]string)
 	repl["w"] = []string{
-		"ᘺ",
-		"ய",
-		"ʍ",
-		"Ⱳ",
-		"ⱳ",
-		"ᴡ",
-		"🅆",
-		"🆆",
-		"ᵂ",
-		"ʷ",
-		"🅦",
-		"Ⓦ",
-		"𝓦",
-		"𝙒",
-		"𝖂",
-		"Ｗ",
-		"ⓦ",
-		"𝑤",
-		"𝕨",
-		"𝖜",
-		"ᷱ",
-		"ｗ",
-		"ꙍ",
 		"в",
-		"₩",
-		"𝀥",
 		"⨈",
-		"🇼",
 		"\\/\\/",
-		"🄦",
-		"⒲",
 		"ᐯᐯ",
 		"ᏙᏙ",
 		"ᜠᜠ",
@@ -101,32 +73,9 @@ func (w *WTFSteroidChecker) WTFUnicodeLibrary() map[string][]string {
 		"🄥🄥",
 		"⒱⒱"}
 	repl["t"] = []string{
-		"丅",
-		"𐤯",
-		"𐊗",
-		"ナ",
-		"ߠ",
-		"Ϯ",
-		"ϯ",
-		"Ʇ",
-		"ʇ",
-		"ȶ",
-		"ᵀ",
-		"🅃",
-		"🆃",
-		"ᵗ",
-		"🅣",
-		"Ⓣ",
-		"𝕿",
-		"𝕋",
-		"Ｔ",
-		"ⓣ",
-		"𝖙",
 		"ɫ",
-		"ꝉ",
 		"т",
 		"⥡",
-		"🇹",
 		"╩",
 		"╨",
 		"╦",
@@ -138,48 +87,14 @@ func (w *WTFSteroidChecker) WTFUnicodeLibrary() map[string][]string {
 		"∤",
 		"⸷",
 		"‡",
-		"†",
-		"🄣",
-		"⒯"}
+		"†"}
 	repl["f"] = []string{
-		"𐌅",
-		"𖨝",
-		"ϝ",
-		"ʄ",
-		"ꟻ",
-		"Ⅎ",
-		"ⅎ",
-		"Ƒ",
-		"ƒ",
-		"ᵮ",
-		"Ꞙ",
-		"ꞙ",
-		"ꬵ",
-		"Ꝼ",
-		"ꝼ",
-		"🄵",
-		"🅵",
-		"🅕",
-		"Ⓕ",
-		"ℱ",
-		"𝕱",
-		"Ｆ",
-		"ⓕ",
-		"𝕗",
-		"𝔣",
-		"𝓯",
-		"𝖋",
-		"ｆ",
 		"ф",
-		"Ғ",
 		"£",
 		"⨚",
 		"⨑",
 		"⨍",
-		"🇫",
-		"℉",
-		"🄕",
-		"⒡"}
+		"℉"}
 	repl["!"] = []string{
 		"i",
 		"1",
@@ -213,24 +128,30 @@ func (w *WTFSteroidChecker) WTFUnicodeLibrary() map[string][]string {
 	return repl
 }
 
-// removeDiacretic smart remove diacritic marks
-// isMn check rune is in Unicode Mn category nonspacing marks
-// Example ẃŧḟ! -> wtf!
-// https://blog.golang.org/normalization#TOC_10.
-// https://pkg.go.dev/golang.org/x/text/runes#Remove
-func (w *WTFSteroidChecker) removeDiacretic() {
-	t := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
-	w.message, _, _ = transform.String(t, w.message)
-}
-
-// removeUnicodeAnalog replace characters that looks like "w","t","f","!", "?" with their ASCII representation
-func (w *WTFSteroidChecker) removeUnicodeAnalog() {
-	replaceMap := w.WTFUnicodeLibrary()
-	for mainLetter, listOfUnicodes := range replaceMap {
+// wtfReplacer made once from WTFUnicodeLibrary, longer sequences replaced first
+var wtfReplacer = func() *strings.Replacer {
+	var pairs [][2]string
+	for mainLetter, listOfUnicodes := range (&WTFSteroidChecker{}).WTFUnicodeLibrary() {
 		for _, unicodeSymbol := range listOfUnicodes {
-			w.message = strings.ReplaceAll(w.message, unicodeSymbol, mainLetter)
+			pairs = append(pairs, [2]string{unicodeSymbol, mainLetter})
 		}
 	}
+	sort.Slice(pairs, func(i, j int) bool {
+		if len(pairs[i][0]) != len(pairs[j][0]) {
+			return len(pairs[i][0]) > len(pairs[j][0])
+		}
+		return pairs[i][0] < pairs[j][0]
+	})
+	var oldnew []string
+	for _, p := range pairs {
+		oldnew = append(oldnew, p[0], p[1])
+	}
+	return strings.NewReplacer(oldnew...)
+}()
+
+// removeUnicodeAnalog replace characters that looks like "w","t","f","!", "?" with their ASCII representation
+func (w *WTFSteroidChecker) removeUnicodeAnalog() {
+	w.message = wtfReplacer.Replace(w.message)
 }
 
 // removeNotASCIIAndNotRussian delete all non-unicode characters except russian unicode characters
@@ -260,8 +181,8 @@ func (w *WTFSteroidChecker) removeNotLetters() {
 func (w *WTFSteroidChecker) Contains() bool {
 
 	w.message = strings.ToLower(w.message)
-	w.removeDiacretic()
 	w.removeUnicodeAnalog()
+	w.message = confusable.Skeleton(w.message)
 	w.removeNotASCIIAndNotRussian()
 	w.removeNotLetters()
 
@@ -0,0 +1,49 @@
+// Package confusable makes skeletons of strings, replacing characters looking alike, i.e. Cyrillic "а",
+// math "𝕒" or circled "ⓐ", by their Latin prototype. Strings with the same skeleton are visually confusable.
+//
+// Prototypes come from the hand-picked lookalikes.txt and the confusables table of the wtf! checker.
+// Unicode TR39 confusables data is not bundled, the table covers Cyrillic, Greek, math, circled, fullwidth
+// and a few other lookalikes of Latin letters and digits only
+package confusable
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Skeleton returns lower-case string with compatibility forms decomposed, diacritic marks removed
+// and confusable characters replaced by prototypes. Example: "Ｕｍрｕｔúｎ" -> "umputun"
+func Skeleton(s string) string {
+	t := transform.Chain(norm.NFKD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	s, _, _ = transform.String(t, s)
+	return strings.Map(func(r rune) rune {
+		if p, ok := prototypes[r]; ok {
+			return p
+		}
+		r = unicode.ToLower(r)
+		if p, ok := prototypes[r]; ok {
+			return p
+		}
+		return r
+	}, s)
+}
+
+// Key returns skeleton with letters and digits only, "Um-putun ✔" and "umputun" have the same key
+func Key(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, Skeleton(s))
+}
+
+// Equal checks if strings look alike, ignoring case, diacritics, separators and punctuation
+func Equal(a, b string) bool {
+	ka := Key(a)
+	return ka != "" && ka == Key(b)
+}
@@ -0,0 +1,71 @@
+package confusable
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSkeleton(t *testing.T) {
+	tbl := []struct {
+		inp, out string
+	}{
+		{"umputun", "umputun"},
+		{"UMPUTUN", "umputun"},
+		{"Umрutun", "umputun"}, // cyrillic р
+		{"Ｕｍｐｕｔúｎ", "umputun"},
+		{"𝓤𝓶𝓹𝓾𝓽𝓾𝓷", "umputun"},
+		{"ⓑⓞⓑⓤⓚ", "bobuk"},
+		{"ВОВИК", "bobиk"},
+		{"gr0ay", "groay"},
+		{"🅦🅣ⓕ!", "wtf!"},
+		{"привет", "npиbet"},
+	}
+	for i, tt := range tbl {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			assert.Equal(t, tt.out, Skeleton(tt.inp))
+		})
+	}
+}
+
+func TestEqual(t *testing.T) {
+	tbl := []struct {
+		a, b string
+		res  bool
+	}{
+		{"umputun", "Umputun", true},
+		{"umputun", "Um-putun ✔", true},
+		{"umputun", "umрutun_", true},
+		{"Ksenks", "Кsеnкs", true},
+		{"umputun", "umputin", false},
+		{"", "", false},
+		{"bobuk", "bob", false},
+	}
+	for i, tt := range tbl {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			assert.Equal(t, tt.res, Equal(tt.a, tt.b))
+		})
+	}
+}
+
+func TestParseLookalikes(t *testing.T) {
+	data := "# comment\n0441 ;\t0063 ;\tMA\t# ( с → c ) CYRILLIC SMALL LETTER ES → LATIN SMALL LETTER C\n" +
+		"0410 ; 0041 ; MA\n" +
+		"FB00 ;\t0066 0066 ;\tMA\t# multi-character prototype skipped\n" +
+		"bad line\n"
+	assert.Equal(t, map[rune]rune{'с': 'c', 'А': 'a'}, parseLookalikes(data))
+	assert.True(t, len(parseLookalikes(lookalikes)) > 200)
+}
+
+func TestPrototypesUnique(t *testing.T) {
+	seen := parseLookalikes(lookalikes)
+	for proto, chars := range confusables {
+		for _, r := range chars {
+			if p, ok := seen[r]; ok {
+				t.Errorf("%q is a confusable of %q and %q", r, p, proto)
+			}
+			seen[r] = proto
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package confusable
+
+import (
+	"bufio"
+	_ "embed" // confusables data
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+//go:embed lookalikes.txt
+var lookalikes string
+
+// confusables lists lookalike characters missing in lookalikes.txt, mostly from the wtf! checker
+var confusables = map[rune]string{
+	'a': "ⓐ🅐🄰🅰ᴀ",
+	'b': "в",
+	'e': "εᴇ",
+	'f': "𐌅𖨝ϝʄꟻℲⅎƑƒᵮꞘꞙꬵꝻꝼ🄵🅵🅕Ⓕℱ𝕱Ｆⓕ𝕗𝔣𝓯𝖋ｆҒ🇫🄕⒡",
+	'h': "нҺ",
+	'k': "кⲕ",
+	'm': "мᴍϻ",
+	't': "τᴛⲧ丅𐤯𐊗ナߠϮϯꞱʇȶᵀ🅃🆃ᵗ🅣Ⓣ𝕿𝕋Ｔⓣ𝖙ꝉ🇹🄣⒯",
+	'w': "ᘺயʍⱳ🅆🆆ᵂʷ🅦Ⓦ𝓦𝙒𝖂Ｗⓦ𝑤𝕨𝖜ᷱｗꙍ🇼🄦⒲₩𝀥",
+	'y': "У",
+	'z': "ⲍ",
+}
+
+// prototypes is a lookup from confusable character to its lower-case prototype,
+// made once from lookalikes.txt and confusables table
+var prototypes = func() map[rune]rune {
+	res := parseLookalikes(lookalikes)
+	for proto, chars := range confusables {
+		for _, r := range chars {
+			res[r] = proto
+		}
+	}
+	return res
+}()
+
+// parseLookalikes reads lines "0441 ; 0063 ; MA # comment", only single character prototypes used
+func parseLookalikes(data string) map[rune]rune {
+	res := map[rune]rune{}
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Split(line, ";")
+		if len(fields) < 2 {
+			continue
+		}
+		src, err := strconv.ParseInt(strings.TrimSpace(fields[0]), 16, 32)
+		if err != nil {
+			continue
+		}
+		proto := strings.Fields(fields[1])
+		if len(proto) != 1 {
+			continue
+		}
+		dst, err := strconv.ParseInt(proto[0], 16, 32)
+		if err != nil {
+			continue
+		}
+		res[rune(src)] = unicode.ToLower(rune(dst))
+	}
+	return res
+}
@@ -0,0 +1,84 @@
+package events
+
+import (
+	"strings"
+
+	"github.com/radio-t/super-bot/app/bot"
+	"github.com/radio-t/super-bot/app/confusable"
+)
+
+// Impersonation detects users posing as super-users or the bot, with username or display name looking
+// like the protected username. Users looking like display names of super-users seen in the chat are suspects only,
+// as a regular member can have the same first and last name. Not thread safe, used by the listener only
+type Impersonation struct {
+	Names   []string // protected usernames, usually super-users and the bot
+	supers  map[string]bot.User
+	checked map[bot.User]impostor // empty name for good users
+}
+
+// impostor is a result of the user check
+type impostor struct {
+	name    string // protected name the user poses as
+	suspect bool   // looks like display name of super-user only, to be reviewed by super-users
+}
+
+// learn remembers super-user, to protect display name and to send alerts
+func (p *Impersonation) learn(user bot.User) {
+	if p.supers == nil {
+		p.supers = map[string]bot.User{}
+	}
+	key := strings.ToLower(user.Username)
+	if p.supers[key] != user {
+		p.supers[key] = user
+		p.checked = nil // display name changed, recheck everyone
+	}
+}
+
+// check returns protected name the user poses as, empty for good users. isNew is true on the first detection only
+func (p *Impersonation) check(user bot.User) (res impostor, isNew bool) {
+	if p.checked == nil || len(p.checked) > 10000 {
+		p.checked = map[bot.User]impostor{}
+	}
+	if res, found := p.checked[user]; found {
+		return res, false
+	}
+
+	res = p.poseAs(user)
+	p.checked[user] = res
+	return res, res.name != ""
+}
+
+func (p *Impersonation) poseAs(user bot.User) impostor {
+	for _, n := range p.Names {
+		if strings.EqualFold(user.Username, n) {
+			return impostor{} // the real one
+		}
+	}
+	for _, n := range p.Names {
+		if len([]rune(confusable.Key(n))) < 3 {
+			continue
+		}
+		if confusable.Equal(user.Username, n) || confusable.Equal(user.DisplayName, n) {
+			return impostor{name: "@" + n}
+		}
+	}
+	for _, su := range p.supers {
+		if len([]rune(confusable.Key(su.DisplayName))) < 3 {
+			continue
+		}
+		if confusable.Equal(user.DisplayName, su.DisplayName) || confusable.Equal(user.Username, su.DisplayName) {
+			return impostor{name: "@" + su.Username, suspect: true}
+		}
+	}
+	return impostor{}
+}
+
+// alertIDs returns private chat IDs of known super-users
+func (p *Impersonation) alertIDs() (res []int64) {
+	for _, su := range p.supers {
+		if su.ID != 0 {
+			res = append(res, int64(su.ID))
+		}
+	}
+	return res
+}
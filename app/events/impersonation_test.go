@@ -0,0 +1,98 @@
+package events
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	tbapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/radio-t/super-bot/app/bot"
+)
+
+func TestImpersonation_check(t *testing.T) {
+	p := Impersonation{Names: []string{"umputun", "bobuk", "rt_bot"}}
+	p.learn(bot.User{ID: 1, Username: "grayru", DisplayName: "Grigory Petrov"})
+
+	tbl := []struct {
+		user    bot.User
+		name    string
+		suspect bool
+	}{
+		{bot.User{Username: "umputun", DisplayName: "Umputun"}, "", false},
+		{bot.User{Username: "UMPUTUN"}, "", false},
+		{bot.User{Username: "umрutun_"}, "@umputun", false},
+		{bot.User{Username: "fan", DisplayName: "Ｕｍｐｕｔｕｎ"}, "@umputun", false},
+		{bot.User{Username: "fan", DisplayName: "Bobuk ✔"}, "@bobuk", false},
+		{bot.User{Username: "rt-bot"}, "@rt_bot", false},
+		{bot.User{Username: "scam", DisplayName: "Grigory Реtrоv"}, "@grayru", true},
+		{bot.User{Username: "grigory", DisplayName: "Grigory Petrov"}, "@grayru", true},
+		{bot.User{Username: "fan", DisplayName: "Umputun fan"}, "", false},
+		{bot.User{Username: "user", DisplayName: "Bob"}, "", false},
+	}
+	for i, tt := range tbl {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			imp, isNew := p.check(tt.user)
+			assert.Equal(t, impostor{name: tt.name, suspect: tt.suspect}, imp)
+			assert.Equal(t, tt.name != "", isNew)
+
+			imp, isNew = p.check(tt.user)
+			assert.Equal(t, tt.name, imp.name)
+			assert.False(t, isNew, "reported once")
+		})
+	}
+	assert.Equal(t, []int64{1}, p.alertIDs())
+}
+
+func TestTelegramListener_checkImpostor(t *testing.T) {
+	tbAPI := &mockTbAPI{}
+	sanctions := &bot.MockSanctionRecorder{}
+	l := TelegramListener{TbAPI: tbAPI, SuperUsers: SuperUser{"umputun"}, Sanctions: sanctions, SpamFlagChatID: 777,
+		Impersonation: &Impersonation{Names: []string{"umputun"}}}
+
+	assert.False(t, l.checkImpostor(bot.Message{Text: "hi", From: bot.User{ID: 1, Username: "umputun", DisplayName: "Umputun"}}))
+	assert.False(t, l.checkImpostor(bot.Message{Text: "hi", From: bot.User{ID: 2, Username: "user"}}))
+
+	impostor := bot.User{ID: 3, Username: "scam", DisplayName: "Umputun "}
+	msg := bot.Message{ID: 10, ChatID: 123, Text: "send me btc", From: impostor}
+	tbAPI.On("DeleteMessage", tbapi.DeleteMessageConfig{ChatID: 123, MessageID: 10}).
+		Return(tbapi.APIResponse{Ok: true}, nil).Once()
+	tbAPI.On("RestrictChatMember", mock.MatchedBy(func(c tbapi.RestrictChatMemberConfig) bool {
+		return c.UserID == 3 && c.UntilDate > time.Now().Add(366*24*time.Hour).Unix()
+	})).Return(tbapi.APIResponse{Ok: true}, nil).Once()
+	sanctions.On("Record", mock.MatchedBy(func(s bot.Sanction) bool {
+		return s.User == impostor && s.Action == bot.ActionMute && s.Issuer == "impersonation" && s.Until.IsZero()
+	})).Once()
+	report := "@scam \"Umputun\" (id 3) выдает себя за @umputun, сообщение удалено, пользователь ограничен\n\nsend me btc"
+	tbAPI.On("Send", tbapi.NewMessage(1, report)).Return(tbapi.Message{}, nil).Once()
+	tbAPI.On("Send", tbapi.NewMessage(777, report)).Return(tbapi.Message{}, nil).Once()
+	assert.True(t, l.checkImpostor(msg))
+
+	// next message deleted, no more alerts
+	tbAPI.On("DeleteMessage", tbapi.DeleteMessageConfig{ChatID: 123, MessageID: 11}).
+		Return(tbapi.APIResponse{Ok: true}, nil).Once()
+	msg.ID = 11
+	assert.True(t, l.checkImpostor(msg))
+
+	tbAPI.AssertExpectations(t)
+	sanctions.AssertExpectations(t)
+}
+
+func TestTelegramListener_checkImpostorSuspect(t *testing.T) {
+	tbAPI := &mockTbAPI{}
+	l := TelegramListener{TbAPI: tbAPI, SuperUsers: SuperUser{"umputun"}, SpamFlagChatID: 777,
+		Impersonation: &Impersonation{Names: []string{"umputun"}}}
+	assert.False(t, l.checkImpostor(bot.Message{Text: "hi", From: bot.User{ID: 1, Username: "umputun", DisplayName: "Евгений Ш"}}))
+
+	// same display name as super-user, alerted once, not deleted nor restricted
+	msg := bot.Message{ID: 10, ChatID: 123, Text: "привет", From: bot.User{ID: 3, Username: "evgeny", DisplayName: "Евгений Ш"}}
+	report := "@evgeny \"Евгений Ш\" (id 3) похож по имени на @umputun, проверьте\n\nпривет"
+	tbAPI.On("Send", tbapi.NewMessage(1, report)).Return(tbapi.Message{}, nil).Once()
+	tbAPI.On("Send", tbapi.NewMessage(777, report)).Return(tbapi.Message{}, nil).Once()
+	assert.False(t, l.checkImpostor(msg))
+	msg.ID = 11
+	assert.False(t, l.checkImpostor(msg))
+	tbAPI.AssertExpectations(t)
+}
@@ -0,0 +1,113 @@
+package events
+
+import (
+	"log"
+	"time"
+
+	"github.com/radio-t/super-bot/app/bot"
+)
+
+// Lockdown freezes the chat during raids. Turned on by super-user's lockdown! command or automatically,
+// when joins or messages rate crosses the threshold. Telegram API used by the bot has no chat-wide
+// permissions, so the listener restricts every not super-user who posts while the lockdown is active,
+// and releases them if the lockdown lifted before the end
+type Lockdown struct {
+	Duration    time.Duration // lockdown duration for auto mode and the command without duration
+	JoinRate    int           // joins per Window to turn on automatically, 0 disables
+	MessageRate int           // messages per Window to turn on automatically, 0 disables
+	Window      time.Duration // rate window, default 1 minute
+
+	until      time.Time
+	joins      []time.Time
+	msgs       []time.Time
+	restricted []bot.User // users restricted during the lockdown
+}
+
+// activate turns lockdown on till now+duration, returns the end of lockdown
+func (d *Lockdown) activate(now time.Time, duration time.Duration) time.Time {
+	if duration <= 0 {
+		duration = d.Duration
+	}
+	if duration <= 0 {
+		duration = 15 * time.Minute
+	}
+	d.until = now.Add(duration)
+	d.joins, d.msgs = nil, nil
+	log.Printf("[INFO] lockdown till %v", d.until)
+	return d.until
+}
+
+// lift turns lockdown off, returns false if it wasn't active
+func (d *Lockdown) lift() bool {
+	if d.until.IsZero() {
+		return false
+	}
+	d.until = time.Time{}
+	log.Print("[INFO] lockdown lifted")
+	return true
+}
+
+// restrict remembers user restricted during the lockdown
+func (d *Lockdown) restrict(user bot.User) {
+	for _, u := range d.restricted {
+		if u.ID == user.ID {
+			return
+		}
+	}
+	d.restricted = append(d.restricted, user)
+}
+
+// release returns users restricted during the lockdown and forgets them
+func (d *Lockdown) release() []bot.User {
+	res := d.restricted
+	d.restricted = nil
+	return res
+}
+
+// active checks if the chat is locked
+func (d *Lockdown) active(now time.Time) bool {
+	return !d.until.IsZero() && now.Before(d.until)
+}
+
+// expired returns true once, when active lockdown is over
+func (d *Lockdown) expired(now time.Time) bool {
+	if d.until.IsZero() || now.Before(d.until) {
+		return false
+	}
+	return d.lift()
+}
+
+// count registers joins and messages, returns true if the rate crossed threshold
+func (d *Lockdown) count(now time.Time, joins int, message bool) bool {
+	window := d.Window
+	if window == 0 {
+		window = time.Minute
+	}
+	recent := func(ts []time.Time) []time.Time {
+		res := ts[:0]
+		for _, t := range ts {
+			if now.Sub(t) < window {
+				res = append(res, t)
+			}
+		}
+		return res
+	}
+
+	d.joins, d.msgs = recent(d.joins), recent(d.msgs)
+	for i := 0; i < joins; i++ {
+		d.joins = append(d.joins, now)
+	}
+	if message {
+		d.msgs = append(d.msgs, now)
+	}
+
+	if d.JoinRate > 0 && len(d.joins) >= d.JoinRate {
+		log.Printf("[WARN] join rate %d per %v", len(d.joins), window)
+		return true
+	}
+	if d.MessageRate > 0 && len(d.msgs) >= d.MessageRate {
+		log.Printf("[WARN] message rate %d per %v", len(d.msgs), window)
+		return true
+	}
+	return false
+}
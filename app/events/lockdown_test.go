@@ -0,0 +1,127 @@
+package events
+
+import (
+	"testing"
+	"time"
+
+	tbapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+
+	"github.com/radio-t/super-bot/app/bot"
+)
+
+func TestLockdown_activate(t *testing.T) {
+	d := Lockdown{Duration: 10 * time.Minute}
+	now := time.Date(2021, 3, 6, 18, 0, 0, 0, time.UTC)
+
+	assert.False(t, d.active(now))
+	assert.False(t, d.expired(now))
+	assert.False(t, d.lift())
+
+	assert.Equal(t, now.Add(10*time.Minute), d.activate(now, 0), "default duration")
+	assert.True(t, d.active(now.Add(5*time.Minute)))
+	assert.False(t, d.expired(now.Add(5*time.Minute)))
+	assert.True(t, d.expired(now.Add(10*time.Minute)))
+	assert.False(t, d.expired(now.Add(11*time.Minute)), "reported once")
+	assert.False(t, d.active(now.Add(11*time.Minute)))
+
+	assert.Equal(t, now.Add(time.Hour), d.activate(now, time.Hour))
+	assert.True(t, d.lift())
+	assert.False(t, d.active(now))
+}
+
+func TestLockdown_count(t *testing.T) {
+	d := Lockdown{JoinRate: 3, MessageRate: 5, Window: time.Minute}
+	now := time.Date(2021, 3, 6, 18, 0, 0, 0, time.UTC)
+
+	assert.False(t, d.count(now, 2, false))
+	assert.False(t, d.count(now.Add(61*time.Second), 2, false), "old joins dropped")
+	assert.True(t, d.count(now.Add(62*time.Second), 1, false))
+
+	for i := 0; i < 4; i++ {
+		assert.False(t, d.count(now.Add(5*time.Minute), 0, true))
+	}
+	assert.True(t, d.count(now.Add(5*time.Minute), 0, true))
+
+	disabled := Lockdown{}
+	assert.False(t, disabled.count(now, 100, true))
+}
+
+func TestTelegramListener_checkLockdown(t *testing.T) {
+	tbAPI := &mockTbAPI{}
+	msgLogger := &mockMsgLogger{}
+	sanctions := &bot.MockSanctionRecorder{}
+	l := TelegramListener{TbAPI: tbAPI, MsgLogger: msgLogger, SuperUsers: SuperUser{"admin_1"}, Sanctions: sanctions,
+		chatID: 123, AllActivityTerm: Terminator{BanDuration: time.Minute, BanPenalty: 10}}
+	msgLogger.On("Save", mock.Anything)
+	tbAPI.On("Send", mock.MatchedBy(func(c tbapi.MessageConfig) bool {
+		return c.ChatID == 123 && c.Text == "🔒 чат закрыт на 15мин, писать могут только ведущие (@admin\\_1)"
+	})).Return(tbapi.Message{}, nil).Once()
+
+	assert.False(t, l.checkLockdown(bot.Message{Text: "lockdown!", From: bot.User{Username: "user"}}, 123, 0))
+	assert.True(t, l.checkLockdown(bot.Message{Text: "lockdown! 15m", From: bot.User{Username: "admin_1"}}, 123, 0))
+	assert.True(t, l.AllActivityTerm.strict)
+
+	tbAPI.On("DeleteMessage", tbapi.DeleteMessageConfig{ChatID: 123, MessageID: 10}).
+		Return(tbapi.APIResponse{Ok: true}, nil).Once()
+	tbAPI.On("RestrictChatMember", mock.MatchedBy(func(c tbapi.RestrictChatMemberConfig) bool {
+		return c.ChatID == 123 && c.UserID == 1 && c.UntilDate > time.Now().Add(14*time.Minute).Unix()
+	})).Return(tbapi.APIResponse{Ok: true}, nil).Once()
+	sanctions.On("Record", mock.MatchedBy(func(s bot.Sanction) bool {
+		return s.User.ID == 1 && s.Action == bot.ActionMute && s.Issuer == "lockdown"
+	})).Once()
+	assert.True(t, l.checkLockdown(bot.Message{ID: 10, Text: "raid", From: bot.User{ID: 1, Username: "user"}}, 123, 0))
+	assert.False(t, l.checkLockdown(bot.Message{Text: "hi", From: bot.User{Username: "admin_1"}}, 123, 0), "super can post")
+	assert.False(t, l.checkLockdown(bot.Message{Text: "hi", From: bot.User{ID: 1}}, 456, 0), "other chat")
+
+	tbAPI.On("Send", mock.MatchedBy(func(c tbapi.MessageConfig) bool {
+		return c.ChatID == 123 && c.Text == "🔓 чат снова открыт"
+	})).Return(tbapi.Message{}, nil).Once()
+	tbAPI.On("RestrictChatMember", mock.MatchedBy(func(c tbapi.RestrictChatMemberConfig) bool {
+		return c.ChatID == 123 && c.UserID == 1 && *c.CanSendMessages && c.UntilDate == 0
+	})).Return(tbapi.APIResponse{Ok: true}, nil).Once()
+	sanctions.On("Record", mock.MatchedBy(func(s bot.Sanction) bool {
+		return s.User.ID == 1 && s.Action == bot.ActionUnmute && s.Issuer == "lockdown"
+	})).Once()
+	assert.True(t, l.checkLockdown(bot.Message{Text: "lockdown! off", From: bot.User{Username: "admin_1"}}, 123, 0))
+	assert.Empty(t, l.Lockdown.restricted, "restricted users released")
+	assert.False(t, l.AllActivityTerm.strict)
+	assert.False(t, l.checkLockdown(bot.Message{Text: "hi", From: bot.User{ID: 1}}, 123, 0))
+
+	tbAPI.AssertExpectations(t)
+	sanctions.AssertExpectations(t)
+}
+
+func TestTelegramListener_unlockExpired(t *testing.T) {
+	tbAPI := &mockTbAPI{}
+	msgLogger := &mockMsgLogger{}
+	l := TelegramListener{TbAPI: tbAPI, MsgLogger: msgLogger, chatID: 123}
+	msgLogger.On("Save", mock.Anything)
+	l.Lockdown.activate(time.Now(), time.Minute)
+	l.Lockdown.restrict(bot.User{ID: 1})
+	l.Lockdown.restrict(bot.User{ID: 1})
+	assert.Equal(t, 1, len(l.Lockdown.restricted))
+
+	tbAPI.On("Send", mock.Anything).Return(tbapi.Message{}, nil).Once()
+	l.unlock(false)
+	assert.Empty(t, l.Lockdown.restricted)
+	tbAPI.AssertNotCalled(t, "RestrictChatMember", mock.Anything)
+	tbAPI.AssertExpectations(t)
+}
+
+func TestTelegramListener_checkLockdownAuto(t *testing.T) {
+	tbAPI := &mockTbAPI{}
+	msgLogger := &mockMsgLogger{}
+	l := TelegramListener{TbAPI: tbAPI, MsgLogger: msgLogger, chatID: 123,
+		Lockdown: Lockdown{JoinRate: 5, Duration: time.Hour}}
+	msgLogger.On("Save", mock.Anything)
+	tbAPI.On("Send", mock.MatchedBy(func(c tbapi.MessageConfig) bool {
+		return c.Text == "🔒 чат закрыт на 1ч, писать могут только ведущие (слишком много новых участников или сообщений)"
+	})).Return(tbapi.Message{}, nil).Once()
+
+	assert.False(t, l.checkLockdown(bot.Message{From: bot.User{ID: 1}}, 123, 3))
+	assert.False(t, l.checkLockdown(bot.Message{From: bot.User{ID: 2}}, 123, 2), "joins not restricted")
+	assert.True(t, l.Lockdown.active(time.Now()))
+	tbAPI.AssertExpectations(t)
+}
@@ -12,6 +12,48 @@ type mockTbAPI struct {
 	mock.Mock
 }
 
+// AnswerCallbackQuery provides a mock function with given fields: config
+func (_m *mockTbAPI) AnswerCallbackQuery(config tgbotapi.CallbackConfig) (tgbotapi.APIResponse, error) {
+	ret := _m.Called(config)
+
+	var r0 tgbotapi.APIResponse
+	if rf, ok := ret.Get(0).(func(tgbotapi.CallbackConfig) tgbotapi.APIResponse); ok {
+		r0 = rf(config)
+	} else {
+		r0 = ret.Get(0).(tgbotapi.APIResponse)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(tgbotapi.CallbackConfig) error); ok {
+		r1 = rf(config)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// DeleteMessage provides a mock function with given fields: config
+func (_m *mockTbAPI) DeleteMessage(config tgbotapi.DeleteMessageConfig) (tgbotapi.APIResponse, error) {
+	ret := _m.Called(config)
+
+	var r0 tgbotapi.APIResponse
+	if rf, ok := ret.Get(0).(func(tgbotapi.DeleteMessageConfig) tgbotapi.APIResponse); ok {
+		r0 = rf(config)
+	} else {
+		r0 = ret.Get(0).(tgbotapi.APIResponse)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(tgbotapi.DeleteMessageConfig) error); ok {
+		r1 = rf(config)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // GetChat provides a mock function with given fields: config
 func (_m *mockTbAPI) GetChat(config tgbotapi.ChatConfig) (tgbotapi.Chat, error) {
 	ret := _m.Called(config)
@@ -56,6 +98,27 @@ func (_m *mockTbAPI) GetUpdatesChan(config tgbotapi.UpdateConfig) (tgbotapi.Upda
 	return r0, r1
 }
 
+// KickChatMember provides a mock function with given fields: config
+func (_m *mockTbAPI) KickChatMember(config tgbotapi.KickChatMemberConfig) (tgbotapi.APIResponse, error) {
+	ret := _m.Called(config)
+
+	var r0 tgbotapi.APIResponse
+	if rf, ok := ret.Get(0).(func(tgbotapi.KickChatMemberConfig) tgbotapi.APIResponse); ok {
+		r0 = rf(config)
+	} else {
+		r0 = ret.Get(0).(tgbotapi.APIResponse)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(tgbotapi.KickChatMemberConfig) error); ok {
+		r1 = rf(config)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // PinChatMessage provides a mock function with given fields: config
 func (_m *mockTbAPI) PinChatMessage(config tgbotapi.PinChatMessageConfig) (tgbotapi.APIResponse, error) {
 	ret := _m.Called(config)
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"log"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -13,10 +14,13 @@ import (
 	"github.com/pkg/errors"
 
 	"github.com/radio-t/super-bot/app/bot"
+	"github.com/radio-t/super-bot/app/spam"
 )
 
 //go:generate mockery -inpkg -name tbAPI -case snake
 //go:generate mockery -inpkg -name msgLogger -case snake
+//go:generate mockery -inpkg -name spamDetector -case snake
+//go:generate mockery -inpkg -name auditLog -case snake
 
 // TelegramListener listens to tg update, forward to bots and send back responses
 // Not thread safe
@@ -31,14 +35,32 @@ type TelegramListener struct {
 	BotsActivityTerm       Terminator // bot-only activity for given user
 	OverallBotActivityTerm Terminator // bot-only activity for all users
 	SuperUsers             SuperUser
+	SpamDetector           spamDetector                   // optional, scores messages posted to the group
+	SpamAudit              auditLog                       // optional, records anti-spam and captcha decisions
+	SpamBanDuration        time.Duration                  // restrict spammer for the duration, zero to kick
+	SpamFlagChatID         int64                          // optional, admins chat to report suspicious messages
+	Sanctions              bot.SanctionRecorder           // optional, registry of bans made by the listener
+	Lockdown               Lockdown                       // raid mode, restricts everyone but super-users
+	Welcome                *Welcome                       // optional, greets and verifies new members
+	Impersonation          *Impersonation                 // optional, restricts users posing as super-users or the bot
+	Broadcast              bot.BroadcastState             // optional, switches to LiveLimits during the broadcast
+	LiveLimits             Limits                         // activity limits for the broadcast, zero terminator keeps the normal one
+	Callbacks              map[string]bot.CallbackHandler // optional, inline buttons handlers by data prefix, i.e. "search"
+	live                   bool
 	chatID                 int64
 
 	msgs struct {
 		once sync.Once
-		ch   chan bot.Response
+		ch   chan submission
 	}
 }
 
+// submission is a response pushed by outside clients, zero chatID means the primary group
+type submission struct {
+	chatID int64
+	resp   bot.Response
+}
+
 type tbAPI interface {
 	GetUpdatesChan(config tbapi.UpdateConfig) (tbapi.UpdatesChannel, error)
 	Send(c tbapi.Chattable) (tbapi.Message, error)
@@ -46,12 +68,35 @@ type tbAPI interface {
 	UnpinChatMessage(config tbapi.UnpinChatMessageConfig) (tbapi.APIResponse, error)
 	GetChat(config tbapi.ChatConfig) (tbapi.Chat, error)
 	RestrictChatMember(config tbapi.RestrictChatMemberConfig) (tbapi.APIResponse, error)
+	KickChatMember(config tbapi.KickChatMemberConfig) (tbapi.APIResponse, error)
+	DeleteMessage(config tbapi.DeleteMessageConfig) (tbapi.APIResponse, error)
+	AnswerCallbackQuery(config tbapi.CallbackConfig) (tbapi.APIResponse, error)
 }
 
 type msgLogger interface {
 	Save(msg *bot.Message)
 }
 
+type spamDetector interface {
+	Check(msg bot.Message) spam.Result
+}
+
+type auditLog interface {
+	Append(v interface{}) error
+}
+
+// SpamDecision is an audit record of anti-spam check
+type SpamDecision struct {
+	Time   time.Time
+	ChatID int64
+	MsgID  int
+	User   bot.User
+	Text   string
+	spam.Result
+	Action string // none, flagged, deleted, restricted or kicked
+	Error  string `json:",omitempty"`
+}
+
 // Do process all events, blocked call
 func (l *TelegramListener) Do(ctx context.Context) (err error) {
 	log.Printf("[INFO] start telegram listener for %q", l.Group)
@@ -61,7 +106,7 @@ func (l *TelegramListener) Do(ctx context.Context) (err error) {
 	}
 
 	l.msgs.once.Do(func() {
-		l.msgs.ch = make(chan bot.Response, 100)
+		l.msgs.ch = make(chan submission, 100)
 		if l.IdleDuration == 0 {
 			l.IdleDuration = 30 * time.Second
 		}
@@ -86,6 +131,14 @@ func (l *TelegramListener) Do(ctx context.Context) (err error) {
 				return errors.Errorf("telegram update chan closed")
 			}
 
+			l.expireCaptcha(time.Now())
+			l.switchLimits()
+
+			if update.CallbackQuery != nil {
+				l.onCallback(update.CallbackQuery)
+				continue
+			}
+
 			if update.Message == nil {
 				log.Print("[DEBUG] empty message body")
 				continue
@@ -106,16 +159,36 @@ func (l *TelegramListener) Do(ctx context.Context) (err error) {
 			fromChat := update.Message.Chat.ID
 
 			msg := l.transform(update.Message)
+			log.Printf("[DEBUG] incoming msg: %+v", msg)
+
+			joins := 0
+			if update.Message.NewChatMembers != nil {
+				joins = len(*update.Message.NewChatMembers)
+			}
+			if l.checkLockdown(*msg, fromChat, joins) {
+				continue
+			}
+
+			if fromChat == l.chatID && joins > 0 {
+				l.greet(update.Message)
+			}
+
+			if fromChat == l.chatID && l.checkImpostor(*msg) {
+				continue
+			}
+
+			if fromChat == l.chatID && l.checkSpam(*msg) {
+				continue // deleted spam is not reported and not learned as ham
+			}
+
 			if fromChat == l.chatID {
 				l.MsgLogger.Save(msg) // save an incoming update to report
 			}
 
-			log.Printf("[DEBUG] incoming msg: %+v", msg)
-
 			// check for all-activity ban
 			if b := l.AllActivityTerm.check(msg.From, msg.Sent); b.active {
 				if b.new && !l.SuperUsers.IsSuper(update.Message.From.UserName) {
-					if err := l.applyBan(*msg, l.AllActivityTerm.BanDuration, fromChat, update.Message.From.ID); err != nil {
+					if err := l.applyBan(*msg, l.AllActivityTerm.duration(), fromChat, update.Message.From.ID, "all activity"); err != nil {
 						log.Printf("[ERROR] can't ban, %v", err)
 					}
 				}
@@ -134,20 +207,25 @@ func (l *TelegramListener) Do(ctx context.Context) (err error) {
 			}
 
 			// some bots may request direct ban for given duration
-			if resp.Send && resp.BanInterval > 0 && !l.SuperUsers.IsSuper(update.Message.From.UserName) {
-				if err := l.banUser(resp.BanInterval, fromChat, update.Message.From.ID); err != nil {
-					log.Printf("[ERROR] can't ban %v on bot response, %v", msg.From, err)
-				} else {
-					log.Printf("[INFO] %v banned by bot for %v", msg.From, resp.BanInterval)
-				}
+			if resp.Send && (resp.BanInterval > 0 || resp.Kick) {
+				l.botBan(resp, *msg, fromChat)
 			}
 
-		case resp := <-l.msgs.ch: // publish messages from outside clients
-			if err := l.sendBotResponse(resp, l.chatID); err != nil {
-				log.Printf("[WARN] failed to respond on rtjc event, %v", err)
+		case sub := <-l.msgs.ch: // publish messages from outside clients
+			chatID := sub.chatID
+			if chatID == 0 {
+				chatID = l.chatID
+			}
+			if err := l.sendBotResponse(sub.resp, chatID); err != nil {
+				log.Printf("[WARN] failed to respond on submitted event, %v", err)
 			}
 
 		case <-time.After(l.IdleDuration): // hit bots on idle timeout
+			if l.Lockdown.expired(time.Now()) {
+				l.unlock(false)
+			}
+			l.expireCaptcha(time.Now())
+			l.switchLimits()
 			resp := l.Bots.OnMessage(bot.Message{Text: "idle"})
 			if err := l.sendBotResponse(resp, l.chatID); err != nil {
 				log.Printf("[WARN] failed to respond on idle, %v", err)
@@ -156,6 +234,40 @@ func (l *TelegramListener) Do(ctx context.Context) (err error) {
 	}
 }
 
+// botBan restricts or kicks the user on bot's request. The target is the message author,
+// or the user set by bot on super-user's command
+func (l *TelegramListener) botBan(resp bot.Response, msg bot.Message, chatID int64) {
+	target, issuer := msg.From, "bot"
+	if resp.BanTarget != nil {
+		if !l.SuperUsers.IsSuper(msg.From.Username) {
+			log.Printf("[WARN] ban of %v requested by not super %v", resp.BanTarget, msg.From)
+			return
+		}
+		target, issuer = *resp.BanTarget, "@"+msg.From.Username
+	}
+	if l.SuperUsers.IsSuper(target.Username) {
+		return
+	}
+
+	if resp.Kick {
+		if err := l.kickUser(chatID, target.ID); err != nil {
+			log.Printf("[ERROR] can't kick %v on bot response, %v", target, err)
+			return
+		}
+		log.Printf("[INFO] %v kicked by bot", target)
+		l.record(bot.Sanction{ChatID: chatID, User: target, Action: bot.ActionKick, Issuer: issuer, Reason: msg.Text})
+		return
+	}
+
+	if err := l.banUser(resp.BanInterval, chatID, target.ID); err != nil {
+		log.Printf("[ERROR] can't ban %v on bot response, %v", target, err)
+		return
+	}
+	log.Printf("[INFO] %v banned by bot for %v", target, resp.BanInterval)
+	l.record(bot.Sanction{ChatID: chatID, User: target, Action: bot.ActionMute, Issuer: issuer, Reason: msg.Text,
+		Until: time.Now().Add(resp.BanInterval)})
+}
+
 func (l *TelegramListener) botActivityBan(resp bot.Response, msg bot.Message, fromChat int64, fromID int) bool {
 	if !resp.Send {
 		return false
@@ -164,7 +276,7 @@ func (l *TelegramListener) botActivityBan(resp bot.Response, msg bot.Message, fr
 	// check for bot-activity ban for given users
 	if b := l.BotsActivityTerm.check(msg.From, msg.Sent); b.active {
 		if b.new {
-			if err := l.applyBan(msg, l.BotsActivityTerm.BanDuration, fromChat, fromID); err != nil {
+			if err := l.applyBan(msg, l.BotsActivityTerm.duration(), fromChat, fromID, "bots activity"); err != nil {
 				log.Printf("[ERROR] can't ban, %v", err)
 			}
 		}
@@ -174,7 +286,7 @@ func (l *TelegramListener) botActivityBan(resp bot.Response, msg bot.Message, fr
 	// check for bot-activity ban for all users
 	if b := l.OverallBotActivityTerm.check(bot.User{}, msg.Sent); b.active {
 		if b.new {
-			if err := l.applyBan(msg, l.BotsActivityTerm.BanDuration, fromChat, fromID); err != nil {
+			if err := l.applyBan(msg, l.OverallBotActivityTerm.duration(), fromChat, fromID, "overall bots activity"); err != nil {
 				log.Printf("[ERROR] can't ban, %v", err)
 			}
 		}
@@ -194,6 +306,9 @@ func (l *TelegramListener) sendBotResponse(resp bot.Response, chatID int64) erro
 	tbMsg := tbapi.NewMessage(chatID, resp.Text)
 	tbMsg.ParseMode = tbapi.ModeMarkdown
 	tbMsg.DisableWebPagePreview = !resp.Preview
+	if kb := inlineKeyboard(resp.Buttons); kb != nil {
+		tbMsg.ReplyMarkup = *kb
+	}
 	res, err := l.TbAPI.Send(tbMsg)
 	if err != nil {
 		return errors.Wrapf(err, "can't send message to telegram %q", resp.Text)
@@ -218,7 +333,7 @@ func (l *TelegramListener) sendBotResponse(resp bot.Response, chatID int64) erro
 	return nil
 }
 
-func (l *TelegramListener) applyBan(msg bot.Message, duration time.Duration, chatID int64, userID int) error {
+func (l *TelegramListener) applyBan(msg bot.Message, duration time.Duration, chatID int64, userID int, reason string) error {
 	mention := "@" + msg.From.Username
 	if msg.From.Username == "" {
 		mention = msg.From.DisplayName
@@ -228,18 +343,484 @@ func (l *TelegramListener) applyBan(msg bot.Message, duration time.Duration, cha
 	if err := l.sendBotResponse(bot.Response{Text: m, Send: true}, chatID); err != nil {
 		return errors.Wrapf(err, "failed to send ban message for %v", msg.From)
 	}
-	err := l.banUser(duration, chatID, userID)
-	return errors.Wrapf(err, "failed to ban user %v", msg.From)
+	if err := l.banUser(duration, chatID, userID); err != nil {
+		return errors.Wrapf(err, "failed to ban user %v", msg.From)
+	}
+	l.record(bot.Sanction{ChatID: chatID, User: msg.From, Action: bot.ActionMute, Issuer: "terminator", Reason: reason,
+		Until: time.Now().Add(duration)})
+	return nil
+}
+
+// checkLockdown handles lockdown! command of super-users, turns lockdown on by joins and messages rate,
+// and restricts not super-users posting to the locked chat. Returns true if the message is handled
+func (l *TelegramListener) checkLockdown(msg bot.Message, fromChat int64, joins int) bool {
+	now := time.Now()
+	if l.Lockdown.expired(now) {
+		l.unlock(false)
+	}
+
+	super := l.SuperUsers.IsSuper(msg.From.Username)
+	if super && strings.HasPrefix(strings.ToLower(strings.TrimSpace(msg.Text)), "lockdown!") {
+		l.lockdownCommand(msg, fromChat)
+		return true
+	}
+	if fromChat != l.chatID || super {
+		return false
+	}
+
+	if !l.Lockdown.active(now) && l.Lockdown.count(now, joins, joins == 0) {
+		l.lock(now, 0, "слишком много новых участников или сообщений")
+	}
+	if !l.Lockdown.active(now) || joins > 0 {
+		return false
+	}
+
+	resp, err := l.TbAPI.DeleteMessage(tbapi.DeleteMessageConfig{ChatID: fromChat, MessageID: msg.ID})
+	if err != nil || !resp.Ok {
+		log.Printf("[WARN] can't delete message %d in lockdown, %v %s", msg.ID, err, string(resp.Result))
+	}
+	if err = l.banUser(l.Lockdown.until.Sub(now), fromChat, msg.From.ID); err != nil {
+		log.Printf("[WARN] can't restrict %v in lockdown, %v", msg.From, err)
+		return true
+	}
+	l.Lockdown.restrict(msg.From)
+	l.record(bot.Sanction{ChatID: fromChat, User: msg.From, Action: bot.ActionMute, Issuer: "lockdown",
+		Reason: "lockdown", Until: l.Lockdown.until})
+	return true
+}
+
+// lockdownCommand turns lockdown on for the given or default duration, "lockdown! off" lifts it
+func (l *TelegramListener) lockdownCommand(msg bot.Message, fromChat int64) {
+	args := strings.Fields(msg.Text)[1:]
+	if len(args) > 0 && strings.EqualFold(args[0], "off") {
+		if l.Lockdown.lift() {
+			l.unlock(true)
+		}
+		return
+	}
+
+	var duration time.Duration
+	if len(args) > 0 {
+		d, err := time.ParseDuration(args[0])
+		if err != nil || d <= 0 {
+			if err = l.sendBotResponse(bot.Response{Text: "срок вида `15m` или `1h`", Send: true}, fromChat); err != nil {
+				log.Printf("[WARN] failed to respond on lockdown, %v", err)
+			}
+			return
+		}
+		duration = d
+	}
+	l.lock(time.Now(), duration, "@"+msg.From.Username)
+}
+
+// lock activates lockdown, tightens terminators and announces it
+func (l *TelegramListener) lock(now time.Time, duration time.Duration, reason string) {
+	until := l.Lockdown.activate(now, duration)
+	l.setStrict(true)
+	// no italics around the reason, it has escaped username and escaping inside entities not supported
+	text := fmt.Sprintf("🔒 чат закрыт на %s, писать могут только ведущие (%s)",
+		bot.HumanizeDuration(until.Sub(now)), bot.EscapeMarkDown(reason))
+	if err := l.sendBotResponse(bot.Response{Text: text, Send: true}, l.chatID); err != nil {
+		log.Printf("[WARN] failed to announce lockdown, %v", err)
+	}
+}
+
+// unlock restores terminators and announces the end of lockdown. Users restricted during lockdown
+// are released by telegram at the end of it, for lockdown lifted early they are released by the bot
+func (l *TelegramListener) unlock(early bool) {
+	l.setStrict(false)
+	for _, u := range l.Lockdown.release() {
+		if !early {
+			continue
+		}
+		if err := l.unrestrictUser(l.chatID, u.ID); err != nil {
+			log.Printf("[WARN] can't release %v after lockdown, %v", u, err)
+			continue
+		}
+		log.Printf("[INFO] %v released after lockdown", u)
+		l.record(bot.Sanction{ChatID: l.chatID, User: u, Action: bot.ActionUnmute, Issuer: "lockdown",
+			Reason: "lockdown lifted"})
+	}
+	if err := l.sendBotResponse(bot.Response{Text: "🔓 чат снова открыт", Send: true}, l.chatID); err != nil {
+		log.Printf("[WARN] failed to announce end of lockdown, %v", err)
+	}
+}
+
+// switchLimits swaps normal and live activity limits on broadcast status change
+func (l *TelegramListener) switchLimits() {
+	if l.Broadcast == nil {
+		return
+	}
+	live, _ := l.Broadcast.Live()
+	if live == l.live {
+		return
+	}
+	l.live = live
+	log.Printf("[INFO] broadcast live %v, switch activity limits", live)
+
+	swap := func(current, other *Terminator) {
+		if other.BanPenalty > 0 {
+			*current, *other = *other, *current
+		}
+	}
+	swap(&l.AllActivityTerm, &l.LiveLimits.AllActivityTerm)
+	swap(&l.BotsActivityTerm, &l.LiveLimits.BotsActivityTerm)
+	swap(&l.OverallBotActivityTerm, &l.LiveLimits.OverallBotActivityTerm)
+	l.setStrict(l.Lockdown.active(time.Now()))
+}
+
+func (l *TelegramListener) setStrict(strict bool) {
+	l.AllActivityTerm.strict = strict
+	l.BotsActivityTerm.strict = strict
+	l.OverallBotActivityTerm.strict = strict
+}
+
+// checkImpostor deletes message of user posing as super-user or the bot, restricts the user
+// and alerts super-users privately. Suspects, looking like super-user's display name only, are not restricted,
+// super-users alerted to review them. Returns true for impostor
+func (l *TelegramListener) checkImpostor(msg bot.Message) bool {
+	if l.Impersonation == nil {
+		return false
+	}
+	if l.SuperUsers.IsSuper(msg.From.Username) {
+		l.Impersonation.learn(msg.From)
+		return false
+	}
+	imp, isNew := l.Impersonation.check(msg.From)
+	if imp.name == "" {
+		return false
+	}
+
+	who := fmt.Sprintf("%q (id %d)", strings.TrimSpace(msg.From.DisplayName), msg.From.ID)
+	if msg.From.Username != "" {
+		who = fmt.Sprintf("@%s %s", msg.From.Username, who)
+	}
+	if imp.suspect {
+		if isNew {
+			log.Printf("[INFO] %v looks like %s", msg.From, imp.name)
+			l.alertImpostor(fmt.Sprintf("%s похож по имени на %s, проверьте", who, imp.name), msg)
+		}
+		return false
+	}
+
+	resp, err := l.TbAPI.DeleteMessage(tbapi.DeleteMessageConfig{ChatID: msg.ChatID, MessageID: msg.ID})
+	if err != nil || !resp.Ok {
+		log.Printf("[WARN] can't delete message %d of impostor, %v %s", msg.ID, err, string(resp.Result))
+	}
+	if !isNew {
+		return true
+	}
+
+	log.Printf("[WARN] %v poses as %s", msg.From, imp.name)
+	report := fmt.Sprintf("%s выдает себя за %s, сообщение удалено", who, imp.name)
+	// telegram treats restriction longer than 366 days as permanent
+	if err = l.banUser(367*24*time.Hour, msg.ChatID, msg.From.ID); err != nil {
+		log.Printf("[WARN] can't restrict impostor %v, %v", msg.From, err)
+		report += ", ограничить не удалось"
+	} else {
+		report += ", пользователь ограничен"
+		l.record(bot.Sanction{ChatID: msg.ChatID, User: msg.From, Action: bot.ActionMute, Issuer: "impersonation",
+			Reason: "poses as " + imp.name})
+	}
+	l.alertImpostor(report, msg)
+	return true
+}
+
+// alertImpostor sends report with the message to super-users privately and to the spam flag chat
+func (l *TelegramListener) alertImpostor(report string, msg bot.Message) {
+	chats := l.Impersonation.alertIDs()
+	if l.SpamFlagChatID != 0 {
+		chats = append(chats, l.SpamFlagChatID)
+	}
+	for _, chatID := range chats {
+		// no markdown, names are user's input
+		if _, err := l.TbAPI.Send(tbapi.NewMessage(chatID, report+"\n\n"+messageText(msg))); err != nil {
+			log.Printf("[WARN] can't alert %d about impostor, %v", chatID, err)
+		}
+	}
+}
+
+// greet sends welcome message to new members. Members added by super-users are trusted,
+// others restricted until pressing the captcha button
+func (l *TelegramListener) greet(m *tbapi.Message) {
+	if l.Welcome == nil {
+		return
+	}
+	approved := m.From != nil && l.SuperUsers.IsSuper(m.From.UserName)
+	for _, u := range *m.NewChatMembers {
+		if u.IsBot {
+			continue
+		}
+		user := bot.User{ID: u.ID, Username: u.UserName, DisplayName: strings.TrimSpace(u.FirstName + " " + u.LastName)}
+		if approved && m.From.ID != u.ID {
+			l.sendWelcome(m.Chat.ID, user, false)
+			l.audit(CaptchaDecision{Time: time.Now(), ChatID: m.Chat.ID, User: user, Action: "skipped"})
+			continue
+		}
+
+		if err := l.banUser(l.Welcome.Timeout+time.Minute, m.Chat.ID, u.ID); err != nil {
+			log.Printf("[WARN] can't restrict new member %v, %v", user, err)
+			continue
+		}
+		c, err := l.sendWelcome(m.Chat.ID, user, true)
+		if err != nil {
+			log.Printf("[WARN] %v", err)
+		}
+		l.Welcome.add(c)
+	}
+}
+
+// sendWelcome sends rules to the new member, with captcha button if needed
+func (l *TelegramListener) sendWelcome(chatID int64, user bot.User, withCaptcha bool) (captcha, error) {
+	c := captcha{user: user, chatID: chatID, deadline: time.Now().Add(l.Welcome.Timeout)}
+	text, err := l.Welcome.message(user)
+	if err != nil {
+		return c, err
+	}
+	c.text = text
+
+	tbMsg := tbapi.NewMessage(chatID, text)
+	tbMsg.ParseMode = tbapi.ModeMarkdown
+	tbMsg.DisableWebPagePreview = true
+	if withCaptcha {
+		tbMsg.ReplyMarkup = tbapi.NewInlineKeyboardMarkup(tbapi.NewInlineKeyboardRow(
+			tbapi.NewInlineKeyboardButtonData("👋 я не бот", fmt.Sprintf("captcha:%d", user.ID))))
+	}
+	res, err := l.TbAPI.Send(tbMsg)
+	if err != nil {
+		return c, errors.Wrapf(err, "can't send welcome message to %v", user)
+	}
+	l.saveBotMessage(&res, chatID)
+	c.msgID = res.MessageID
+	return c, nil
+}
+
+// onCallback handles inline buttons presses, dispatched by prefix of the button's data
+func (l *TelegramListener) onCallback(cq *tbapi.CallbackQuery) {
+	answer := ""
+	prefix := strings.SplitN(cq.Data, ":", 2)[0]
+	switch {
+	case prefix == "captcha":
+		answer = l.passCaptcha(cq)
+	case l.Callbacks[prefix] != nil:
+		answer = l.botCallback(l.Callbacks[prefix], cq)
+	}
+	if _, err := l.TbAPI.AnswerCallbackQuery(tbapi.NewCallback(cq.ID, answer)); err != nil {
+		log.Printf("[WARN] can't answer callback, %v", err)
+	}
+}
+
+// botCallback passes the button press to the bot and replaces the message with bot's response
+func (l *TelegramListener) botCallback(h bot.CallbackHandler, cq *tbapi.CallbackQuery) string {
+	if cq.From == nil || cq.Message == nil || cq.Message.Chat == nil {
+		return ""
+	}
+	resp, answer := h.OnCallback(bot.Callback{
+		Data: cq.Data,
+		From: bot.User{ID: cq.From.ID, Username: cq.From.UserName,
+			DisplayName: strings.TrimSpace(cq.From.FirstName + " " + cq.From.LastName)},
+		ChatID: cq.Message.Chat.ID,
+		MsgID:  cq.Message.MessageID,
+	})
+	if !resp.Send {
+		return answer
+	}
+
+	edit := tbapi.NewEditMessageText(cq.Message.Chat.ID, cq.Message.MessageID, resp.Text)
+	edit.ParseMode = tbapi.ModeMarkdown
+	edit.DisableWebPagePreview = !resp.Preview
+	edit.ReplyMarkup = inlineKeyboard(resp.Buttons)
+	if _, err := l.TbAPI.Send(edit); err != nil {
+		log.Printf("[WARN] can't edit message %d on callback, %v", cq.Message.MessageID, err)
+	}
+	return answer
+}
+
+// inlineKeyboard makes a row of inline buttons, nil if no buttons
+func inlineKeyboard(buttons []bot.Button) *tbapi.InlineKeyboardMarkup {
+	if len(buttons) == 0 {
+		return nil
+	}
+	row := make([]tbapi.InlineKeyboardButton, 0, len(buttons))
+	for _, b := range buttons {
+		row = append(row, tbapi.NewInlineKeyboardButtonData(b.Text, b.Data))
+	}
+	kb := tbapi.NewInlineKeyboardMarkup(row)
+	return &kb
+}
+
+// passCaptcha lifts restriction of the new member pressed own button and removes the button
+func (l *TelegramListener) passCaptcha(cq *tbapi.CallbackQuery) string {
+	userID, err := strconv.Atoi(strings.TrimPrefix(cq.Data, "captcha:"))
+	if err != nil || l.Welcome == nil {
+		return ""
+	}
+	if cq.From == nil || cq.From.ID != userID {
+		return "это не твоя кнопка"
+	}
+	c, ok := l.Welcome.pass(userID)
+	if !ok {
+		return "проверка уже не нужна"
+	}
+
+	decision := CaptchaDecision{Time: time.Now(), ChatID: c.chatID, User: c.user, Action: "passed"}
+	if err = l.unrestrictUser(c.chatID, userID); err != nil {
+		log.Printf("[WARN] can't lift restriction of %v, %v", c.user, err)
+		decision.Error = fmt.Sprintf("can't lift restriction, %v", err)
+	}
+	l.audit(decision)
+
+	edit := tbapi.NewEditMessageText(c.chatID, c.msgID, c.text)
+	edit.ParseMode = tbapi.ModeMarkdown
+	edit.DisableWebPagePreview = true
+	if _, err = l.TbAPI.Send(edit); err != nil {
+		log.Printf("[WARN] can't remove captcha button, %v", err)
+	}
+	log.Printf("[INFO] %v passed captcha", c.user)
+	return "добро пожаловать!"
+}
+
+// expireCaptcha kicks new members not pressed the button in time and removes their welcome messages
+func (l *TelegramListener) expireCaptcha(now time.Time) {
+	if l.Welcome == nil {
+		return
+	}
+	for _, c := range l.Welcome.expired(now) {
+		decision := CaptchaDecision{Time: now, ChatID: c.chatID, User: c.user, Action: "kicked"}
+		if err := l.kickUser(c.chatID, c.user.ID); err != nil {
+			log.Printf("[WARN] can't kick %v on captcha timeout, %v", c.user, err)
+			decision.Error = err.Error()
+		} else {
+			log.Printf("[INFO] %v kicked on captcha timeout", c.user)
+			l.record(bot.Sanction{ChatID: c.chatID, User: c.user, Action: bot.ActionKick, Issuer: "captcha",
+				Reason: "no captcha answer"})
+		}
+		l.audit(decision)
+
+		if c.msgID == 0 {
+			continue
+		}
+		if _, err := l.TbAPI.DeleteMessage(tbapi.DeleteMessageConfig{ChatID: c.chatID, MessageID: c.msgID}); err != nil {
+			log.Printf("[WARN] can't delete welcome message %d, %v", c.msgID, err)
+		}
+	}
+}
+
+// audit saves anti-abuse decision, if audit log defined
+func (l *TelegramListener) audit(v interface{}) {
+	if l.SpamAudit == nil {
+		return
+	}
+	if err := l.SpamAudit.Append(v); err != nil {
+		log.Printf("[WARN] can't save audit record, %v", err)
+	}
+}
+
+// record passes moderation action to the registry, if any
+func (l *TelegramListener) record(s bot.Sanction) {
+	if l.Sanctions != nil {
+		l.Sanctions.Record(s)
+	}
+}
+
+// checkSpam scores the message, deletes spam and restricts or kicks the author. Returns true for spam
+func (l *TelegramListener) checkSpam(msg bot.Message) bool {
+	if l.SpamDetector == nil || l.SuperUsers.IsSuper(msg.From.Username) {
+		return false
+	}
+	res := l.SpamDetector.Check(msg)
+	if res.Score == 0 {
+		return false
+	}
+
+	text := messageText(msg)
+	decision := SpamDecision{Time: time.Now(), ChatID: msg.ChatID, MsgID: msg.ID, User: msg.From, Text: text,
+		Result: res, Action: "none"}
+	if res.Spam {
+		log.Printf("[INFO] spam from %v, score %.2f, %v", msg.From, res.Score, res.Signals)
+		var err error
+		if decision.Action, err = l.removeSpam(msg, strings.Join(res.Signals, ", ")); err != nil {
+			log.Printf("[WARN] failed to remove spam, %v", err)
+			decision.Error = err.Error()
+		}
+	}
+	if res.Flag {
+		decision.Action = "flagged"
+		if err := l.flagSpam(msg, text, res); err != nil {
+			log.Printf("[WARN] failed to flag spam, %v", err)
+			decision.Error = err.Error()
+		}
+	}
+
+	l.audit(decision)
+	return res.Spam
+}
+
+// messageText returns text of the message with image caption
+func messageText(msg bot.Message) string {
+	if msg.Image == nil {
+		return msg.Text
+	}
+	return strings.TrimSpace(msg.Text + " " + msg.Image.Caption)
+}
+
+// flagSpam reports suspicious message to admins chat
+func (l *TelegramListener) flagSpam(msg bot.Message, text string, res spam.Result) error {
+	if l.SpamFlagChatID == 0 {
+		return nil
+	}
+	name := msg.From.DisplayName
+	if msg.From.Username != "" {
+		name = "@" + msg.From.Username
+	}
+	report := fmt.Sprintf("похоже на спам от %s (id %d), %.2f: %s\n\n%s", name, msg.From.ID, res.Score,
+		strings.Join(res.Signals, ", "), text)
+	// no markdown, the text is user's input
+	tbMsg := tbapi.NewMessage(l.SpamFlagChatID, report)
+	tbMsg.DisableWebPagePreview = true
+	_, err := l.TbAPI.Send(tbMsg)
+	return errors.Wrapf(err, "can't send report to %d", l.SpamFlagChatID)
+}
+
+// removeSpam deletes the message and restricts or kicks the author, returns the action made
+func (l *TelegramListener) removeSpam(msg bot.Message, reason string) (action string, err error) {
+	resp, err := l.TbAPI.DeleteMessage(tbapi.DeleteMessageConfig{ChatID: msg.ChatID, MessageID: msg.ID})
+	if err != nil || !resp.Ok {
+		return "none", errors.Errorf("can't delete message %d, %v %s", msg.ID, err, string(resp.Result))
+	}
+
+	if l.SpamBanDuration > 0 {
+		if err = l.banUser(l.SpamBanDuration, msg.ChatID, msg.From.ID); err != nil {
+			return "deleted", errors.Wrapf(err, "can't restrict %v", msg.From)
+		}
+		l.record(bot.Sanction{ChatID: msg.ChatID, User: msg.From, Action: bot.ActionMute, Issuer: "antispam",
+			Reason: reason, Until: time.Now().Add(l.SpamBanDuration)})
+		return "restricted", nil
+	}
+
+	resp, err = l.TbAPI.KickChatMember(tbapi.KickChatMemberConfig{
+		ChatMemberConfig: tbapi.ChatMemberConfig{ChatID: msg.ChatID, UserID: msg.From.ID}})
+	if err != nil || !resp.Ok {
+		return "deleted", errors.Errorf("can't kick %v, %v %s", msg.From, err, string(resp.Result))
+	}
+	l.record(bot.Sanction{ChatID: msg.ChatID, User: msg.From, Action: bot.ActionBan, Issuer: "antispam", Reason: reason})
+	return "kicked", nil
 }
 
 // Submit message text to telegram's group
 func (l *TelegramListener) Submit(ctx context.Context, text string, pin bool) error {
-	l.msgs.once.Do(func() { l.msgs.ch = make(chan bot.Response, 100) })
+	return l.SubmitTo(ctx, 0, bot.Response{Text: text, Pin: pin, Send: true, Preview: true})
+}
+
+// SubmitTo pushes bot response to the given chat, zero chatID means the primary group.
+// Used by bots sending messages on their own schedule, not as a reply to OnMessage
+func (l *TelegramListener) SubmitTo(ctx context.Context, chatID int64, resp bot.Response) error {
+	l.msgs.once.Do(func() { l.msgs.ch = make(chan submission, 100) })
 
 	select {
 	case <-ctx.Done():
 		return ctx.Err()
-	case l.msgs.ch <- bot.Response{Text: text, Pin: pin, Send: true, Preview: true}:
+	case l.msgs.ch <- submission{chatID: chatID, resp: resp}:
 	}
 	return nil
 }
@@ -302,6 +883,41 @@ func (l *TelegramListener) banUser(duration time.Duration, chatID int64, userID
 	return nil
 }
 
+// unrestrictUser allows user to send all kinds of messages
+func (l *TelegramListener) unrestrictUser(chatID int64, userID int) error {
+	allow := true
+	resp, err := l.TbAPI.RestrictChatMember(tbapi.RestrictChatMemberConfig{
+		ChatMemberConfig:      tbapi.ChatMemberConfig{ChatID: chatID, UserID: userID},
+		CanSendMessages:       &allow,
+		CanSendMediaMessages:  &allow,
+		CanSendOtherMessages:  &allow,
+		CanAddWebPagePreviews: &allow,
+	})
+	if err != nil {
+		return err
+	}
+	if !resp.Ok {
+		return fmt.Errorf("response is not Ok: %v", string(resp.Result))
+	}
+	return nil
+}
+
+// kickUser removes user from the chat. Telegram has no kick, only ban, so the user banned for a minute
+// and can join again after it
+func (l *TelegramListener) kickUser(chatID int64, userID int) error {
+	resp, err := l.TbAPI.KickChatMember(tbapi.KickChatMemberConfig{
+		ChatMemberConfig: tbapi.ChatMemberConfig{ChatID: chatID, UserID: userID},
+		UntilDate:        time.Now().Add(time.Minute).Unix(),
+	})
+	if err != nil {
+		return err
+	}
+	if !resp.Ok {
+		return fmt.Errorf("response is not Ok: %v", string(resp.Result))
+	}
+	return nil
+}
+
 func (l *TelegramListener) transform(msg *tbapi.Message) *bot.Message {
 	message := bot.Message{
 		ID:   msg.MessageID,
@@ -318,9 +934,23 @@ func (l *TelegramListener) transform(msg *tbapi.Message) *bot.Message {
 			ID:          msg.From.ID,
 			Username:    msg.From.UserName,
 			DisplayName: msg.From.FirstName + " " + msg.From.LastName,
+			IsBot:       msg.From.IsBot,
 		}
 	}
 
+	if msg.ReplyToMessage != nil {
+		message.ReplyTo = l.transform(msg.ReplyToMessage)
+	}
+
+	switch {
+	case msg.ForwardFromChat != nil:
+		message.Forward = &bot.Forward{ChatID: msg.ForwardFromChat.ID, Title: msg.ForwardFromChat.Title,
+			Channel: msg.ForwardFromChat.IsChannel()}
+	case msg.ForwardFrom != nil:
+		message.Forward = &bot.Forward{User: &bot.User{ID: msg.ForwardFrom.ID, Username: msg.ForwardFrom.UserName,
+			DisplayName: msg.ForwardFrom.FirstName + " " + msg.ForwardFrom.LastName}}
+	}
+
 	switch {
 	case msg.Entities != nil && len(*msg.Entities) > 0:
 		message.Entities = l.transformEntities(msg.Entities)
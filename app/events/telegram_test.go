@@ -10,6 +10,7 @@ import (
 	"github.com/stretchr/testify/mock"
 
 	"github.com/radio-t/super-bot/app/bot"
+	"github.com/radio-t/super-bot/app/spam"
 )
 
 func TestTelegramListener_DoNoBots(t *testing.T) {
@@ -155,10 +156,49 @@ func TestTelegramListener_DoWithRtjc(t *testing.T) {
 	tbAPI.AssertNumberOfCalls(t, "PinChatMessage", 1)
 }
 
+func TestTelegramListener_DoWithSubmitTo(t *testing.T) {
+	msgLogger := &mockMsgLogger{}
+	tbAPI := &mockTbAPI{}
+	bots := &bot.MockInterface{}
+
+	l := TelegramListener{
+		MsgLogger: msgLogger,
+		TbAPI:     tbAPI,
+		Bots:      bots,
+		Group:     "gr",
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	tbAPI.On("GetChat", mock.Anything).Return(tbapi.Chat{ID: 123}, nil)
+	updChan := make(chan tbapi.Update, 1)
+	tbAPI.On("GetUpdatesChan", mock.Anything).Return(tbapi.UpdatesChannel(updChan), nil)
+
+	tbAPI.On("Send", mock.MatchedBy(func(c tbapi.MessageConfig) bool {
+		t.Logf("send: %+v", c)
+		return c.Text == "reminder" && c.ChatID == 456
+	})).Return(tbapi.Message{Text: "reminder", From: &tbapi.User{UserName: "bot"}}, nil)
+
+	time.AfterFunc(time.Millisecond*50, func() {
+		assert.NoError(t, l.SubmitTo(ctx, 456, bot.Response{Text: "reminder", Send: true}))
+	})
+
+	err := l.Do(ctx)
+	assert.EqualError(t, err, "context deadline exceeded")
+	tbAPI.AssertNumberOfCalls(t, "Send", 1)
+	msgLogger.AssertNotCalled(t, "Save", mock.Anything) // not the primary group
+}
+
 func TestTelegramListener_DoWithAutoBan(t *testing.T) {
 	msgLogger := &mockMsgLogger{}
 	tbAPI := &mockTbAPI{}
 	bots := &bot.MockInterface{}
+	sanctions := &bot.MockSanctionRecorder{}
+	sanctions.On("Record", mock.MatchedBy(func(s bot.Sanction) bool {
+		return s.User.ID == 1 && s.Action == bot.ActionMute && s.Issuer == "terminator" && s.Reason == "all activity" &&
+			s.ChatID == 123 && !s.Until.IsZero()
+	})).Once()
 
 	l := TelegramListener{
 		MsgLogger: msgLogger,
@@ -170,6 +210,7 @@ func TestTelegramListener_DoWithAutoBan(t *testing.T) {
 			BanPenalty:    3,
 			AllowedPeriod: 1 * time.Second,
 		},
+		Sanctions: sanctions,
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
@@ -219,6 +260,148 @@ func TestTelegramListener_DoWithAutoBan(t *testing.T) {
 	tbAPI.AssertNumberOfCalls(t, "Send", 1)
 	msgLogger.AssertExpectations(t)
 	msgLogger.AssertNumberOfCalls(t, "Save", 6)
+	sanctions.AssertExpectations(t)
+}
+
+func TestTelegramListener_DoWithSpam(t *testing.T) {
+	msgLogger := &mockMsgLogger{}
+	tbAPI := &mockTbAPI{}
+	bots := &bot.MockInterface{}
+	detector := &mockSpamDetector{}
+	audit := &mockAuditLog{}
+
+	l := TelegramListener{
+		MsgLogger:      msgLogger,
+		TbAPI:          tbAPI,
+		Bots:           bots,
+		Group:          "gr",
+		SuperUsers:     SuperUser{"admin"},
+		SpamDetector:   detector,
+		SpamAudit:      audit,
+		SpamFlagChatID: 777,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	updChan := make(chan tbapi.Update, 4)
+	updChan <- tbapi.Update{Message: &tbapi.Message{MessageID: 1, Chat: &tbapi.Chat{ID: 123}, Text: "spam",
+		From: &tbapi.User{UserName: "spammer", ID: 1}}}
+	updChan <- tbapi.Update{Message: &tbapi.Message{MessageID: 2, Chat: &tbapi.Chat{ID: 123}, Text: "ham",
+		From: &tbapi.User{UserName: "user", ID: 2}}}
+	updChan <- tbapi.Update{Message: &tbapi.Message{MessageID: 3, Chat: &tbapi.Chat{ID: 123}, Text: "spam",
+		From: &tbapi.User{UserName: "admin", ID: 3}}}
+	updChan <- tbapi.Update{Message: &tbapi.Message{MessageID: 4, Chat: &tbapi.Chat{ID: 123}, Text: "maybe spam",
+		From: &tbapi.User{UserName: "newbie", ID: 4}}}
+	close(updChan)
+
+	tbAPI.On("GetChat", mock.Anything).Return(tbapi.Chat{ID: 123}, nil)
+	tbAPI.On("GetUpdatesChan", mock.Anything).Return(tbapi.UpdatesChannel(updChan), nil)
+	msgLogger.On("Save", mock.Anything)
+
+	detector.On("Check", mock.MatchedBy(func(msg bot.Message) bool { return msg.Text == "spam" })).
+		Return(spam.Result{Score: 1.5, Spam: true, Signals: []string{"spam phrase: spam"}})
+	detector.On("Check", mock.MatchedBy(func(msg bot.Message) bool { return msg.Text == "ham" })).
+		Return(spam.Result{Score: 0.3, Signals: []string{"too many caps"}})
+	detector.On("Check", mock.MatchedBy(func(msg bot.Message) bool { return msg.Text == "maybe spam" })).
+		Return(spam.Result{Score: 0.6, Flag: true, Signals: []string{"classifier: 0.85"}})
+	tbAPI.On("Send", mock.MatchedBy(func(c tbapi.MessageConfig) bool {
+		return c.ChatID == 777 && c.Text == "похоже на спам от @newbie (id 4), 0.60: classifier: 0.85\n\nmaybe spam"
+	})).Return(tbapi.Message{}, nil).Once()
+
+	tbAPI.On("DeleteMessage", tbapi.DeleteMessageConfig{ChatID: 123, MessageID: 1}).Return(tbapi.APIResponse{Ok: true}, nil)
+	tbAPI.On("KickChatMember", mock.MatchedBy(func(c tbapi.KickChatMemberConfig) bool {
+		return c.ChatID == 123 && c.UserID == 1
+	})).Return(tbapi.APIResponse{Ok: true}, nil)
+
+	audit.On("Append", mock.MatchedBy(func(v interface{}) bool {
+		d := v.(SpamDecision)
+		return d.MsgID == 1 && d.Action == "kicked" && d.Spam && d.User.ID == 1 && d.Error == ""
+	})).Return(nil).Once()
+	audit.On("Append", mock.MatchedBy(func(v interface{}) bool {
+		d := v.(SpamDecision)
+		return d.MsgID == 2 && d.Action == "none" && !d.Spam && d.Score == 0.3
+	})).Return(nil).Once()
+	audit.On("Append", mock.MatchedBy(func(v interface{}) bool {
+		d := v.(SpamDecision)
+		return d.MsgID == 4 && d.Action == "flagged" && !d.Spam && d.Flag
+	})).Return(nil).Once()
+
+	bots.On("OnMessage", mock.MatchedBy(func(msg bot.Message) bool { return msg.From.ID != 1 })).
+		Return(bot.Response{Send: false})
+
+	err := l.Do(ctx)
+	assert.EqualError(t, err, "telegram update chan closed")
+
+	detector.AssertNumberOfCalls(t, "Check", 3)
+	audit.AssertExpectations(t)
+	tbAPI.AssertNumberOfCalls(t, "DeleteMessage", 1)
+	tbAPI.AssertNumberOfCalls(t, "KickChatMember", 1)
+	tbAPI.AssertNumberOfCalls(t, "Send", 1)
+	bots.AssertNumberOfCalls(t, "OnMessage", 3)
+	msgLogger.AssertNumberOfCalls(t, "Save", 3) // spam is not saved
+}
+
+func TestTelegramListener_removeSpamWithRestrict(t *testing.T) {
+	tbAPI := &mockTbAPI{}
+	sanctions := &bot.MockSanctionRecorder{}
+	l := TelegramListener{TbAPI: tbAPI, SpamBanDuration: time.Hour, Sanctions: sanctions}
+	sanctions.On("Record", mock.MatchedBy(func(s bot.Sanction) bool {
+		return s.User.ID == 1 && s.Action == bot.ActionMute && s.Issuer == "antispam" && s.Reason == "spam phrase"
+	})).Once()
+	msg := bot.Message{ID: 10, ChatID: 123, From: bot.User{ID: 1, Username: "spammer"}}
+
+	tbAPI.On("DeleteMessage", tbapi.DeleteMessageConfig{ChatID: 123, MessageID: 10}).
+		Return(tbapi.APIResponse{Ok: true}, nil).Once()
+	tbAPI.On("RestrictChatMember", mock.MatchedBy(func(c tbapi.RestrictChatMemberConfig) bool {
+		return c.ChatID == 123 && c.UserID == 1 && c.UntilDate > time.Now().Add(59*time.Minute).Unix()
+	})).Return(tbapi.APIResponse{Ok: true}, nil).Once()
+
+	action, err := l.removeSpam(msg, "spam phrase")
+	assert.NoError(t, err)
+	assert.Equal(t, "restricted", action)
+
+	tbAPI.On("DeleteMessage", mock.Anything).Return(tbapi.APIResponse{Ok: false, Result: []byte("no rights")}, nil)
+	action, err = l.removeSpam(msg, "spam phrase")
+	assert.EqualError(t, err, "can't delete message 10, <nil> no rights")
+	assert.Equal(t, "none", action)
+	tbAPI.AssertExpectations(t)
+	sanctions.AssertExpectations(t)
+}
+
+func TestTelegramListener_botBanWithTarget(t *testing.T) {
+	tbAPI := &mockTbAPI{}
+	sanctions := &bot.MockSanctionRecorder{}
+	l := TelegramListener{TbAPI: tbAPI, SuperUsers: SuperUser{"admin"}, Sanctions: sanctions}
+	target := bot.User{ID: 1, Username: "user1"}
+
+	// not super can't ban others
+	l.botBan(bot.Response{Send: true, Kick: true, BanTarget: &target}, bot.Message{From: bot.User{Username: "user"}}, 123)
+	// super can't be banned
+	l.botBan(bot.Response{Send: true, Kick: true, BanTarget: &bot.User{ID: 2, Username: "admin"}},
+		bot.Message{From: bot.User{Username: "admin"}}, 123)
+	tbAPI.AssertNotCalled(t, "KickChatMember", mock.Anything)
+
+	tbAPI.On("KickChatMember", mock.MatchedBy(func(c tbapi.KickChatMemberConfig) bool {
+		return c.ChatID == 123 && c.UserID == 1
+	})).Return(tbapi.APIResponse{Ok: true}, nil).Once()
+	sanctions.On("Record", mock.MatchedBy(func(s bot.Sanction) bool {
+		return s.User == target && s.Action == bot.ActionKick && s.Issuer == "@admin" && s.Reason == "warn! @user1"
+	})).Once()
+	l.botBan(bot.Response{Send: true, Kick: true, BanTarget: &target}, bot.Message{Text: "warn! @user1",
+		From: bot.User{Username: "admin"}}, 123)
+
+	tbAPI.On("RestrictChatMember", mock.MatchedBy(func(c tbapi.RestrictChatMemberConfig) bool {
+		return c.ChatID == 123 && c.UserID == 1 && c.UntilDate > time.Now().Add(59*time.Minute).Unix()
+	})).Return(tbapi.APIResponse{Ok: true}, nil).Once()
+	sanctions.On("Record", mock.MatchedBy(func(s bot.Sanction) bool {
+		return s.User == target && s.Action == bot.ActionMute && s.Issuer == "@admin"
+	})).Once()
+	l.botBan(bot.Response{Send: true, BanInterval: time.Hour, BanTarget: &target}, bot.Message{Text: "warn! @user1",
+		From: bot.User{Username: "admin"}}, 123)
+
+	tbAPI.AssertExpectations(t)
+	sanctions.AssertExpectations(t)
 }
 
 func TestTelegramListener_DoWithBotBan(t *testing.T) {
@@ -430,6 +613,60 @@ func TestTelegramListener_DoNotSaveMessagesFromOtherChats(t *testing.T) {
 	tbAPI.AssertExpectations(t)
 }
 
+func TestTelegramListener_sendBotResponseWithButtons(t *testing.T) {
+	tbAPI := &mockTbAPI{}
+	msgLogger := &mockMsgLogger{}
+	msgLogger.On("Save", mock.Anything).Return()
+	l := TelegramListener{TbAPI: tbAPI, MsgLogger: msgLogger}
+
+	tbAPI.On("Send", mock.MatchedBy(func(c tbapi.MessageConfig) bool {
+		kb, ok := c.ReplyMarkup.(tbapi.InlineKeyboardMarkup)
+		return c.Text == "page 1" && ok && len(kb.InlineKeyboard) == 1 && len(kb.InlineKeyboard[0]) == 1 &&
+			kb.InlineKeyboard[0][0].Text == "▶" && *kb.InlineKeyboard[0][0].CallbackData == "search:10:1"
+	})).Return(tbapi.Message{MessageID: 456, Text: "page 1"}, nil).Once()
+	tbAPI.On("Send", mock.MatchedBy(func(c tbapi.MessageConfig) bool {
+		return c.Text == "no buttons" && c.ReplyMarkup == nil
+	})).Return(tbapi.Message{MessageID: 457, Text: "no buttons"}, nil).Once()
+
+	err := l.sendBotResponse(bot.Response{Text: "page 1", Send: true, Buttons: []bot.Button{{Text: "▶", Data: "search:10:1"}}}, 123)
+	assert.NoError(t, err)
+	assert.NoError(t, l.sendBotResponse(bot.Response{Text: "no buttons", Send: true}, 123))
+	tbAPI.AssertExpectations(t)
+}
+
+func TestTelegramListener_onCallback(t *testing.T) {
+	tbAPI := &mockTbAPI{}
+	handler := &bot.MockCallbackHandler{}
+	l := TelegramListener{TbAPI: tbAPI, Callbacks: map[string]bot.CallbackHandler{"search": handler}}
+	msg := &tbapi.Message{MessageID: 456, Chat: &tbapi.Chat{ID: 123}}
+
+	// page switched, the message edited
+	handler.On("OnCallback", bot.Callback{Data: "search:10:1", From: bot.User{ID: 1, Username: "user", DisplayName: "John"},
+		ChatID: 123, MsgID: 456}).
+		Return(bot.Response{Text: "page 2", Send: true, Buttons: []bot.Button{{Text: "◀", Data: "search:10:0"}}}, "").Once()
+	tbAPI.On("Send", mock.MatchedBy(func(c tbapi.EditMessageTextConfig) bool {
+		return c.ChatID == 123 && c.MessageID == 456 && c.Text == "page 2" && c.ReplyMarkup != nil &&
+			*c.ReplyMarkup.InlineKeyboard[0][0].CallbackData == "search:10:0"
+	})).Return(tbapi.Message{}, nil).Once()
+	tbAPI.On("AnswerCallbackQuery", tbapi.CallbackConfig{CallbackQueryID: "q1"}).Return(tbapi.APIResponse{Ok: true}, nil).Once()
+	l.onCallback(&tbapi.CallbackQuery{ID: "q1", From: &tbapi.User{ID: 1, UserName: "user", FirstName: "John"},
+		Message: msg, Data: "search:10:1"})
+
+	// rejected by the handler, only answered
+	handler.On("OnCallback", mock.MatchedBy(func(cb bot.Callback) bool { return cb.From.ID == 2 })).
+		Return(bot.Response{}, "листать может только автор запроса").Once()
+	tbAPI.On("AnswerCallbackQuery", tbapi.CallbackConfig{CallbackQueryID: "q2", Text: "листать может только автор запроса"}).
+		Return(tbapi.APIResponse{Ok: true}, nil).Once()
+	l.onCallback(&tbapi.CallbackQuery{ID: "q2", From: &tbapi.User{ID: 2}, Message: msg, Data: "search:10:1"})
+
+	// unknown prefix
+	tbAPI.On("AnswerCallbackQuery", tbapi.CallbackConfig{CallbackQueryID: "q3"}).Return(tbapi.APIResponse{Ok: true}, nil).Once()
+	l.onCallback(&tbapi.CallbackQuery{ID: "q3", From: &tbapi.User{ID: 1}, Message: msg, Data: "other:1"})
+
+	handler.AssertExpectations(t)
+	tbAPI.AssertExpectations(t)
+}
+
 func TestTelegram_transformTextMessage(t *testing.T) {
 	l := TelegramListener{}
 	assert.Equal(
@@ -464,6 +701,26 @@ func TestTelegram_transformTextMessage(t *testing.T) {
 	)
 }
 
+func TestTelegram_transformForward(t *testing.T) {
+	l := TelegramListener{}
+	msg := l.transform(&tbapi.Message{Chat: &tbapi.Chat{ID: 123456}, Text: "news",
+		ForwardFromChat: &tbapi.Chat{ID: -100500, Type: "channel", Title: "Crypto News"}})
+	assert.Equal(t, &bot.Forward{ChatID: -100500, Title: "Crypto News", Channel: true}, msg.Forward)
+
+	msg = l.transform(&tbapi.Message{Chat: &tbapi.Chat{ID: 123456}, Text: "news",
+		ForwardFrom: &tbapi.User{ID: 1, UserName: "user", FirstName: "First", LastName: "Last"}})
+	assert.Equal(t, &bot.Forward{User: &bot.User{ID: 1, Username: "user", DisplayName: "First Last"}}, msg.Forward)
+}
+
+func TestTelegram_transformReply(t *testing.T) {
+	l := TelegramListener{}
+	msg := l.transform(&tbapi.Message{MessageID: 2, Chat: &tbapi.Chat{ID: 123456}, Text: "ban!", Date: 1578627415,
+		ReplyToMessage: &tbapi.Message{MessageID: 1, Chat: &tbapi.Chat{ID: 123456}, Text: "spam", Date: 1578627400,
+			From: &tbapi.User{ID: 1, UserName: "spammer", FirstName: "Spam"}}})
+	assert.Equal(t, &bot.Message{ID: 1, ChatID: 123456, Text: "spam", Sent: time.Unix(1578627400, 0),
+		From: bot.User{ID: 1, Username: "spammer", DisplayName: "Spam "}}, msg.ReplyTo)
+}
+
 func TestTelegram_transformPhoto(t *testing.T) {
 	l := TelegramListener{}
 	assert.Equal(
@@ -14,6 +14,14 @@ type Terminator struct {
 	AllowedPeriod time.Duration
 	Exclude       SuperUser
 	users         map[bot.User]activity
+	strict        bool // lockdown mode, halves BanPenalty and doubles BanDuration
+}
+
+// Limits is a set of activity terminators, used to switch the listener between normal and live profiles
+type Limits struct {
+	AllActivityTerm        Terminator
+	BotsActivityTerm       Terminator
+	OverallBotActivityTerm Terminator
 }
 
 type activity struct {
@@ -55,14 +63,14 @@ func (t *Terminator) check(user bot.User, sent time.Time) ban {
 		info.penalty = 0
 	}
 
-	if info.penalty == t.BanPenalty {
+	if info.penalty == t.penalty() {
 		log.Printf("[WARN] banned %v", user)
 		info.penalty++
 		t.users[user] = info
 		return ban{active: true, new: true}
 	}
 
-	if info.penalty >= t.BanPenalty {
+	if info.penalty >= t.penalty() {
 		log.Printf("[DEBUG] still banned %v", user)
 		return ban{active: true, new: false}
 	}
@@ -71,3 +79,19 @@ func (t *Terminator) check(user bot.User, sent time.Time) ban {
 	t.users[user] = info
 	return noBan
 }
+
+// penalty returns allowed number of messages within AllowedPeriod
+func (t *Terminator) penalty() int {
+	if t.strict && t.BanPenalty > 1 {
+		return t.BanPenalty / 2
+	}
+	return t.BanPenalty
+}
+
+// duration returns ban duration
+func (t *Terminator) duration() time.Duration {
+	if t.strict {
+		return t.BanDuration * 2
+	}
+	return t.BanDuration
+}
@@ -95,3 +95,49 @@ func TestTerminator_ignoreOldMessages(t *testing.T) {
 	assert.Equal(t, ban{active: false, new: false}, term.check(bot.User{Username: "user"}, time.Now().Add(-7*time.Millisecond))) // penalty = 2
 	assert.Equal(t, ban{active: true, new: true}, term.check(bot.User{Username: "user"}, time.Now().Add(-6*time.Millisecond)))   // ban
 }
+
+func TestTerminator_checkStrict(t *testing.T) {
+	term := Terminator{
+		BanDuration:   500 * time.Millisecond,
+		BanPenalty:    4,
+		AllowedPeriod: 100 * time.Millisecond,
+		strict:        true,
+	}
+	assert.Equal(t, time.Second, term.duration())
+
+	assert.Equal(t, ban{active: false, new: false}, term.check(bot.User{Username: "user"}, time.Now()))
+	assert.Equal(t, ban{active: false, new: false}, term.check(bot.User{Username: "user"}, time.Now()))
+	assert.Equal(t, ban{active: true, new: true}, term.check(bot.User{Username: "user"}, time.Now()))
+
+	term.strict = false
+	assert.Equal(t, 500*time.Millisecond, term.duration())
+	assert.Equal(t, 4, term.penalty())
+}
+
+func TestTelegramListener_switchLimits(t *testing.T) {
+	bs := &broadcastMock{}
+	normal, live := Terminator{BanPenalty: 5}, Terminator{BanPenalty: 2}
+	l := TelegramListener{Broadcast: bs, AllActivityTerm: normal, BotsActivityTerm: normal,
+		LiveLimits: Limits{BotsActivityTerm: live}}
+
+	l.switchLimits()
+	assert.Equal(t, 5, l.BotsActivityTerm.BanPenalty)
+
+	bs.live = true
+	l.switchLimits()
+	assert.Equal(t, 2, l.BotsActivityTerm.BanPenalty)
+	assert.Equal(t, 5, l.AllActivityTerm.BanPenalty, "no live terminator, normal kept")
+
+	l.Lockdown.activate(time.Now(), time.Hour)
+	bs.live = false
+	l.switchLimits()
+	assert.Equal(t, 5, l.BotsActivityTerm.BanPenalty)
+	assert.Equal(t, 5, l.AllActivityTerm.BanPenalty)
+	assert.True(t, l.BotsActivityTerm.strict, "lockdown still active")
+}
+
+type broadcastMock struct {
+	live bool
+}
+
+func (b *broadcastMock) Live() (live bool, started time.Time) { return b.live, time.Time{} }
@@ -0,0 +1,137 @@
+package events
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"sort"
+	"text/template"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/radio-t/super-bot/app/bot"
+	"github.com/radio-t/super-bot/app/storage"
+)
+
+// Welcome greets new members with the chat rules and verifies them with a button captcha.
+// Newcomer stays restricted until pressing own button and kicked if not pressed within Timeout.
+// Pending captchas kept in the store, to be passed or expired after restart. Not thread safe, used by the listener only
+type Welcome struct {
+	Timeout time.Duration // time to press the button, default 5 minutes
+	rules   *template.Template
+	store   *storage.JSONFile
+	pending map[int]captcha // by user ID
+}
+
+// captcha is a pending verification of new member
+type captcha struct {
+	user     bot.User
+	chatID   int64
+	msgID    int
+	text     string
+	deadline time.Time
+}
+
+// storedCaptcha is a captcha in the store
+type storedCaptcha struct {
+	User     bot.User  `json:"user"`
+	ChatID   int64     `json:"chat_id"`
+	MsgID    int       `json:"msg_id"`
+	Text     string    `json:"text"`
+	Deadline time.Time `json:"deadline"`
+}
+
+// CaptchaDecision is an audit record of new member verification
+type CaptchaDecision struct {
+	Time   time.Time
+	ChatID int64
+	User   bot.User
+	Action string // skipped, passed or kicked
+	Error  string `json:",omitempty"`
+}
+
+// NewWelcome makes Welcome with rules template from the file, {{.User}} is a mention of the new member.
+// Pending captchas loaded from storeFile
+func NewWelcome(rulesFile, storeFile string, timeout time.Duration) (*Welcome, error) {
+	data, err := ioutil.ReadFile(rulesFile) // nolint
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't read %s", rulesFile)
+	}
+	rules, err := template.New("welcome").Parse(string(data))
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't parse %s", rulesFile)
+	}
+	if timeout == 0 {
+		timeout = 5 * time.Minute
+	}
+	store, err := storage.NewJSONFile(storeFile)
+	if err != nil {
+		return nil, err
+	}
+	var stored []storedCaptcha
+	if err = store.Load(&stored); err != nil {
+		return nil, errors.Wrap(err, "can't load pending captchas")
+	}
+
+	w := &Welcome{Timeout: timeout, rules: rules, store: store, pending: map[int]captcha{}}
+	for _, c := range stored {
+		w.pending[c.User.ID] = captcha{user: c.User, chatID: c.ChatID, msgID: c.MsgID, text: c.Text, deadline: c.Deadline}
+	}
+	log.Printf("[INFO] welcome with %s, captcha timeout %v, %d pending", rulesFile, timeout, len(w.pending))
+	return w, nil
+}
+
+// message makes welcome text for the user
+func (w *Welcome) message(user bot.User) (string, error) {
+	name := user.DisplayName
+	if user.Username != "" {
+		name = "@" + user.Username
+	}
+	buf := bytes.Buffer{}
+	err := w.rules.Execute(&buf, struct{ User string }{User: fmt.Sprintf("[%s](tg://user?id=%d)", name, user.ID)})
+	return buf.String(), errors.Wrap(err, "can't make welcome message")
+}
+
+// add registers pending captcha
+func (w *Welcome) add(c captcha) {
+	w.pending[c.user.ID] = c
+	w.save()
+}
+
+// pass removes pending captcha of the user, returns false if there is no such captcha
+func (w *Welcome) pass(userID int) (captcha, bool) {
+	c, ok := w.pending[userID]
+	if ok {
+		delete(w.pending, userID)
+		w.save()
+	}
+	return c, ok
+}
+
+// expired removes and returns captchas not passed before deadline
+func (w *Welcome) expired(now time.Time) (res []captcha) {
+	for id, c := range w.pending {
+		if now.After(c.deadline) {
+			res = append(res, c)
+			delete(w.pending, id)
+		}
+	}
+	if len(res) > 0 {
+		w.save()
+	}
+	return res
+}
+
+// save stores pending captchas
+func (w *Welcome) save() {
+	stored := make([]storedCaptcha, 0, len(w.pending))
+	for _, c := range w.pending {
+		stored = append(stored, storedCaptcha{User: c.user, ChatID: c.chatID, MsgID: c.msgID, Text: c.text, Deadline: c.deadline})
+	}
+	sort.Slice(stored, func(i, j int) bool { return stored[i].User.ID < stored[j].User.ID })
+	if err := w.store.Save(stored); err != nil {
+		log.Printf("[WARN] can't save pending captchas, %v", err)
+	}
+}
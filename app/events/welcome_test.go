@@ -0,0 +1,148 @@
+package events
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	tbapi "github.com/go-telegram-bot-api/telegram-bot-api"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"github.com/radio-t/super-bot/app/bot"
+)
+
+func TestWelcome(t *testing.T) {
+	_, err := NewWelcome("/tmp/no-such-welcome.data", "/tmp/captcha.json", 0)
+	assert.Error(t, err)
+
+	rulesFile, storeFile := prepWelcomeFiles(t)
+	w, err := NewWelcome(rulesFile, storeFile, time.Minute)
+	require.NoError(t, err)
+	msg, err := w.message(bot.User{ID: 1, Username: "user1"})
+	require.NoError(t, err)
+	assert.Equal(t, "Привет, [@user1](tg://user?id=1)! Правила: не шуметь.", msg)
+	msg, err = w.message(bot.User{ID: 2, DisplayName: "Some Name"})
+	require.NoError(t, err)
+	assert.Equal(t, "Привет, [Some Name](tg://user?id=2)! Правила: не шуметь.", msg)
+
+	now := time.Date(2021, 3, 6, 18, 0, 0, 0, time.UTC)
+	w.add(captcha{user: bot.User{ID: 1}, deadline: now.Add(time.Minute)})
+	w.add(captcha{user: bot.User{ID: 2}, deadline: now.Add(2 * time.Minute)})
+	w.add(captcha{user: bot.User{ID: 3}, deadline: now.Add(3 * time.Minute)})
+
+	c, ok := w.pass(2)
+	assert.True(t, ok)
+	assert.Equal(t, 2, c.user.ID)
+	_, ok = w.pass(2)
+	assert.False(t, ok)
+
+	assert.Empty(t, w.expired(now))
+	res := w.expired(now.Add(150 * time.Second))
+	require.Equal(t, 1, len(res))
+	assert.Equal(t, 1, res[0].user.ID)
+	assert.Empty(t, w.expired(now.Add(150*time.Second)))
+	assert.Equal(t, 1, len(w.pending))
+
+	// pending captcha restored after restart, to be passed or expired
+	w2, err := NewWelcome(rulesFile, storeFile, time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, map[int]captcha{3: {user: bot.User{ID: 3}, deadline: now.Add(3 * time.Minute)}}, w2.pending)
+	res = w2.expired(now.Add(4 * time.Minute))
+	require.Equal(t, 1, len(res))
+	w3, err := NewWelcome(rulesFile, storeFile, time.Minute)
+	require.NoError(t, err)
+	assert.Empty(t, w3.pending)
+}
+
+func TestTelegramListener_captcha(t *testing.T) {
+	tbAPI := &mockTbAPI{}
+	msgLogger := &mockMsgLogger{}
+	audit := &mockAuditLog{}
+	sanctions := &bot.MockSanctionRecorder{}
+	l := TelegramListener{TbAPI: tbAPI, MsgLogger: msgLogger, SpamAudit: audit, Sanctions: sanctions, chatID: 123,
+		SuperUsers: SuperUser{"admin"}, Welcome: prepWelcome(t, time.Minute)}
+	msgLogger.On("Save", mock.Anything)
+
+	// joined by themselves, restricted with captcha
+	tbAPI.On("RestrictChatMember", mock.MatchedBy(func(c tbapi.RestrictChatMemberConfig) bool {
+		return c.UserID == 1 && !*c.CanSendMessages
+	})).Return(tbapi.APIResponse{Ok: true}, nil).Once()
+	tbAPI.On("Send", mock.MatchedBy(func(c tbapi.MessageConfig) bool {
+		return c.Text == "Привет, [@user1](tg://user?id=1)! Правила: не шуметь." && c.ReplyMarkup != nil
+	})).Return(tbapi.Message{MessageID: 50, Chat: &tbapi.Chat{ID: 123}}, nil).Once()
+	l.greet(&tbapi.Message{Chat: &tbapi.Chat{ID: 123}, From: &tbapi.User{ID: 1, UserName: "user1"},
+		NewChatMembers: &[]tbapi.User{{ID: 1, UserName: "user1"}, {ID: 5, UserName: "somebot", IsBot: true}}})
+
+	// added by admin, no captcha
+	tbAPI.On("Send", mock.MatchedBy(func(c tbapi.MessageConfig) bool {
+		return c.Text == "Привет, [@user2](tg://user?id=2)! Правила: не шуметь." && c.ReplyMarkup == nil
+	})).Return(tbapi.Message{MessageID: 51, Chat: &tbapi.Chat{ID: 123}}, nil).Once()
+	audit.On("Append", mock.MatchedBy(func(d CaptchaDecision) bool { return d.User.ID == 2 && d.Action == "skipped" })).
+		Return(nil).Once()
+	l.greet(&tbapi.Message{Chat: &tbapi.Chat{ID: 123}, From: &tbapi.User{ID: 100, UserName: "admin"},
+		NewChatMembers: &[]tbapi.User{{ID: 2, UserName: "user2"}}})
+
+	// someone else pressed the button
+	tbAPI.On("AnswerCallbackQuery", tbapi.CallbackConfig{CallbackQueryID: "q1", Text: "это не твоя кнопка"}).
+		Return(tbapi.APIResponse{Ok: true}, nil).Once()
+	l.onCallback(&tbapi.CallbackQuery{ID: "q1", From: &tbapi.User{ID: 2}, Data: "captcha:1"})
+
+	// the new member pressed the button
+	tbAPI.On("RestrictChatMember", mock.MatchedBy(func(c tbapi.RestrictChatMemberConfig) bool {
+		return c.UserID == 1 && *c.CanSendMessages
+	})).Return(tbapi.APIResponse{Ok: true}, nil).Once()
+	tbAPI.On("Send", mock.MatchedBy(func(c tbapi.EditMessageTextConfig) bool {
+		return c.ChatID == 123 && c.MessageID == 50 && c.ReplyMarkup == nil
+	})).Return(tbapi.Message{}, nil).Once()
+	audit.On("Append", mock.MatchedBy(func(d CaptchaDecision) bool { return d.User.ID == 1 && d.Action == "passed" })).
+		Return(nil).Once()
+	tbAPI.On("AnswerCallbackQuery", tbapi.CallbackConfig{CallbackQueryID: "q2", Text: "добро пожаловать!"}).
+		Return(tbapi.APIResponse{Ok: true}, nil).Once()
+	l.onCallback(&tbapi.CallbackQuery{ID: "q2", From: &tbapi.User{ID: 1}, Data: "captcha:1"})
+	assert.Empty(t, l.Welcome.pending)
+
+	// another new member didn't press the button in time
+	tbAPI.On("RestrictChatMember", mock.MatchedBy(func(c tbapi.RestrictChatMemberConfig) bool {
+		return c.UserID == 3
+	})).Return(tbapi.APIResponse{Ok: true}, nil).Once()
+	tbAPI.On("Send", mock.MatchedBy(func(c tbapi.MessageConfig) bool { return c.ReplyMarkup != nil })).
+		Return(tbapi.Message{MessageID: 52, Chat: &tbapi.Chat{ID: 123}}, nil).Once()
+	l.greet(&tbapi.Message{Chat: &tbapi.Chat{ID: 123}, From: &tbapi.User{ID: 3, FirstName: "spammer"},
+		NewChatMembers: &[]tbapi.User{{ID: 3, FirstName: "spammer"}}})
+
+	l.expireCaptcha(time.Now())
+	tbAPI.On("KickChatMember", mock.MatchedBy(func(c tbapi.KickChatMemberConfig) bool { return c.UserID == 3 })).
+		Return(tbapi.APIResponse{Ok: true}, nil).Once()
+	tbAPI.On("DeleteMessage", tbapi.DeleteMessageConfig{ChatID: 123, MessageID: 52}).
+		Return(tbapi.APIResponse{Ok: true}, nil).Once()
+	sanctions.On("Record", mock.MatchedBy(func(s bot.Sanction) bool {
+		return s.User.ID == 3 && s.Action == bot.ActionKick && s.Issuer == "captcha"
+	})).Once()
+	audit.On("Append", mock.MatchedBy(func(d CaptchaDecision) bool { return d.User.ID == 3 && d.Action == "kicked" })).
+		Return(nil).Once()
+	l.expireCaptcha(time.Now().Add(2 * time.Minute))
+
+	tbAPI.AssertExpectations(t)
+	audit.AssertExpectations(t)
+	sanctions.AssertExpectations(t)
+}
+
+func prepWelcome(t *testing.T, timeout time.Duration) *Welcome {
+	rulesFile, storeFile := prepWelcomeFiles(t)
+	w, err := NewWelcome(rulesFile, storeFile, timeout)
+	require.NoError(t, err)
+	return w
+}
+
+func prepWelcomeFiles(t *testing.T) (rulesFile, storeFile string) {
+	tmp, err := ioutil.TempDir("", "welcome")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = os.RemoveAll(tmp) })
+	rulesFile = path.Join(tmp, "welcome.data")
+	require.NoError(t, ioutil.WriteFile(rulesFile, []byte("Привет, {{.User}}! Правила: не шуметь."), 0600))
+	return rulesFile, path.Join(tmp, "captcha.json")
+}
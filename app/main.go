@@ -17,6 +17,8 @@ import (
 	"github.com/radio-t/super-bot/app/bot"
 	"github.com/radio-t/super-bot/app/events"
 	"github.com/radio-t/super-bot/app/reporter"
+	"github.com/radio-t/super-bot/app/search"
+	"github.com/radio-t/super-bot/app/spam"
 	"github.com/radio-t/super-bot/app/storage"
 )
 
@@ -32,6 +34,7 @@ var opts struct {
 	SuperUsers           events.SuperUser `long:"super" description:"super-users"`
 	MashapeToken         string           `long:"mashape" env:"MASHAPE_TOKEN" description:"mashape token"`
 	SysData              string           `long:"sys-data" env:"SYS_DATA" default:"data" description:"location of sys data"`
+	StatePath            string           `long:"state" env:"STATE_PATH" default:"var" description:"location of persistent state"`
 	NewsArticles         int              `long:"max-articles" env:"MAX_ARTICLES" default:"5" description:"max number of news articles"`
 	IdleDuration         time.Duration    `long:"idle" env:"IDLE" default:"30s" description:"idle duration"`
 	ExportNum            int              `long:"export-num" description:"show number for export"`
@@ -39,6 +42,23 @@ var opts struct {
 	ExportDay            int              `long:"export-day" description:"day in yyyymmdd"`
 	TemplateFile         string           `long:"export-template" default:"logs.html" description:"path to template file"`
 	ExportBroadcastUsers events.SuperUser `long:"broadcast" description:"broadcast-users"`
+	MaxReminders         int              `long:"max-reminders" env:"MAX_REMINDERS" default:"5" description:"max number of reminders per user"`
+	SpamThreshold        float64          `long:"spam-threshold" env:"SPAM_THRESHOLD" default:"1" description:"anti-spam score threshold"`
+	SpamBan              time.Duration    `long:"spam-ban" env:"SPAM_BAN" default:"0s" description:"restrict spammers for the duration, kick if zero"`
+	SpamFlagChat         int64            `long:"spam-flag-chat" env:"SPAM_FLAG_CHAT" description:"admins chat id to report suspicious messages"`
+	SearchQuery          string           `long:"search" description:"search logs archive and exit"`
+	SearchPagesURL       string           `long:"search-pages-url" env:"SEARCH_PAGES_URL" default:"https://chat.radio-t.com/logs" description:"public url of exported pages"`
+	SearchResults        int              `long:"search-results" env:"SEARCH_RESULTS" default:"5" description:"max number of search results"`
+	LockdownDuration     time.Duration    `long:"lockdown" env:"LOCKDOWN" default:"15m" description:"default lockdown duration"`
+	LockdownJoins        int              `long:"lockdown-joins" env:"LOCKDOWN_JOINS" default:"20" description:"joins per minute to lock the chat, 0 to disable"`
+	LockdownMessages     int              `long:"lockdown-messages" env:"LOCKDOWN_MESSAGES" default:"0" description:"messages per minute to lock the chat, 0 to disable"`
+	CaptchaTimeout       time.Duration    `long:"captcha-timeout" env:"CAPTCHA_TIMEOUT" default:"5m" description:"time for new members to pass captcha"`
+	WarnLadder           string           `long:"warn-ladder" env:"WARN_LADDER" default:"warn,1h,1d,kick" description:"sanctions for warnings"`
+	WarnExpiry           time.Duration    `long:"warn-expiry" env:"WARN_EXPIRY" default:"720h" description:"warning lifetime"`
+	StreamStatusURL      string           `long:"stream-status" env:"STREAM_STATUS" default:"https://stream.radio-t.com/status-json.xsl" description:"icecast or shoutcast status json url"`
+	ExcerptAllow         []string         `long:"excerpt-allow" env:"EXCERPT_ALLOW" env-delim:"," description:"domains with link excerpts, all if empty"`
+	ExcerptDeny          []string         `long:"excerpt-deny" env:"EXCERPT_DENY" env-delim:"," default:"twitter.com" default:"x.com" default:"t.me" default:"youtube.com" default:"youtu.be" description:"domains without link excerpts"`
+	NewsInterval         time.Duration    `long:"news-interval" env:"NEWS_INTERVAL" default:"0" description:"how often new articles announced, 0 to disable (announced by rtjc)"`
 
 	Dbg bool `long:"dbg" env:"DEBUG" description:"debug mode"`
 }
@@ -61,6 +81,11 @@ func main() {
 		export()
 		return
 	}
+
+	if opts.SearchQuery != "" {
+		searchLogs()
+		return
+	}
 	rand.Seed(int64(time.Now().Nanosecond()))
 
 	tbAPI, err := tbapi.NewBotAPI(opts.Telegram.Token)
@@ -69,31 +94,6 @@ func main() {
 	}
 	tbAPI.Debug = opts.Dbg
 
-	httpClient := &http.Client{Timeout: 5 * time.Second}
-	multiBot := bot.MultiBot{
-		bot.NewBroadcastStatus(
-			ctx,
-			bot.BroadcastParams{
-				URL:          "https://stream.radio-t.com",
-				PingInterval: 10 * time.Second,
-				DelayToOff:   time.Minute,
-				Client:       http.Client{Timeout: 5 * time.Second}}),
-		bot.NewNews(httpClient, "https://news.radio-t.com/api", opts.NewsArticles),
-		bot.NewAnecdote(httpClient),
-		bot.NewStackOverflow(),
-		bot.NewDuck(opts.MashapeToken, httpClient),
-		bot.NewPodcasts(httpClient, "https://radio-t.com/site-api", 5),
-		bot.NewPrepPost(httpClient, "https://radio-t.com/site-api", 5*time.Minute),
-		bot.NewWTF(time.Hour*24, 7*time.Hour*24, opts.SuperUsers),
-		bot.NewBanhammer(tbAPI, opts.SuperUsers, 5000),
-	}
-
-	if sb, err := bot.NewSys(opts.SysData); err == nil {
-		multiBot = append(multiBot, sb)
-	} else {
-		log.Printf("[ERROR] failed to load sysbot, %v", err)
-	}
-
 	allActivityTerm := events.Terminator{
 		BanDuration:   time.Minute * 5,
 		BanPenalty:    10,
@@ -121,13 +121,189 @@ func main() {
 		BotsActivityTerm:       botsActivityTerm,
 		OverallBotActivityTerm: botsAllUsersActivityTerm,
 		MsgLogger:              reporter.NewLogger(opts.LogsPath),
-		Bots:                   multiBot,
 		Group:                  opts.Telegram.Group,
 		Debug:                  opts.Dbg,
 		IdleDuration:           opts.IdleDuration,
 		SuperUsers:             opts.SuperUsers,
+		Lockdown: events.Lockdown{Duration: opts.LockdownDuration, JoinRate: opts.LockdownJoins,
+			MessageRate: opts.LockdownMessages, Window: time.Minute},
+	}
+
+	tgListener.Impersonation = &events.Impersonation{Names: append([]string{tbAPI.Self.UserName}, opts.SuperUsers...)}
+
+	spamParams := spam.Params{PhrasesFile: opts.SysData + "/spam.data", LogsPath: opts.LogsPath, Threshold: opts.SpamThreshold}
+	var spamLearners []bot.SpamLearner
+	classifier, err := spam.NewClassifier(spam.ClassifierParams{ModelFile: opts.StatePath + "/spam-model.json",
+		CorpusFile: opts.StatePath + "/spam-corpus.jsonl", LogsPath: opts.LogsPath})
+	if err == nil {
+		go classifier.Run(ctx, time.Hour)
+		spamParams.Classifier = classifier
+		spamLearners = append(spamLearners, classifier)
+	} else {
+		log.Printf("[ERROR] failed to load spam classifier, %v", err)
+	}
+
+	if detector, err := spam.NewDetector(spamParams); err == nil {
+		tgListener.SpamDetector = detector
+		tgListener.SpamBanDuration = opts.SpamBan
+		tgListener.SpamFlagChatID = opts.SpamFlagChat
+		if audit, e := storage.NewJSONLines(opts.StatePath + "/spam-audit.jsonl"); e == nil {
+			tgListener.SpamAudit = audit
+		} else {
+			log.Printf("[WARN] can't make spam audit log, %v", e)
+		}
+	} else {
+		log.Printf("[ERROR] failed to load spam detector, %v", err)
+	}
+
+	if welcome, err := events.NewWelcome(opts.SysData+"/welcome.data", opts.StatePath+"/captcha.json",
+		opts.CaptchaTimeout); err == nil {
+		tgListener.Welcome = welcome
+	} else {
+		log.Printf("[WARN] new members won't be welcomed, %v", err)
+	}
+
+	httpClient := &http.Client{Timeout: 5 * time.Second}
+	broadcastStatus := bot.NewBroadcastStatus(
+		ctx,
+		bot.BroadcastParams{
+			URL:          "https://stream.radio-t.com",
+			StatusURL:    opts.StreamStatusURL,
+			StoreFile:    opts.StatePath + "/broadcasts.json",
+			SuperUser:    opts.SuperUsers,
+			Submitter:    &tgListener,
+			PingInterval: 10 * time.Second,
+			DelayToOff:   time.Minute,
+			DropoutPings: 2,
+			Client:       http.Client{Timeout: 5 * time.Second}})
+
+	// stricter bot commands limits during the broadcast
+	tgListener.Broadcast = broadcastStatus
+	tgListener.LiveLimits = events.Limits{
+		BotsActivityTerm: events.Terminator{
+			BanDuration:   time.Minute * 30,
+			BanPenalty:    2,
+			AllowedPeriod: time.Minute * 10,
+			Exclude:       opts.SuperUsers,
+		},
+		OverallBotActivityTerm: events.Terminator{
+			BanDuration:   time.Minute * 10,
+			BanPenalty:    3,
+			AllowedPeriod: time.Minute * 5,
+			Exclude:       opts.SuperUsers,
+		},
+	}
+
+	var sanctions bot.SanctionRecorder
+	bans, err := bot.NewBans(bot.BansParams{SuperUser: opts.SuperUsers, StoreFile: opts.StatePath + "/bans.jsonl",
+		ExportPath: opts.StatePath})
+	if err == nil {
+		sanctions = bans
+		tgListener.Sanctions = bans
+	} else {
+		log.Printf("[ERROR] failed to load bans bot, %v", err)
+	}
+
+	podcasts := bot.NewPodcasts(httpClient, "https://radio-t.com/site-api", 5, opts.SuperUsers)
+	go podcasts.SyncNotes(ctx, opts.StatePath+"/episodes.json", time.Hour)
+	tgListener.Callbacks = map[string]bot.CallbackHandler{"search": podcasts}
+
+	news := bot.NewNews(httpClient, "https://news.radio-t.com/api", opts.NewsArticles)
+	if opts.NewsInterval > 0 {
+		go news.Push(ctx, bot.NewsPushParams{Submitter: &tgListener, StoreFile: opts.StatePath + "/news.json",
+			Interval: opts.NewsInterval})
+	}
+
+	bots := []bot.Interface{
+		broadcastStatus,
+		news,
+		bot.OffAir(bot.NewAnecdote(httpClient), broadcastStatus),
+		bot.OffAir(bot.NewStackOverflow(), broadcastStatus),
+		bot.NewDuck(opts.MashapeToken, httpClient),
+		podcasts,
+		bot.OffAir(bot.NewExcerpt(bot.ExcerptParams{Allow: opts.ExcerptAllow, Deny: opts.ExcerptDeny}), broadcastStatus),
+		bot.NewWTF(time.Hour*24, 7*time.Hour*24, opts.SuperUsers),
+		bot.NewBanhammer(tbAPI, opts.SuperUsers, 5000, sanctions, spamLearners...),
+	}
+
+	if bans != nil {
+		bots = append(bots, bans)
+	}
+
+	if ladder, err := bot.ParseWarnLadder(opts.WarnLadder); err == nil {
+		if wb, err := bot.NewWarnings(bot.WarningsParams{SuperUser: opts.SuperUsers, StoreFile: opts.StatePath + "/warnings.json",
+			Expiry: opts.WarnExpiry, Ladder: ladder, Recorder: sanctions}); err == nil {
+			bots = append(bots, wb)
+		} else {
+			log.Printf("[ERROR] failed to load warnings bot, %v", err)
+		}
+	} else {
+		log.Printf("[ERROR] bad warnings ladder, %v", err)
+	}
+
+	if classifier != nil {
+		bots = append(bots, bot.NewSpamReport(classifier, opts.SuperUsers))
+	}
+
+	if rb, err := bot.NewReminders(ctx, bot.ReminderParams{Submitter: &tgListener, SuperUser: opts.SuperUsers,
+		StoreFile: opts.StatePath + "/reminders.json", MaxPerUser: opts.MaxReminders}); err == nil {
+		bots = append(bots, rb)
+	} else {
+		log.Printf("[ERROR] failed to load reminders bot, %v", err)
+	}
+
+	if mb, err := bot.NewMarks(bot.MarksParams{Broadcast: broadcastStatus, SuperUser: opts.SuperUsers,
+		StoreFile: opts.StatePath + "/marks.json", ExportPath: opts.ExportPath}); err == nil {
+		bots = append(bots, mb) // checks broadcast itself, edit and export work after the show too
+	} else {
+		log.Printf("[ERROR] failed to load marks bot, %v", err)
+	}
+
+	if sb, err := bot.NewStats(ctx, bot.StatsParams{LogsPath: opts.LogsPath, BotUsername: tbAPI.Self.UserName}); err == nil {
+		bots = append(bots, sb)
+	} else {
+		log.Printf("[ERROR] failed to load stats bot, %v", err)
+	}
+
+	searchIndex := search.NewIndex(search.Params{LogsPath: opts.LogsPath, ExportPath: opts.ExportPath,
+		PagesURL: opts.SearchPagesURL})
+	go searchIndex.Run(ctx, time.Minute)
+	if lb, err := bot.NewLogSearch(searchIndex, opts.SearchResults); err == nil {
+		bots = append(bots, lb)
+	} else {
+		log.Printf("[ERROR] failed to load log search bot, %v", err)
+	}
+
+	prepNotifiers := []bot.PrepNotifier{broadcastStatus}
+	if tb, err := bot.NewTopics(opts.SuperUsers, opts.StatePath+"/topics.json", 20); err == nil {
+		bots = append(bots, tb)
+		prepNotifiers = append(prepNotifiers, tb)
+	} else {
+		log.Printf("[ERROR] failed to load topics bot, %v", err)
+	}
+	if sw, err := bot.NewSiteWatcher(bot.SiteWatcherParams{Client: httpClient, SiteAPI: "https://radio-t.com/site-api",
+		CheckDuration: 5 * time.Minute, StoreFile: opts.StatePath + "/site.json", Categories: []string{"podcast", "prep"},
+		Notifiers: prepNotifiers}); err == nil {
+		bots = append(bots, sw)
+	} else {
+		log.Printf("[ERROR] failed to load site watcher bot, %v", err)
+	}
+
+	if sb, err := bot.NewSys(opts.SysData); err == nil {
+		bots = append(bots, sb)
+	} else {
+		log.Printf("[ERROR] failed to load sysbot, %v", err)
 	}
 
+	if fw, err := bot.NewFeedWatcher(bot.FeedWatcherParams{Client: httpClient, Submitter: &tgListener,
+		ConfigFile: opts.SysData + "/feeds.data", StoreFile: opts.StatePath + "/feeds.json"}); err == nil {
+		go fw.Run(ctx, time.Minute)
+	} else {
+		log.Printf("[ERROR] failed to load feed watcher, %v", err)
+	}
+
+	tgListener.Bots = bot.NewMultiBot(bots...)
+
 	go events.Rtjc{Port: opts.RtjcPort, Submitter: &tgListener}.Listen(ctx)
 	if err := tgListener.Do(ctx); err != nil {
 		log.Fatalf("[ERROR] telegram listener failed, %v", err)
@@ -157,11 +333,12 @@ func export() {
 	}
 
 	params := reporter.ExporterParams{
-		InputRoot:    opts.LogsPath,
-		OutputRoot:   opts.ExportPath,
-		TemplateFile: opts.TemplateFile,
-		BotUsername:  botUser.UserName,
-		SuperUsers:   opts.SuperUsers,
+		InputRoot:      opts.LogsPath,
+		OutputRoot:     opts.ExportPath,
+		TemplateFile:   opts.TemplateFile,
+		BotUsername:    botUser.UserName,
+		SuperUsers:     opts.SuperUsers,
+		BroadcastsFile: opts.StatePath + "/broadcasts.json",
 		BroadcastUsers: events.SuperUser(
 			append(
 				[]string{botUser.UserName},
@@ -175,6 +352,29 @@ func export() {
 	}
 }
 
+func searchLogs() {
+	location, err := time.LoadLocation("Europe/Moscow")
+	if err != nil {
+		log.Fatalf("[ERROR] can't load location: %v", err)
+	}
+	q, err := search.ParseQuery(opts.SearchQuery, location)
+	if err != nil {
+		log.Fatalf("[ERROR] bad search query: %v", err)
+	}
+
+	index := search.NewIndex(search.Params{LogsPath: opts.LogsPath, ExportPath: opts.ExportPath,
+		PagesURL: opts.SearchPagesURL})
+	if err = index.Refresh(); err != nil {
+		log.Fatalf("[ERROR] can't build search index: %v", err)
+	}
+	log.Printf("[INFO] search %q in %d messages", opts.SearchQuery, index.Size())
+
+	for _, r := range index.Search(q, opts.SearchResults) {
+		fmt.Printf("%s %s (%s): %s %s\n", r.Sent.In(location).Format("2006-01-02 15:04:05"), r.Username,
+			r.DisplayName, r.Text, r.Link)
+	}
+}
+
 func setupLog(dbg bool) {
 	logOpts := []lgr.Option{lgr.Msec, lgr.LevelBraces}
 	if dbg {
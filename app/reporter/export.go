@@ -12,6 +12,7 @@ import (
 	"net/url"
 	"os"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
@@ -39,6 +40,7 @@ type ExporterParams struct {
 	BroadcastUsers SuperUser // Users who can send "bot.MsgBroadcastStarted" and "bot.MsgBroadcastStarted" messages.
 	// it maybe just bot, or bot + some or all SuperUsers.
 	// Cannot use SuperUsers field for same purpose becase they used to mark messages as "from host" in template
+	BroadcastsFile string // optional, broadcast records saved by bot.BroadcastStatus, define the messages window
 }
 
 // SuperUser knows which user is a superuser
@@ -75,13 +77,17 @@ func NewExporter(fileRecipient FileRecipient, storage Storage, params ExporterPa
 
 // Export to html with showNum
 func (e *Exporter) Export(showNum int, yyyymmdd int) error {
+	day := time.Now().In(e.location)
 	from := fmt.Sprintf("%s/%s.log", e.InputRoot, time.Now().Format("20060102")) // current day by default
 	if yyyymmdd != 0 {
 		from = fmt.Sprintf("%s/%d.log", e.InputRoot, yyyymmdd)
+		if d, err := time.ParseInLocation("20060102", strconv.Itoa(yyyymmdd), e.location); err == nil {
+			day = d
+		}
 	}
 	to := fmt.Sprintf("%s/radio-t-%d.html", e.OutputRoot, showNum)
 
-	messages, err := readMessages(from, e.ExporterParams.BroadcastUsers)
+	messages, err := readMessages(from, e.ExporterParams.BroadcastUsers, e.broadcast(showNum, day))
 	if err != nil {
 		return errors.Wrapf(err, "failed to read messages from %s", from)
 	}
@@ -215,7 +221,37 @@ func (e *Exporter) maybeDownloadFile(fileID string) error {
 	return nil
 }
 
-func readMessages(path string, broadcastUsers SuperUser) ([]bot.Message, error) {
+// broadcast finds the broadcast record of the show, or the last one started on the day. Returns nil if not found
+func (e *Exporter) broadcast(showNum int, day time.Time) *bot.BroadcastRecord {
+	if e.BroadcastsFile == "" {
+		return nil
+	}
+	records, err := bot.LoadBroadcastRecords(e.BroadcastsFile)
+	if err != nil {
+		log.Printf("[WARN] can't load broadcast records, %v", err)
+		return nil
+	}
+
+	var res *bot.BroadcastRecord
+	for i := range records {
+		rec := records[i]
+		if showNum > 0 && rec.Show == showNum {
+			return &rec
+		}
+		started := rec.Started.In(e.location)
+		if started.Year() == day.Year() && started.YearDay() == day.YearDay() {
+			res = &rec
+		}
+	}
+	if res != nil && res.Show != 0 && res.Show != showNum {
+		log.Printf("[WARN] broadcast of %s is #%d, not #%d", day.Format("2006-01-02"), res.Show, showNum)
+	}
+	return res
+}
+
+// readMessages loads messages from the log file. Messages of the broadcast are selected by its record
+// if defined, or by "broadcast started/finished" messages otherwise
+func readMessages(path string, broadcastUsers SuperUser, broadcast *bot.BroadcastRecord) ([]bot.Message, error) {
 	file, err := os.Open(path) // nolint
 	if err != nil {
 		return nil, err
@@ -242,6 +278,11 @@ func readMessages(path string, broadcastUsers SuperUser) ([]bot.Message, error)
 			continue
 		}
 
+		if broadcast != nil && (msg.Sent.Before(broadcast.Started) ||
+			!broadcast.Ended.IsZero() && msg.Sent.After(broadcast.Ended)) {
+			continue
+		}
+
 		if broadcastUsers != nil && broadcastUsers.IsSuper(msg.From.Username) {
 			// if received message from bot/user who can send "broadcast" messages
 			if strings.Contains(msg.Text, bot.MsgBroadcastStarted) {
@@ -266,6 +307,11 @@ func readMessages(path string, broadcastUsers SuperUser) ([]bot.Message, error)
 		currentIndex++
 	}
 
+	if broadcast != nil {
+		log.Printf("[INFO] broadcast window %v - %v", broadcast.Started, broadcast.Ended)
+		return messages, scanner.Err()
+	}
+
 	if broadcastStartedIndex == 0 {
 		log.Print(`[WARN] "BroadcastStarted" message not found, exporting messages from the beginning`)
 	}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"html/template"
 	"io"
+	"io/ioutil"
 	"os"
 	"strconv"
 	"testing"
@@ -102,7 +103,7 @@ func Test_readMessages(t *testing.T) {
 				defer os.Remove(testFile)
 				assert.NoError(t, err)
 			}
-			msgs, err := readMessages(testFile, nil)
+			msgs, err := readMessages(testFile, nil, nil)
 			if tt.fail {
 				assert.Error(t, err)
 			}
@@ -255,13 +256,61 @@ func Test_readMessagesCheckBroadcastMessages(t *testing.T) {
 			defer os.Remove(testFile)
 			assert.NoError(t, err)
 
-			msgs, err := readMessages(testFile, tt.broadcastUsers)
+			msgs, err := readMessages(testFile, tt.broadcastUsers, nil)
 			assert.NoError(t, err)
 			assert.Equal(t, tt.out, msgs)
 		})
 	}
 }
 
+func Test_readMessagesBroadcastWindow(t *testing.T) {
+	started := time.Date(2022, 5, 14, 20, 0, 0, 0, time.UTC)
+	in := []bot.Message{
+		{Text: "before", Sent: started.Add(-time.Minute)},
+		{Text: bot.MsgBroadcastStarted, From: bot.User{Username: "radio-t-bot"}, Sent: started},
+		{Text: "message-1", Sent: started.Add(time.Minute)},
+		{Text: bot.MsgBroadcastFinished, From: bot.User{Username: "radio-t-bot"}, Sent: started.Add(time.Hour)},
+		{Text: "message-2", Sent: started.Add(2 * time.Hour)},
+		{Text: "after", Sent: started.Add(4 * time.Hour)},
+	}
+	err := createFile(testFile, in)
+	assert.NoError(t, err)
+	defer os.Remove(testFile)
+
+	// the broadcast record wins over messages
+	msgs, err := readMessages(testFile, SuperUserMock{"radio-t-bot": true},
+		&bot.BroadcastRecord{Started: started, Ended: started.Add(3 * time.Hour)})
+	assert.NoError(t, err)
+	assert.Equal(t, []bot.Message{in[2], in[4]}, msgs)
+
+	// not finished broadcast
+	msgs, err = readMessages(testFile, nil, &bot.BroadcastRecord{Started: started.Add(time.Hour)})
+	assert.NoError(t, err)
+	assert.Equal(t, in[3:], msgs)
+}
+
+func TestExporter_broadcast(t *testing.T) {
+	e, err := setup(nil, nil)
+	assert.NoError(t, err)
+	defer teardown()
+
+	assert.Nil(t, e.broadcast(800, time.Now()), "no records file")
+
+	recs := []bot.BroadcastRecord{
+		{Started: time.Date(2022, 5, 7, 20, 0, 0, 0, time.UTC), Ended: time.Date(2022, 5, 7, 23, 0, 0, 0, time.UTC), Show: 799},
+		{Started: time.Date(2022, 5, 14, 17, 0, 0, 0, time.UTC), Ended: time.Date(2022, 5, 14, 17, 5, 0, 0, time.UTC)},
+		{Started: time.Date(2022, 5, 14, 20, 0, 0, 0, time.UTC), Ended: time.Date(2022, 5, 14, 23, 0, 0, 0, time.UTC)},
+	}
+	data, err := json.Marshal(map[string]interface{}{"records": recs})
+	assert.NoError(t, err)
+	e.BroadcastsFile = "output/broadcasts.json"
+	assert.NoError(t, ioutil.WriteFile(e.BroadcastsFile, data, 0600))
+
+	assert.Equal(t, &recs[0], e.broadcast(799, time.Date(2022, 5, 14, 0, 0, 0, 0, e.location)), "by show number")
+	assert.Equal(t, &recs[2], e.broadcast(800, time.Date(2022, 5, 14, 0, 0, 0, 0, e.location)), "the last of the day")
+	assert.Nil(t, e.broadcast(801, time.Date(2022, 5, 21, 0, 0, 0, 0, e.location)))
+}
+
 func Test_downloadFilesNeverCalledForTextMessages(t *testing.T) {
 	msgs := []bot.Message{
 		{
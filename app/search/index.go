@@ -0,0 +1,233 @@
+// Package search implements local full-text index of the chat archive. The index is fed from reporter's
+// daily JSONL logs, both history and live appends, and knows which exported HTML page has the message
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/radio-t/super-bot/app/storage"
+)
+
+// Index is in-memory inverted index of chat messages
+type Index struct {
+	Params
+
+	lock      sync.RWMutex
+	tail      *storage.LogTail
+	docs      []Document
+	postings  map[string][]int // term to docs positions, ascending
+	pages     map[int]string   // message ID to exported page file name
+	pagesSeen map[string]time.Time
+}
+
+// Params defines index sources
+type Params struct {
+	LogsPath   string // location of reporter's *.log files
+	ExportPath string // location of exported radio-t-*.html pages, optional
+	PagesURL   string // public url of exported pages, optional
+}
+
+// Document is one indexed message
+type Document struct {
+	ID          int
+	Sent        time.Time
+	Username    string
+	DisplayName string
+	Text        string
+}
+
+// Result is a found document with link to the exported page, if any
+type Result struct {
+	Document
+	Link string
+}
+
+// logRecord is a subset of bot.Message fields stored by reporter
+type logRecord struct {
+	ID   int
+	From struct {
+		Username    string
+		DisplayName string
+	}
+	Sent  time.Time
+	Text  string
+	Image *struct {
+		Caption string
+	}
+}
+
+var reAnchor = regexp.MustCompile(`id="msg-(\d+)"`)
+
+// NewIndex makes empty index, call Refresh or Run to fill it
+func NewIndex(params Params) *Index {
+	return &Index{Params: params, tail: storage.NewLogTail(params.LogsPath), postings: map[string][]int{},
+		pages: map[int]string{}, pagesSeen: map[string]time.Time{}}
+}
+
+// Run refreshes index periodically till ctx canceled
+func (i *Index) Run(ctx context.Context, interval time.Duration) {
+	log.Printf("[INFO] search index for %s, refresh every %v", i.LogsPath, interval)
+	for {
+		if err := i.Refresh(); err != nil {
+			log.Printf("[WARN] can't refresh search index, %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// Refresh adds new log records and new exported pages to the index
+func (i *Index) Refresh() error {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	before := len(i.docs)
+	err := i.tail.Read(func(fileName string, line []byte) {
+		rec := logRecord{}
+		if err := json.Unmarshal(line, &rec); err != nil {
+			log.Printf("[DEBUG] skip bad log line in %s, %v", fileName, err)
+			return
+		}
+		i.add(rec)
+	})
+	if err != nil {
+		return errors.Wrap(err, "can't read logs")
+	}
+	if len(i.docs) > before {
+		log.Printf("[DEBUG] indexed %d new messages, total %d", len(i.docs)-before, len(i.docs))
+	}
+	return i.scanPages()
+}
+
+// Search returns up to limit documents matching query, the newest first
+func (i *Index) Search(q Query, limit int) []Result {
+	i.lock.RLock()
+	defer i.lock.RUnlock()
+
+	var candidates []int
+	if len(q.Terms) > 0 {
+		candidates = i.postings[q.Terms[0]]
+		for _, t := range q.Terms[1:] {
+			candidates = intersect(candidates, i.postings[t])
+		}
+	} else {
+		candidates = make([]int, len(i.docs))
+		for n := range i.docs {
+			candidates[n] = n
+		}
+	}
+
+	var res []Result
+	for n := len(candidates) - 1; n >= 0 && (limit <= 0 || len(res) < limit); n-- { // docs added in time order
+		d := i.docs[candidates[n]]
+		if q.Author != "" && !strings.EqualFold(d.Username, q.Author) {
+			continue
+		}
+		if (!q.From.IsZero() && d.Sent.Before(q.From)) || (!q.To.IsZero() && !d.Sent.Before(q.To)) {
+			continue
+		}
+		r := Result{Document: d}
+		if page, ok := i.pages[d.ID]; ok && d.ID > 0 {
+			r.Link = strings.TrimSuffix(i.PagesURL, "/") + "/" + page + "#msg-" + strconv.Itoa(d.ID)
+		}
+		res = append(res, r)
+	}
+	return res
+}
+
+// Size returns number of indexed documents
+func (i *Index) Size() int {
+	i.lock.RLock()
+	defer i.lock.RUnlock()
+	return len(i.docs)
+}
+
+// add indexes one record, should be called under lock
+func (i *Index) add(rec logRecord) {
+	text := rec.Text
+	if rec.Image != nil && rec.Image.Caption != "" {
+		text = strings.TrimSpace(text + " " + rec.Image.Caption)
+	}
+	if text == "" {
+		return
+	}
+
+	pos := len(i.docs)
+	i.docs = append(i.docs, Document{ID: rec.ID, Sent: rec.Sent, Username: rec.From.Username,
+		DisplayName: rec.From.DisplayName, Text: text})
+
+	seen := map[string]bool{}
+	for _, t := range Tokenize(text) {
+		if seen[t] {
+			continue
+		}
+		seen[t] = true
+		i.postings[t] = append(i.postings[t], pos)
+	}
+}
+
+// scanPages collects message anchors from new or changed exported pages, should be called under lock
+func (i *Index) scanPages() error {
+	if i.ExportPath == "" {
+		return nil
+	}
+	files, err := filepath.Glob(filepath.Join(i.ExportPath, "radio-t-*.html"))
+	if err != nil {
+		return errors.Wrapf(err, "can't list %s", i.ExportPath)
+	}
+	for _, f := range files {
+		fi, err := os.Stat(f)
+		if err != nil {
+			continue
+		}
+		name := filepath.Base(f)
+		if ts, ok := i.pagesSeen[name]; ok && ts.Equal(fi.ModTime()) {
+			continue
+		}
+		data, err := ioutil.ReadFile(f) //nolint:gosec
+		if err != nil {
+			log.Printf("[WARN] can't read %s, %v", f, err)
+			continue
+		}
+		for _, m := range reAnchor.FindAllSubmatch(data, -1) {
+			if id, err := strconv.Atoi(string(m[1])); err == nil {
+				i.pages[id] = name
+			}
+		}
+		i.pagesSeen[name] = fi.ModTime()
+	}
+	return nil
+}
+
+// intersect returns common elements of two ascending lists
+func intersect(a, b []int) []int {
+	res := make([]int, 0, len(a))
+	for x, y := 0, 0; x < len(a) && y < len(b); {
+		switch {
+		case a[x] == b[y]:
+			res = append(res, a[x])
+			x++
+			y++
+		case a[x] < b[y]:
+			x++
+		default:
+			y++
+		}
+	}
+	return res
+}
@@ -0,0 +1,74 @@
+package search
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIndex_Search(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "search")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	logs := `{"ID":1,"From":{"Username":"umputun","DisplayName":"Umputun"},"Sent":"2021-03-06T20:00:00Z","Text":"Ссылка про докер https://example.com/docker"}
+{"ID":2,"From":{"Username":"bobuk","DisplayName":"Bobuk"},"Sent":"2021-03-06T20:01:00Z","Text":"докеры не нужны"}
+{"ID":3,"From":{"Username":"user","DisplayName":"User"},"Sent":"2021-03-06T20:02:00Z","Image":{"Caption":"картинка про докера"}}
+{"ID":4,"From":{"Username":"user","DisplayName":"User"},"Sent":"2021-03-06T20:03:00Z"}
+`
+	require.NoError(t, ioutil.WriteFile(path.Join(tmp, "20210306.log"), []byte(logs), 0600))
+	require.NoError(t, os.Mkdir(path.Join(tmp, "html"), 0700))
+	require.NoError(t, ioutil.WriteFile(path.Join(tmp, "html", "radio-t-745.html"),
+		[]byte(`<tr id="msg-1" class="host"></tr><tr id="msg-2"></tr>`), 0600))
+
+	idx := NewIndex(Params{LogsPath: tmp, ExportPath: path.Join(tmp, "html"), PagesURL: "https://chat.radio-t.com/logs/"})
+	require.NoError(t, idx.Refresh())
+	assert.Equal(t, 3, idx.Size())
+
+	res := idx.Search(Query{Terms: Tokenize("докер")}, 10)
+	require.Equal(t, 3, len(res))
+	assert.Equal(t, 3, res[0].ID, "newest first")
+	assert.Equal(t, "", res[0].Link)
+	assert.Equal(t, "картинка про докера", res[0].Text)
+	assert.Equal(t, "https://chat.radio-t.com/logs/radio-t-745.html#msg-1", res[2].Link)
+
+	res = idx.Search(Query{Terms: Tokenize("ссылки докеры")}, 10)
+	require.Equal(t, 1, len(res))
+	assert.Equal(t, 1, res[0].ID)
+
+	res = idx.Search(Query{Terms: Tokenize("докер"), Author: "BOBUK"}, 10)
+	require.Equal(t, 1, len(res))
+	assert.Equal(t, 2, res[0].ID)
+
+	res = idx.Search(Query{Terms: Tokenize("докер")}, 1)
+	assert.Equal(t, 1, len(res))
+
+	res = idx.Search(Query{Terms: Tokenize("кубернетес")}, 10)
+	assert.Empty(t, res)
+
+	// live append
+	fh, err := os.OpenFile(path.Join(tmp, "20210306.log"), os.O_APPEND|os.O_WRONLY, 0600)
+	require.NoError(t, err)
+	_, err = fh.WriteString(`{"ID":5,"From":{"Username":"user"},"Sent":"2021-03-07T10:00:00Z","Text":"опять докер"}` + "\n")
+	require.NoError(t, err)
+	require.NoError(t, fh.Close())
+	require.NoError(t, idx.Refresh())
+
+	res = idx.Search(Query{Terms: Tokenize("докер"), From: time.Date(2021, 3, 7, 0, 0, 0, 0, time.UTC)}, 10)
+	require.Equal(t, 1, len(res))
+	assert.Equal(t, 5, res[0].ID)
+
+	res = idx.Search(Query{Author: "user", To: time.Date(2021, 3, 7, 0, 0, 0, 0, time.UTC)}, 10)
+	require.Equal(t, 1, len(res))
+	assert.Equal(t, 3, res[0].ID)
+}
+
+func TestIntersect(t *testing.T) {
+	assert.Equal(t, []int{2, 5}, intersect([]int{1, 2, 3, 5, 8}, []int{2, 4, 5, 9}))
+	assert.Equal(t, []int{}, intersect([]int{1}, nil))
+}
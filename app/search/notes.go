@@ -0,0 +1,357 @@
+package search
+
+import (
+	"math"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// NotesIndex is in-memory full-text index of podcast show notes. Query words are stemmed and matched
+// with typos, episodes ranked by relevance of matched notes
+type NotesIndex struct {
+	lock     sync.RWMutex
+	episodes []Episode
+	byNum    map[int]int      // episode number to position in episodes
+	postings map[string][]hit // term to notes having it
+	df       map[string]int   // term to number of episodes having it
+	terms    map[int][]string // vocabulary by term length, for typo tolerant lookup
+	notes    []noteRef        // all indexed notes
+	known    map[string]bool  // vocabulary
+	stale    map[int]bool     // positions of replaced episodes, skipped in search
+}
+
+// Episode is a podcast episode with show notes
+type Episode struct {
+	Num   int       `json:"num"`
+	Title string    `json:"title"`
+	URL   string    `json:"url"`
+	Date  time.Time `json:"date"`
+	Notes []Note    `json:"notes"`
+}
+
+// Note is one topic of show notes with optional link
+type Note struct {
+	Text string `json:"text"`
+	Link string `json:"link,omitempty"`
+}
+
+// NotesResult is a found episode with matched notes
+type NotesResult struct {
+	Episode
+	Matches []NoteMatch
+	Score   float64
+}
+
+// NoteMatch is a matched note, InText is false if only the link matched
+type NoteMatch struct {
+	Note
+	InText bool
+}
+
+type noteRef struct {
+	episode int // position in episodes
+	note    int // position in episode's notes
+}
+
+type hit struct {
+	note   int // position in notes
+	inText bool
+}
+
+// NewNotesIndex makes empty show notes index
+func NewNotesIndex() *NotesIndex {
+	return &NotesIndex{byNum: map[int]int{}, postings: map[string][]hit{}, df: map[string]int{},
+		terms: map[int][]string{}, known: map[string]bool{}, stale: map[int]bool{}}
+}
+
+// Add indexes episodes, an episode with already indexed number replaces the old one
+func (n *NotesIndex) Add(episodes ...Episode) {
+	n.lock.Lock()
+	defer n.lock.Unlock()
+
+	for _, ep := range episodes {
+		if pos, ok := n.byNum[ep.Num]; ok {
+			if sameEpisode(n.episodes[pos], ep) {
+				continue
+			}
+			n.stale[pos] = true
+			for t := range episodeTerms(n.episodes[pos]) {
+				n.df[t]--
+			}
+		}
+		pos := len(n.episodes)
+		n.episodes = append(n.episodes, ep)
+		n.byNum[ep.Num] = pos
+
+		for i, note := range ep.Notes {
+			ref := len(n.notes)
+			n.notes = append(n.notes, noteRef{episode: pos, note: i})
+			textTerms := map[string]bool{}
+			for _, t := range Tokenize(note.Text) {
+				textTerms[t] = true
+			}
+			for t := range textTerms {
+				n.addTerm(t, hit{note: ref, inText: true})
+			}
+			for _, t := range Tokenize(linkWords(note.Link)) {
+				if !textTerms[t] {
+					textTerms[t] = true
+					n.addTerm(t, hit{note: ref})
+				}
+			}
+		}
+		for t := range episodeTerms(ep) {
+			n.df[t]++
+		}
+	}
+}
+
+// Size returns number of indexed episodes
+func (n *NotesIndex) Size() int {
+	n.lock.RLock()
+	defer n.lock.RUnlock()
+	return len(n.byNum)
+}
+
+// Latest returns the largest indexed episode number
+func (n *NotesIndex) Latest() (res int) {
+	n.lock.RLock()
+	defer n.lock.RUnlock()
+	for num := range n.byNum {
+		if num > res {
+			res = num
+		}
+	}
+	return res
+}
+
+// Episodes returns all indexed episodes, ordered by number
+func (n *NotesIndex) Episodes() []Episode {
+	n.lock.RLock()
+	defer n.lock.RUnlock()
+	res := make([]Episode, 0, len(n.byNum))
+	for _, pos := range n.byNum {
+		res = append(res, n.episodes[pos])
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Num < res[j].Num })
+	return res
+}
+
+// Search returns up to limit episodes having all words of the query, the most relevant first
+func (n *NotesIndex) Search(query string, limit int) []NotesResult {
+	n.lock.RLock()
+	defer n.lock.RUnlock()
+
+	words := Tokenize(query)
+	if len(words) == 0 {
+		return nil
+	}
+
+	total := float64(len(n.byNum))
+	scores := map[int][]float64{}          // episode position to score of each query word
+	matches := map[int]map[int]NoteMatch{} // episode position to matched notes by note position
+	for qi, w := range words {
+		for term, weight := range n.expand(w) {
+			idf := math.Log(1 + total/float64(n.df[term]+1))
+			for _, h := range n.postings[term] {
+				ref := n.notes[h.note]
+				if n.stale[ref.episode] {
+					continue
+				}
+				score := weight * idf
+				if !h.inText {
+					score /= 2 // link words are less relevant
+				}
+				if scores[ref.episode] == nil {
+					scores[ref.episode] = make([]float64, len(words))
+					matches[ref.episode] = map[int]NoteMatch{}
+				}
+				if score > scores[ref.episode][qi] {
+					scores[ref.episode][qi] = score
+				}
+				m := matches[ref.episode][ref.note]
+				m.Note = n.episodes[ref.episode].Notes[ref.note]
+				m.InText = m.InText || h.inText
+				matches[ref.episode][ref.note] = m
+			}
+		}
+	}
+
+	var res []NotesResult
+	for pos, ss := range scores {
+		r := NotesResult{Episode: n.episodes[pos]}
+		all := true
+		for _, s := range ss {
+			all = all && s > 0
+			r.Score += s
+		}
+		if !all {
+			continue
+		}
+		r.Score += float64(len(matches[pos])-1) * 0.1 // more matched notes, more relevant
+		notes := make([]int, 0, len(matches[pos]))
+		for i := range matches[pos] {
+			notes = append(notes, i)
+		}
+		sort.Ints(notes)
+		for _, i := range notes {
+			r.Matches = append(r.Matches, matches[pos][i])
+		}
+		res = append(res, r)
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		if math.Abs(res[i].Score-res[j].Score) > 1e-9 {
+			return res[i].Score > res[j].Score
+		}
+		return res[i].Num > res[j].Num // the newest first for equal relevance
+	})
+	if limit > 0 && len(res) > limit {
+		res = res[:limit]
+	}
+	return res
+}
+
+// addTerm adds posting of the term, should be called under lock
+func (n *NotesIndex) addTerm(t string, h hit) {
+	n.postings[t] = append(n.postings[t], h)
+	if !n.known[t] {
+		n.known[t] = true
+		l := len([]rune(t))
+		n.terms[l] = append(n.terms[l], t)
+	}
+}
+
+// expand returns indexed terms matching the word with their weights. The word itself weights 1,
+// terms with typos (one edit for 4+ letters, two for 8+) weight less
+func (n *NotesIndex) expand(word string) map[string]float64 {
+	res := map[string]float64{}
+	if n.known[word] {
+		res[word] = 1
+	}
+	size := len([]rune(word))
+	maxEdits := 0
+	switch {
+	case size >= 8:
+		maxEdits = 2
+	case size >= 4:
+		maxEdits = 1
+	}
+	for l := size - maxEdits; l <= size+maxEdits; l++ {
+		for _, t := range n.terms[l] {
+			if t == word {
+				continue
+			}
+			if d := editDistance(word, t, maxEdits); d <= maxEdits {
+				res[t] = 1 / float64(2*d)
+			}
+		}
+	}
+	return res
+}
+
+// sameEpisode checks if episodes have the same content
+func sameEpisode(a, b Episode) bool {
+	if a.Num != b.Num || a.Title != b.Title || a.URL != b.URL || !a.Date.Equal(b.Date) || len(a.Notes) != len(b.Notes) {
+		return false
+	}
+	for i := range a.Notes {
+		if a.Notes[i] != b.Notes[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// episodeTerms returns unique terms of episode's notes and links
+func episodeTerms(ep Episode) map[string]bool {
+	res := map[string]bool{}
+	for _, note := range ep.Notes {
+		for _, t := range Tokenize(note.Text + " " + linkWords(note.Link)) {
+			res[t] = true
+		}
+	}
+	return res
+}
+
+// linkWords returns words of the link's host and path, without scheme, www and common tlds
+func linkWords(link string) string {
+	if link == "" {
+		return ""
+	}
+	u, err := url.Parse(link)
+	if err != nil {
+		return ""
+	}
+	words := strings.FieldsFunc(strings.TrimPrefix(u.Hostname(), "www.")+" "+u.Path, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	res := make([]string, 0, len(words))
+	for _, w := range words {
+		switch w {
+		case "com", "org", "net", "io", "ru", "html", "htm", "php":
+			continue
+		}
+		res = append(res, w)
+	}
+	return strings.Join(res, " ")
+}
+
+// editDistance returns Damerau-Levenshtein (optimal string alignment) distance between a and b,
+// any value above max returned as max+1
+func editDistance(a, b string, max int) int {
+	ra, rb := []rune(a), []rune(b)
+	if abs(len(ra)-len(rb)) > max {
+		return max + 1
+	}
+	prev2 := make([]int, len(rb)+1)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		rowMin := curr[0]
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = minInt(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				curr[j] = minInt(curr[j], prev2[j-2]+1)
+			}
+			rowMin = minInt(rowMin, curr[j])
+		}
+		if rowMin > max {
+			return max + 1
+		}
+		prev2, prev, curr = prev, curr, prev2
+	}
+	if prev[len(rb)] > max {
+		return max + 1
+	}
+	return prev[len(rb)]
+}
+
+func minInt(vals ...int) int {
+	res := vals[0]
+	for _, v := range vals[1:] {
+		if v < res {
+			res = v
+		}
+	}
+	return res
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
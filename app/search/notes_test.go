@@ -0,0 +1,110 @@
+package search
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNotesIndex_Search(t *testing.T) {
+	idx := NewNotesIndex()
+	idx.Add(
+		Episode{Num: 700, Title: "Радио-Т 700", Notes: []Note{
+			{Text: "Докер и контейнеры в продакшене", Link: "https://docker.com/blog"},
+			{Text: "Новости Go"},
+		}},
+		Episode{Num: 701, Title: "Радио-Т 701", Notes: []Note{
+			{Text: "Kubernetes для всех", Link: "https://kubernetes.io/docs/containers"},
+			{Text: "Облачные базы данных"},
+		}},
+		Episode{Num: 702, Title: "Радио-Т 702", Notes: []Note{
+			{Text: "Все про контейнеры", Link: "https://example.com/docker-security"},
+			{Text: "Контейнеры и докер, еще раз", Link: "https://example.com/docker"},
+			{Text: "Разное"},
+		}},
+	)
+	assert.Equal(t, 3, idx.Size())
+	assert.Equal(t, 702, idx.Latest())
+
+	tbl := []struct {
+		query string
+		nums  []int
+	}{
+		{"докер", []int{702, 700}},
+		{"докеры", []int{702, 700}}, // stemming
+		{"контейнерами", []int{702, 700}},
+		{"containers", []int{701}}, // link match
+		{"контейнеры докер", []int{702, 700}},
+		{"кантейнеры", []int{702, 700}}, // typo
+		{"kubernets", []int{701}},       // typo
+		{"облачных базах", []int{701}},
+		{"докер облачные", nil},
+		{"и в на", nil},
+		{"", nil},
+	}
+	for i, tt := range tbl {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			var nums []int
+			for _, r := range idx.Search(tt.query, 10) {
+				nums = append(nums, r.Num)
+			}
+			assert.Equal(t, tt.nums, nums)
+		})
+	}
+
+	res := idx.Search("docker", 1)
+	require.Equal(t, 1, len(res), "limited")
+	assert.Equal(t, 702, res[0].Num)
+	assert.Equal(t, []NoteMatch{
+		{Note: Note{Text: "Все про контейнеры", Link: "https://example.com/docker-security"}},
+		{Note: Note{Text: "Контейнеры и докер, еще раз", Link: "https://example.com/docker"}},
+	}, res[0].Matches, "link matches only")
+
+	res = idx.Search("докер", 10)
+	assert.Equal(t, []NoteMatch{{Note: Note{Text: "Контейнеры и докер, еще раз", Link: "https://example.com/docker"},
+		InText: true}}, res[0].Matches)
+}
+
+func TestNotesIndex_Replace(t *testing.T) {
+	idx := NewNotesIndex()
+	date := time.Date(2022, 5, 14, 20, 0, 0, 0, time.UTC)
+	idx.Add(Episode{Num: 800, Date: date, Notes: []Note{{Text: "Черновик про Rust"}}})
+	idx.Add(Episode{Num: 800, Date: date, Notes: []Note{{Text: "Черновик про Rust"}}})
+	assert.Equal(t, 1, len(idx.episodes), "same episode not added again")
+
+	idx.Add(Episode{Num: 800, Date: date, Notes: []Note{{Text: "Финальная версия про Zig"}}})
+	assert.Equal(t, 1, idx.Size())
+	assert.Empty(t, idx.Search("rust", 10))
+	require.Equal(t, 1, len(idx.Search("zig", 10)))
+	assert.Equal(t, 0, idx.df["rust"])
+}
+
+func TestEditDistance(t *testing.T) {
+	tbl := []struct {
+		a, b string
+		max  int
+		res  int
+	}{
+		{"докер", "докер", 1, 0},
+		{"докер", "доекр", 1, 1},
+		{"докер", "докр", 1, 1},
+		{"докер", "дакер", 1, 1},
+		{"докер", "дакир", 1, 2},
+		{"kubernetes", "kubernets", 2, 1},
+		{"go", "rust", 1, 2},
+	}
+	for i, tt := range tbl {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			assert.Equal(t, tt.res, editDistance(tt.a, tt.b, tt.max))
+		})
+	}
+}
+
+func TestLinkWords(t *testing.T) {
+	assert.Equal(t, "kubernetes docs containers", linkWords("https://kubernetes.io/docs/containers"))
+	assert.Equal(t, "blog golang go1 18 index", linkWords("https://www.blog.golang.org/go1.18/index.html"))
+	assert.Equal(t, "", linkWords(""))
+}
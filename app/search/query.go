@@ -0,0 +1,67 @@
+package search
+
+import (
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Query defines search request. Terms are stemmed words, all of them should be found
+type Query struct {
+	Terms  []string
+	Author string    // username without @, case insensitive
+	From   time.Time // inclusive, zero for unlimited
+	To     time.Time // exclusive, zero for unlimited
+}
+
+var dateFormats = []string{"2006-01-02", "02.01.2006", "20060102"}
+
+// ParseQuery makes Query from text like "docker from:umputun after:2021-01-01 before:2021-02-01".
+// Supported filters: from:user (or @user), date:day, after:day and before:day, days are in loc zone
+func ParseQuery(text string, loc *time.Location) (q Query, err error) {
+	var words []string
+	for _, f := range strings.Fields(text) {
+		key, val := "", f
+		if idx := strings.Index(f, ":"); idx > 0 {
+			key, val = strings.ToLower(f[:idx]), f[idx+1:]
+		}
+
+		switch {
+		case strings.HasPrefix(f, "@") && len(f) > 1:
+			q.Author = strings.TrimPrefix(f, "@")
+		case key == "from":
+			q.Author = strings.TrimPrefix(val, "@")
+		case key == "date" || key == "after" || key == "before":
+			day, e := parseDay(val, loc)
+			if e != nil {
+				return q, e
+			}
+			switch key {
+			case "date":
+				q.From, q.To = day, day.AddDate(0, 0, 1)
+			case "after":
+				q.From = day
+			case "before":
+				q.To = day
+			}
+		default:
+			words = append(words, f)
+		}
+	}
+
+	q.Terms = Tokenize(strings.Join(words, " "))
+	if len(q.Terms) == 0 && q.Author == "" && q.From.IsZero() && q.To.IsZero() {
+		return q, errors.New("empty query")
+	}
+	return q, nil
+}
+
+func parseDay(s string, loc *time.Location) (time.Time, error) {
+	for _, f := range dateFormats {
+		if t, err := time.ParseInLocation(f, s, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, errors.Errorf("can't parse date %q", s)
+}
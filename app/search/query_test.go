@@ -0,0 +1,44 @@
+package search
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseQuery(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/Moscow")
+	require.NoError(t, err)
+
+	tbl := []struct {
+		text string
+		q    Query
+		fail bool
+	}{
+		{"докер", Query{Terms: []string{"докер"}}, false},
+		{"ссылка про докер from:umputun", Query{Terms: []string{"ссылк", "про", "докер"}, Author: "umputun"}, false},
+		{"@bobuk kubernetes", Query{Terms: []string{"kubernet"}, Author: "bobuk"}, false},
+		{"go date:2021-03-01", Query{Terms: []string{"go"}, From: time.Date(2021, 3, 1, 0, 0, 0, 0, loc),
+			To: time.Date(2021, 3, 2, 0, 0, 0, 0, loc)}, false},
+		{"go after:01.02.2021 before:20210301", Query{Terms: []string{"go"}, From: time.Date(2021, 2, 1, 0, 0, 0, 0, loc),
+			To: time.Date(2021, 3, 1, 0, 0, 0, 0, loc)}, false},
+		{"from:umputun", Query{Terms: []string{}, Author: "umputun"}, false},
+		{"go date:yesterday", Query{}, true},
+		{"и на", Query{}, true},
+	}
+
+	for i, tt := range tbl {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			q, err := ParseQuery(tt.text, loc)
+			if tt.fail {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.q, q)
+		})
+	}
+}
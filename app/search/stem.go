@@ -0,0 +1,208 @@
+package search
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Tokenize splits text to lower-cased words and stems them. Russian words stemmed with snowball-like
+// algorithm, english ones with light suffix stripping. Short words and stop words are dropped
+func Tokenize(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	res := make([]string, 0, len(words))
+	for _, w := range words {
+		w = strings.ReplaceAll(w, "ё", "е")
+		if len([]rune(w)) < 2 || stopWords[w] {
+			continue
+		}
+		res = append(res, Stem(w))
+	}
+	return res
+}
+
+// Stem returns stem of the lower-cased word, detects language by the first letter
+func Stem(word string) string {
+	runes := []rune(word)
+	if len(runes) == 0 {
+		return word
+	}
+	if unicode.Is(unicode.Cyrillic, runes[0]) {
+		return string(stemRu(runes))
+	}
+	if runes[0] < unicode.MaxASCII && unicode.IsLetter(runes[0]) {
+		return stemEn(word)
+	}
+	return word
+}
+
+var stopWords = map[string]bool{
+	"и": true, "в": true, "во": true, "не": true, "что": true, "он": true, "на": true, "я": true, "с": true,
+	"со": true, "как": true, "а": true, "то": true, "все": true, "она": true, "так": true, "его": true,
+	"но": true, "да": true, "ты": true, "к": true, "у": true, "же": true, "вы": true, "за": true, "бы": true,
+	"по": true, "от": true, "из": true, "ну": true, "ли": true, "это": true,
+	"the": true, "a": true, "an": true, "and": true, "or": true, "of": true, "to": true, "in": true, "is": true,
+	"it": true, "for": true, "on": true, "at": true, "be": true, "by": true,
+}
+
+// suffixes sorted by length, the longest first
+type suffixes []string
+
+func newSuffixes(ss ...string) suffixes {
+	sort.SliceStable(ss, func(i, j int) bool { return len([]rune(ss[i])) > len([]rune(ss[j])) })
+	return ss
+}
+
+// find returns the longest suffix of w (starting not before pos) from the list,
+// with optional requirement to be preceded by "а" or "я"
+func (ss suffixes) find(w []rune, pos int, afterAYa bool) (string, bool) {
+	s := string(w)
+	for _, sfx := range ss {
+		if !strings.HasSuffix(s, sfx) {
+			continue
+		}
+		start := len(w) - len([]rune(sfx))
+		if start < pos {
+			continue
+		}
+		if afterAYa && (start == 0 || start-1 < pos || (w[start-1] != 'а' && w[start-1] != 'я')) {
+			continue
+		}
+		return sfx, true
+	}
+	return "", false
+}
+
+var (
+	ruGerund1     = newSuffixes("в", "вши", "вшись")
+	ruGerund2     = newSuffixes("ив", "ивши", "ившись", "ыв", "ывши", "ывшись")
+	ruReflexive   = newSuffixes("ся", "сь")
+	ruAdjective   = newSuffixes("ее", "ие", "ые", "ое", "ими", "ыми", "ей", "ий", "ый", "ой", "ем", "им", "ым", "ом", "его", "ого", "ему", "ому", "их", "ых", "ую", "юю", "ая", "яя", "ою", "ею")
+	ruParticiple1 = newSuffixes("ем", "нн", "вш", "ющ", "щ")
+	ruParticiple2 = newSuffixes("ивш", "ывш", "ующ")
+	ruVerb1       = newSuffixes("ла", "на", "ете", "йте", "ли", "й", "л", "ем", "н", "ло", "но", "ет", "ют", "ны", "ть", "ешь", "нно")
+	ruVerb2       = newSuffixes("ила", "ыла", "ена", "ейте", "уйте", "ите", "или", "ыли", "ей", "уй", "ил", "ыл", "им", "ым", "ен", "ило", "ыло", "ено", "ят", "ует", "уют", "ит", "ыт", "ены", "ить", "ыть", "ишь", "ую", "ю")
+	ruNoun        = newSuffixes("а", "ев", "ов", "ие", "ье", "е", "иями", "ями", "ами", "еи", "ии", "и", "ией", "ей", "ой", "ий", "й", "иям", "ям", "ием", "ем", "ам", "ом", "о", "у", "ах", "иях", "ях", "ы", "ь", "ию", "ью", "ю", "ия", "ья", "я")
+	ruDerivation  = newSuffixes("ост", "ость")
+	ruSuperlative = newSuffixes("ейш", "ейше")
+)
+
+func isRuVowel(r rune) bool {
+	return strings.ContainsRune("аеиоуыэюя", r)
+}
+
+// stemRu implements russian snowball stemmer
+func stemRu(w []rune) []rune {
+	rv, r2 := ruRegions(w)
+	if rv >= len(w) {
+		return w
+	}
+
+	trim := func(sfx string) { w = w[:len(w)-len([]rune(sfx))] }
+
+	// step 1
+	if sfx, ok := ruGerund1.find(w, rv, true); ok {
+		trim(sfx)
+	} else if sfx, ok := ruGerund2.find(w, rv, false); ok {
+		trim(sfx)
+	} else {
+		if sfx, ok := ruReflexive.find(w, rv, false); ok {
+			trim(sfx)
+		}
+		if sfx, ok := ruAdjective.find(w, rv, false); ok {
+			trim(sfx)
+			if sfx, ok := ruParticiple1.find(w, rv, true); ok {
+				trim(sfx)
+			} else if sfx, ok := ruParticiple2.find(w, rv, false); ok {
+				trim(sfx)
+			}
+		} else if sfx, ok := ruVerb1.find(w, rv, true); ok {
+			trim(sfx)
+		} else if sfx, ok := ruVerb2.find(w, rv, false); ok {
+			trim(sfx)
+		} else if sfx, ok := ruNoun.find(w, rv, false); ok {
+			trim(sfx)
+		}
+	}
+
+	// step 2
+	if len(w) > rv && w[len(w)-1] == 'и' {
+		w = w[:len(w)-1]
+	}
+
+	// step 3
+	if sfx, ok := ruDerivation.find(w, r2, false); ok {
+		trim(sfx)
+	}
+
+	// step 4
+	switch {
+	case len(w)-2 >= rv && strings.HasSuffix(string(w), "нн"):
+		w = w[:len(w)-1]
+	case len(w) > rv && w[len(w)-1] == 'ь':
+		w = w[:len(w)-1]
+	default:
+		if sfx, ok := ruSuperlative.find(w, rv, false); ok {
+			trim(sfx)
+			if len(w)-2 >= rv && strings.HasSuffix(string(w), "нн") {
+				w = w[:len(w)-1]
+			}
+		}
+	}
+	return w
+}
+
+// ruRegions returns start of RV (after the first vowel) and R2 regions
+func ruRegions(w []rune) (rv, r2 int) {
+	rv, r1 := len(w), len(w)
+	for i, r := range w {
+		if isRuVowel(r) {
+			rv = i + 1
+			break
+		}
+	}
+	for i := 1; i < len(w); i++ {
+		if !isRuVowel(w[i]) && isRuVowel(w[i-1]) {
+			r1 = i + 1
+			break
+		}
+	}
+	r2 = len(w)
+	for i := r1 + 1; i < len(w); i++ {
+		if !isRuVowel(w[i]) && isRuVowel(w[i-1]) {
+			r2 = i + 1
+			break
+		}
+	}
+	return rv, r2
+}
+
+// enRules is a list of suffix replacements applied once, the first matching wins
+var enRules = []struct {
+	suffix, repl string
+}{
+	{"ational", "ate"}, {"ization", "ize"}, {"fulness", "ful"}, {"ousness", "ous"}, {"iveness", "ive"},
+	{"ingly", ""}, {"edly", ""}, {"ments", ""}, {"ment", ""}, {"ness", ""}, {"ings", ""}, {"ing", ""},
+	{"ies", "y"}, {"ied", "y"}, {"sses", "ss"}, {"ed", ""}, {"es", ""}, {"ly", ""}, {"s", ""},
+}
+
+// stemEn strips the common english suffixes, keeps at least 3 letters of the stem
+func stemEn(w string) string {
+	if strings.HasSuffix(w, "ss") || strings.HasSuffix(w, "us") || strings.HasSuffix(w, "is") {
+		return w
+	}
+	for _, r := range enRules {
+		if strings.HasSuffix(w, r.suffix) && len(w)-len(r.suffix) >= 3 {
+			w = strings.TrimSuffix(w, r.suffix) + r.repl
+			break
+		}
+	}
+	// undouble the final consonant left after -ing/-ed removal, i.e. "running" -> "runn" -> "run"
+	if n := len(w); n > 3 && w[n-1] == w[n-2] && !strings.ContainsRune("aeiouls", rune(w[n-1])) {
+		w = w[:n-1]
+	}
+	return w
+}
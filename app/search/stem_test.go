@@ -0,0 +1,37 @@
+package search
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStem(t *testing.T) {
+	tbl := map[string]string{
+		"докера":           "докер",
+		"контейнерами":     "контейнер",
+		"ссылку":           "ссылк",
+		"ссылки":           "ссылк",
+		"говорили":         "говор",
+		"говорить":         "говор",
+		"красивейший":      "красив",
+		"программированию": "программирован",
+		"новостей":         "новост",
+		"running":          "run",
+		"containers":       "container",
+		"released":         "releas",
+		"kubernetes":       "kubernet",
+		"go":               "go",
+		"1.16":             "1.16",
+	}
+	for inp, exp := range tbl {
+		assert.Equal(t, exp, Stem(inp), inp)
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	assert.Equal(t, []string{"нов", "верс", "go", "16", "вышл", "release"},
+		Tokenize("Новая версия Go 1.16 вышла! И это release..."))
+	assert.Equal(t, []string{"ежик"}, Tokenize("Ёжики"))
+	assert.Empty(t, Tokenize("и в на"))
+}
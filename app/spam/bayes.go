@@ -0,0 +1,288 @@
+package spam
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/radio-t/super-bot/app/search"
+	"github.com/radio-t/super-bot/app/storage"
+)
+
+// Classifier is a naive-Bayes spam classifier. Spam learned from messages reported by moderators,
+// ham from the whole-day reporter's logs. The model persisted to ModelFile, reported messages
+// also appended to CorpusFile to allow retraining from scratch. Thread safe
+type Classifier struct {
+	ClassifierParams
+
+	lock   sync.RWMutex
+	model  bayesModel
+	store  *storage.JSONFile
+	corpus *storage.JSONLines
+}
+
+// ClassifierParams defines classifier's sources and storage
+type ClassifierParams struct {
+	ModelFile  string // model state, json
+	CorpusFile string // reported spam messages, jsonl
+	LogsPath   string // location of reporter's *.log files, used as ham
+	MinSpam    int    // number of spam samples required to classify, default 10
+}
+
+const (
+	bayesMinCount    = 2  // tokens seen less often are ignored
+	bayesInteresting = 15 // number of tokens with the strongest signal to combine
+)
+
+// CorpusRecord is a reported spam message
+type CorpusRecord struct {
+	Time     time.Time
+	Text     string
+	Reporter string
+}
+
+type bayesModel struct {
+	SpamDocs int
+	HamDocs  int
+	Spam     map[string]int
+	Ham      map[string]int
+	HamLog   string // the last log file learned as ham
+}
+
+// NewClassifier makes classifier and loads the model
+func NewClassifier(params ClassifierParams) (*Classifier, error) {
+	c := &Classifier{ClassifierParams: params, model: bayesModel{Spam: map[string]int{}, Ham: map[string]int{}}}
+	if c.MinSpam == 0 {
+		c.MinSpam = 10
+	}
+
+	var err error
+	if c.store, err = storage.NewJSONFile(params.ModelFile); err != nil {
+		return nil, errors.Wrap(err, "can't make model store")
+	}
+	if err = c.store.Load(&c.model); err != nil {
+		return nil, errors.Wrap(err, "can't load model")
+	}
+	if c.corpus, err = storage.NewJSONLines(params.CorpusFile); err != nil {
+		return nil, errors.Wrap(err, "can't make spam corpus")
+	}
+	log.Printf("[INFO] spam classifier with %d spam and %d ham samples", c.model.SpamDocs, c.model.HamDocs)
+	return c, nil
+}
+
+// Run learns ham from new whole-day logs periodically till ctx canceled
+func (c *Classifier) Run(ctx context.Context, interval time.Duration) {
+	for {
+		if err := c.LearnHamLogs(time.Now()); err != nil {
+			log.Printf("[WARN] can't learn ham from logs, %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// LearnSpam adds reported message to the corpus and the model
+func (c *Classifier) LearnSpam(text, reporter string) error {
+	tokens := tokenize(text)
+	if len(tokens) == 0 {
+		return errors.New("nothing to learn")
+	}
+	if err := c.corpus.Append(CorpusRecord{Time: time.Now(), Text: strings.TrimSpace(text), Reporter: reporter}); err != nil {
+		return errors.Wrap(err, "can't save to corpus")
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.model.SpamDocs++
+	for _, t := range tokens {
+		c.model.Spam[t]++
+	}
+	log.Printf("[INFO] learned spam from %s, %d spam samples", reporter, c.model.SpamDocs)
+	return c.store.Save(c.model)
+}
+
+// LearnHamLogs learns ham from log files of the days before now, each file learned once
+func (c *Classifier) LearnHamLogs(now time.Time) error {
+	if c.LogsPath == "" {
+		return nil
+	}
+	files, err := filepath.Glob(filepath.Join(c.LogsPath, "*.log"))
+	if err != nil {
+		return errors.Wrapf(err, "can't list %s", c.LogsPath)
+	}
+	sort.Strings(files)
+	today := now.Format("20060102") + ".log"
+
+	// reported spam may be in the logs too, it shouldn't be learned as ham
+	reported := map[string]bool{}
+	err = c.corpus.Each(func(line []byte) error {
+		rec := CorpusRecord{}
+		if e := json.Unmarshal(line, &rec); e == nil {
+			reported[strings.TrimSpace(rec.Text)] = true
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "can't read spam corpus")
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	learned := 0
+	for _, f := range files {
+		name := filepath.Base(f)
+		if name <= c.model.HamLog || name >= today {
+			continue
+		}
+		n, err := c.learnHamFile(f, reported)
+		if err != nil {
+			return err
+		}
+		learned += n
+		c.model.HamLog = name
+	}
+	if learned == 0 {
+		return nil
+	}
+	log.Printf("[INFO] learned %d ham messages, up to %s", learned, c.model.HamLog)
+	return c.store.Save(c.model)
+}
+
+// learnHamFile learns all messages of the log file as ham, should be called under lock
+func (c *Classifier) learnHamFile(fileName string, skip map[string]bool) (learned int, err error) {
+	fh, err := os.Open(fileName) //nolint:gosec
+	if err != nil {
+		return 0, errors.Wrapf(err, "can't open %s", fileName)
+	}
+	defer fh.Close() //nolint
+
+	scanner := bufio.NewScanner(fh)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		rec := struct {
+			Text  string
+			Image *struct{ Caption string }
+		}{}
+		if json.Unmarshal(scanner.Bytes(), &rec) != nil {
+			continue
+		}
+		if rec.Image != nil {
+			rec.Text = strings.TrimSpace(rec.Text + " " + rec.Image.Caption)
+		}
+		if skip[strings.TrimSpace(rec.Text)] {
+			continue
+		}
+		tokens := tokenize(rec.Text)
+		if len(tokens) == 0 {
+			continue
+		}
+		c.model.HamDocs++
+		for _, t := range tokens {
+			c.model.Ham[t]++
+		}
+		learned++
+	}
+	return learned, errors.Wrapf(scanner.Err(), "can't read %s", fileName)
+}
+
+// Probability returns spam probability of the text and false if the model is not trained enough
+func (c *Classifier) Probability(text string) (float64, bool) {
+	p, _, ok := c.Explain(text, 0)
+	return p, ok
+}
+
+// Explain returns spam probability of the text with up to n the most spammy tokens
+func (c *Classifier) Explain(text string, n int) (prob float64, tokens []string, ok bool) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	if c.model.SpamDocs < c.MinSpam || c.model.HamDocs == 0 {
+		return 0, nil, false
+	}
+
+	// token probabilities as in Paul Graham's "A Plan for Spam": frequencies normalized by the number
+	// of samples in each class, so priors are equal and the huge ham corpus doesn't drown the spam one.
+	// Rare tokens are ignored, only the most interesting ones are combined
+	probs := map[string]float64{}
+	var known []string
+	for _, t := range tokenize(text) {
+		s, h := c.model.Spam[t], c.model.Ham[t]
+		if s+h < bayesMinCount {
+			continue
+		}
+		ps := math.Min(1, float64(s)/float64(c.model.SpamDocs))
+		ph := math.Min(1, float64(h)/float64(c.model.HamDocs))
+		probs[t] = math.Max(0.01, math.Min(0.99, ps/(ps+ph)))
+		known = append(known, t)
+	}
+	if len(known) == 0 {
+		return 0.5, nil, true
+	}
+
+	sort.SliceStable(known, func(i, j int) bool {
+		return math.Abs(probs[known[i]]-0.5) > math.Abs(probs[known[j]]-0.5)
+	})
+	if len(known) > bayesInteresting {
+		known = known[:bayesInteresting]
+	}
+	logOdds := 0.0
+	for _, t := range known {
+		logOdds += math.Log(probs[t] / (1 - probs[t]))
+	}
+
+	sort.SliceStable(known, func(i, j int) bool { return probs[known[i]] > probs[known[j]] })
+	if len(known) > n {
+		known = known[:n]
+	}
+	return 1 / (1 + math.Exp(-logOdds)), known, true
+}
+
+// tokenize returns unique stemmed words, links reduced to domains
+func tokenize(text string) []string {
+	var words, links []string
+	for _, f := range strings.Fields(text) {
+		if d := linkDomain(f); d != "" {
+			links = append(links, "link:"+d)
+			continue
+		}
+		words = append(words, f)
+	}
+
+	seen := map[string]bool{}
+	res := []string{}
+	for _, t := range append(search.Tokenize(strings.Join(words, " ")), links...) {
+		if !seen[t] {
+			seen[t] = true
+			res = append(res, t)
+		}
+	}
+	return res
+}
+
+func linkDomain(s string) string {
+	if !reLink.MatchString(s) {
+		return ""
+	}
+	s = strings.ToLower(s)
+	for _, p := range []string{"https://", "http://", "www."} {
+		s = strings.TrimPrefix(s, p)
+	}
+	if idx := strings.IndexAny(s, "/?#"); idx > 0 {
+		s = s[:idx]
+	}
+	return s
+}
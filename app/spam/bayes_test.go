@@ -0,0 +1,76 @@
+package spam
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClassifier(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "bayes")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	ham := []string{"привет, как дела", "смотрите новый релиз go https://go.dev/blog", "докер опять сломался",
+		"когда будет выпуск", "слушаю подкаст в машине", "какой ноутбук купить для разработки",
+		"кубернетес не нужен", "а где тема про раст", "заработок в it растет", "ссылка на github https://github.com/radio-t"}
+	var logs []string
+	for i := 0; i < 30; i++ {
+		logs = append(logs, fmt.Sprintf(`{"ID":%d,"From":{"ID":%d},"Text":%q}`, i, i, ham[i%len(ham)]))
+	}
+	logs = append(logs, `{"ID":100,"From":{"ID":100},"Text":"легкий заработок без вложений"}`)
+	require.NoError(t, ioutil.WriteFile(path.Join(tmp, "20210305.log"), []byte(strings.Join(logs, "\n")+"\n"), 0600))
+	require.NoError(t, ioutil.WriteFile(path.Join(tmp, "20210306.log"), []byte(`{"ID":1,"Text":"today"}`+"\n"), 0600))
+
+	params := ClassifierParams{ModelFile: path.Join(tmp, "var", "model.json"), CorpusFile: path.Join(tmp, "var", "corpus.jsonl"),
+		LogsPath: tmp, MinSpam: 3}
+	c, err := NewClassifier(params)
+	require.NoError(t, err)
+
+	_, ok := c.Probability("заработок без вложений")
+	assert.False(t, ok, "not trained")
+
+	spam := []string{"легкий заработок без вложений", "заработок в интернете пишите в лс https://t.me/earn",
+		"пассивный доход без вложений, пишите в лс", "доход от 1000$ в день https://t.me/earn"}
+	for _, s := range spam {
+		require.NoError(t, c.LearnSpam(s, "admin"))
+	}
+	assert.EqualError(t, c.LearnSpam("!!!", "admin"), "nothing to learn")
+
+	require.NoError(t, c.LearnHamLogs(time.Date(2021, 3, 6, 12, 0, 0, 0, time.UTC)))
+	assert.Equal(t, 30, c.model.HamDocs, "reported spam and today's log skipped")
+	assert.Equal(t, "20210305.log", c.model.HamLog)
+
+	require.NoError(t, c.LearnHamLogs(time.Date(2021, 3, 6, 13, 0, 0, 0, time.UTC)))
+	assert.Equal(t, 30, c.model.HamDocs, "learned once")
+
+	p, tokens, ok := c.Explain("заработок без вложений, пишите в лс t.me/earn", 3)
+	require.True(t, ok)
+	assert.True(t, p > 0.98, p)
+	assert.Equal(t, []string{"без", "вложен", "пиш"}, tokens)
+
+	p, ok = c.Probability("новый выпуск подкаста про докер")
+	require.True(t, ok)
+	assert.True(t, p < 0.02, p)
+
+	p, ok = c.Probability("абракадабра")
+	require.True(t, ok)
+	assert.Equal(t, 0.5, p, "unknown tokens are neutral")
+
+	// model persisted
+	c2, err := NewClassifier(params)
+	require.NoError(t, err)
+	assert.Equal(t, c.model, c2.model)
+}
+
+func TestTokenize(t *testing.T) {
+	assert.Equal(t, []string{"пиш", "лс", "link:t.me", "link:example.com"},
+		tokenize("пишите в лс https://t.me/earn?x=1 лс www.example.com/a"))
+}
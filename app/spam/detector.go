@@ -0,0 +1,315 @@
+// Package spam implements heuristic scoring of incoming chat messages. Each signal adds its weight
+// to the message score, the message considered spam if the score reaches the threshold
+package spam
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/pkg/errors"
+
+	"github.com/radio-t/super-bot/app/bot"
+	"github.com/radio-t/super-bot/app/confusable"
+	"github.com/radio-t/super-bot/app/storage"
+)
+
+// Detector scores messages. It counts messages per user to tell first-time posters from regulars,
+// the counters can be primed from reporter's logs. Thread safe
+type Detector struct {
+	Params
+
+	lock    sync.Mutex
+	phrases []phrase
+	posts   map[int]int // messages count by user ID
+}
+
+// phrase is a spam phrase with its confusable skeleton
+type phrase struct {
+	text     string
+	skeleton string
+}
+
+// Params defines detector's tuning. Zero values replaced by defaults
+type Params struct {
+	PhrasesFile string  // spam phrases, one per line, case insensitive, # for comments
+	LogsPath    string  // location of reporter's *.log files to learn regular posters, optional
+	Threshold   float64 // score to consider message as spam, default 1
+	TrustAfter  int     // number of messages to stop being a first-time poster, default 3
+	Classifier  Scorer  // optional, trained classifier applied to first-time posters
+}
+
+// Scorer returns spam probability of the text, false if it can't judge yet
+type Scorer interface {
+	Probability(text string) (float64, bool)
+}
+
+// Result is a verdict with all signals contributed to the score
+type Result struct {
+	Score   float64
+	Spam    bool
+	Flag    bool     // suspicious, should be checked by moderators
+	Signals []string `json:",omitempty"`
+}
+
+// weights of signals
+const (
+	weightLink          = 0.6 // link from first-time poster
+	weightMention       = 0.3 // mention from first-time poster
+	weightPhrase        = 0.5 // each known spam phrase, up to two
+	weightEmoji         = 0.3 // too many emoji
+	weightCaps          = 0.3 // too many capital letters
+	weightForward       = 0.4 // forwarded channel post
+	weightForwardNewbie = 0.3 // additional for forwarded channel post from first-time poster
+	weightMixedScript   = 0.4 // words mixing cyrillic and latin letters
+	weightBayesSpam     = 1.0 // classifier is sure it is spam
+	weightBayesFlag     = 0.3 // classifier suspects spam
+)
+
+// classifier's probabilities to act on
+const (
+	bayesSpam = 0.98
+	bayesFlag = 0.8
+)
+
+var reLink = regexp.MustCompile(`(?i)(https?://|www\.|t\.me/|\w+\.(com|ru|io|me|org|net|xyz|site|online)/)`)
+
+// NewDetector makes Detector, loads phrases and primes posters from logs
+func NewDetector(params Params) (*Detector, error) {
+	d := &Detector{Params: params, posts: map[int]int{}}
+	if d.Threshold == 0 {
+		d.Threshold = 1
+	}
+	if d.TrustAfter == 0 {
+		d.TrustAfter = 3
+	}
+
+	if d.PhrasesFile != "" {
+		phrases, err := loadPhrases(d.PhrasesFile)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range phrases {
+			d.phrases = append(d.phrases, phrase{text: p, skeleton: confusable.Skeleton(p)})
+		}
+	}
+
+	if d.LogsPath != "" {
+		if err := d.prime(); err != nil {
+			return nil, err
+		}
+	}
+	log.Printf("[INFO] spam detector with %d phrases, threshold %.2f, %d known posters",
+		len(d.phrases), d.Threshold, len(d.posts))
+	return d, nil
+}
+
+// Check scores the message. Messages not recognized as spam count toward author's trust
+func (d *Detector) Check(msg bot.Message) Result {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	text := msg.Text
+	entities := msg.Entities
+	if msg.Image != nil {
+		text = strings.TrimSpace(text + " " + msg.Image.Caption)
+		if entities == nil {
+			entities = msg.Image.Entities
+		}
+	}
+
+	res := Result{}
+	add := func(weight float64, signal string) {
+		res.Score += weight
+		res.Signals = append(res.Signals, signal)
+	}
+
+	newbie := d.posts[msg.From.ID] < d.TrustAfter
+	if newbie {
+		if hasEntity(entities, "url", "text_link") || reLink.MatchString(text) {
+			add(weightLink, "link from first-time poster")
+		}
+		if hasEntity(entities, "mention", "text_mention") || strings.Contains(text, "@") {
+			add(weightMention, "mention from first-time poster")
+		}
+		if d.Classifier != nil {
+			if p, ok := d.Classifier.Probability(text); ok {
+				switch {
+				case p >= bayesSpam:
+					add(weightBayesSpam, fmt.Sprintf("classifier: %.2f", p))
+				case p >= bayesFlag:
+					add(weightBayesFlag, fmt.Sprintf("classifier: %.2f", p))
+					res.Flag = true
+				}
+			}
+		}
+	}
+
+	skeleton := confusable.Skeleton(text) // phrases written with lookalike characters match too
+	found := 0
+	for _, p := range d.phrases {
+		if found < 2 && strings.Contains(skeleton, p.skeleton) {
+			add(weightPhrase, "spam phrase: "+p.text)
+			found++
+		}
+	}
+
+	if tooManyEmoji(text) {
+		add(weightEmoji, "too many emoji")
+	}
+	if tooManyCaps(text) {
+		add(weightCaps, "too many caps")
+	}
+
+	if msg.Forward != nil && msg.Forward.Channel {
+		add(weightForward, "forwarded from channel "+msg.Forward.Title)
+		if newbie {
+			add(weightForwardNewbie, "forward from first-time poster")
+		}
+	}
+
+	if words := mixedScriptWords(text); len(words) > 0 {
+		add(weightMixedScript, "mixed cyrillic and latin: "+strings.Join(words, ", "))
+	}
+
+	res.Spam = res.Score >= d.Threshold
+	res.Flag = res.Flag && !res.Spam
+	if !res.Spam {
+		d.posts[msg.From.ID]++
+	}
+	return res
+}
+
+// prime counts posters from the logs
+func (d *Detector) prime() error {
+	tail := storage.NewLogTail(d.LogsPath)
+	err := tail.Read(func(_ string, line []byte) {
+		rec := struct{ From struct{ ID int } }{}
+		if err := json.Unmarshal(line, &rec); err != nil || rec.From.ID == 0 {
+			return
+		}
+		d.posts[rec.From.ID]++
+	})
+	return errors.Wrap(err, "can't read logs")
+}
+
+func loadPhrases(fileName string) ([]string, error) {
+	fh, err := os.Open(fileName) //nolint:gosec
+	if err != nil {
+		return nil, errors.Wrapf(err, "can't open %s", fileName)
+	}
+	defer fh.Close() //nolint
+
+	var res []string
+	scanner := bufio.NewScanner(fh)
+	for scanner.Scan() {
+		line := strings.ToLower(strings.TrimSpace(scanner.Text()))
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		res = append(res, line)
+	}
+	return res, errors.Wrapf(scanner.Err(), "can't read %s", fileName)
+}
+
+func hasEntity(entities *[]bot.Entity, types ...string) bool {
+	if entities == nil {
+		return false
+	}
+	for _, e := range *entities {
+		for _, t := range types {
+			if e.Type == t {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// tooManyEmoji checks for at least 5 emoji taking more than third of the message
+func tooManyEmoji(text string) bool {
+	emoji, total := 0, 0
+	for _, r := range text {
+		if unicode.IsSpace(r) {
+			continue
+		}
+		total++
+		if isEmoji(r) {
+			emoji++
+		}
+	}
+	return emoji >= 5 && emoji*3 > total
+}
+
+func isEmoji(r rune) bool {
+	return (r >= 0x1F300 && r <= 0x1FAFF) || (r >= 0x2600 && r <= 0x27BF) || (r >= 0x1F000 && r <= 0x1F2FF)
+}
+
+// tooManyCaps checks for at least 20 letters with more than 70% in upper case
+func tooManyCaps(text string) bool {
+	upper, letters := 0, 0
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		if unicode.IsUpper(r) {
+			upper++
+		}
+	}
+	return letters >= 20 && upper*10 > letters*7
+}
+
+// mixedScriptWords returns cyrillic words with latin homoglyphs, i.e. "пpoдaм" with latin "p", "o" and "a".
+// Words with latin letters not looking like russian ones, i.e. "Dockerом", are not counted, as well as
+// latin words with a short russian ending, i.e. "PRы"
+func mixedScriptWords(text string) []string {
+	var res []string
+	for _, w := range strings.FieldsFunc(text, func(r rune) bool { return !unicode.IsLetter(r) }) {
+		var cyr, lat, latPrefix int
+		homoglyphs := true
+		for i, r := range []rune(w) {
+			switch {
+			case unicode.Is(unicode.Cyrillic, r):
+				cyr++
+			case unicode.Is(unicode.Latin, r):
+				lat++
+				homoglyphs = homoglyphs && latinHomoglyphs[r]
+				if lat == i+1 {
+					latPrefix++
+				}
+			}
+		}
+		if lat == 0 || cyr == 0 || !homoglyphs || cyr+lat < 3 {
+			continue
+		}
+		if latPrefix == lat && lat >= 2 && cyr <= 3 {
+			continue // inflected latin word
+		}
+		res = append(res, w)
+	}
+	return res
+}
+
+// latinHomoglyphs is a set of latin letters with the same skeleton as russian letters of the same case
+var latinHomoglyphs = func() map[rune]bool {
+	res := map[rune]bool{}
+	for _, r := range []rune("абвгдеёжзийклмнопрстуфхцчшщъыьэюяАБВГДЕЁЖЗИЙКЛМНОПРСТУФХЦЧШЩЪЫЬЭЮЯ") {
+		sk := []rune(confusable.Skeleton(string(r)))
+		if len(sk) != 1 || !unicode.Is(unicode.Latin, sk[0]) {
+			continue
+		}
+		if unicode.IsUpper(r) {
+			res[unicode.ToUpper(sk[0])] = true
+			continue
+		}
+		res[unicode.ToLower(sk[0])] = true
+	}
+	return res
+}()
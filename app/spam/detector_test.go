@@ -0,0 +1,114 @@
+package spam
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/radio-t/super-bot/app/bot"
+)
+
+func TestDetector_Check(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "spam")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	phrases := path.Join(tmp, "spam.data")
+	require.NoError(t, ioutil.WriteFile(phrases, []byte("# comment\nзаработок в интернете\nПишите в ЛС\n\n"), 0600))
+	logs := `{"ID":1,"From":{"ID":100,"Username":"regular"},"Text":"привет"}
+{"ID":2,"From":{"ID":100,"Username":"regular"},"Text":"как дела"}
+{"ID":3,"From":{"ID":100,"Username":"regular"},"Text":"ок"}
+`
+	require.NoError(t, ioutil.WriteFile(path.Join(tmp, "20210306.log"), []byte(logs), 0600))
+
+	d, err := NewDetector(Params{PhrasesFile: phrases, LogsPath: tmp})
+	require.NoError(t, err)
+
+	regular, newbie := bot.User{ID: 100, Username: "regular"}, bot.User{ID: 200, Username: "newbie"}
+	links := &[]bot.Entity{{Type: "url", Offset: 0, Length: 19}}
+
+	tbl := []struct {
+		msg bot.Message
+		res Result
+	}{
+		{bot.Message{From: regular, Text: "https://radio-t.com смотрите", Entities: links}, Result{}},
+		{bot.Message{From: newbie, Text: "https://radio-t.com смотрите", Entities: links},
+			Result{Score: 0.6, Signals: []string{"link from first-time poster"}}},
+		{bot.Message{From: newbie, Text: "Заработок в интернете, пишите в лс @spammer"},
+			Result{Score: 1.3, Spam: true, Signals: []string{"mention from first-time poster",
+				"spam phrase: заработок в интернете", "spam phrase: пишите в лс"}}},
+		{bot.Message{From: regular, Text: "🔥🔥🔥🔥🔥 акция 🔥"},
+			Result{Score: 0.3, Signals: []string{"too many emoji"}}},
+		{bot.Message{From: regular, Text: "ВСЕ СЮДА СРОЧНО СМОТРИТЕ ЭТО ВИДЕО"},
+			Result{Score: 0.3, Signals: []string{"too many caps"}}},
+		{bot.Message{From: regular, Text: "пpoдaм гараж"},
+			Result{Score: 0.4, Signals: []string{"mixed cyrillic and latin: пpoдaм"}}},
+		{bot.Message{From: newbie, Text: "https://github.com залил в Dockerе образ, PRы и Xeonами, в Slackе", Entities: links},
+			Result{Score: 0.6, Signals: []string{"link from first-time poster"}}},
+		{bot.Message{From: regular, Text: "зapaбoтoк в интернете"},
+			Result{Score: 0.9, Signals: []string{"spam phrase: заработок в интернете", "mixed cyrillic and latin: зapaбoтoк"}}},
+		{bot.Message{From: regular, Text: "новости", Forward: &bot.Forward{Channel: true, Title: "Crypto"}},
+			Result{Score: 0.4, Signals: []string{"forwarded from channel Crypto"}}},
+		{bot.Message{From: bot.User{ID: 300}, Image: &bot.Image{Caption: "доход t.me/crypto"},
+			Forward: &bot.Forward{Channel: true, Title: "Crypto"}},
+			Result{Score: 1.3, Spam: true, Signals: []string{"link from first-time poster",
+				"forwarded from channel Crypto", "forward from first-time poster"}}},
+	}
+
+	for i, tt := range tbl {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			res := d.Check(tt.msg)
+			assert.InDelta(t, tt.res.Score, res.Score, 0.001)
+			assert.Equal(t, tt.res.Spam, res.Spam)
+			assert.Equal(t, tt.res.Signals, res.Signals)
+		})
+	}
+}
+
+func TestDetector_Trust(t *testing.T) {
+	d, err := NewDetector(Params{TrustAfter: 2})
+	require.NoError(t, err)
+	u := bot.User{ID: 1}
+
+	assert.Equal(t, 0.6, d.Check(bot.Message{From: u, Text: "www.example.com"}).Score)
+	assert.Equal(t, 0.6, d.Check(bot.Message{From: u, Text: "www.example.com"}).Score)
+	assert.Equal(t, 0.0, d.Check(bot.Message{From: u, Text: "www.example.com"}).Score, "trusted after two messages")
+}
+
+func TestNewDetector_NoPhrases(t *testing.T) {
+	_, err := NewDetector(Params{PhrasesFile: "/tmp/no-such-file.data"})
+	assert.Error(t, err)
+}
+
+type scorerMock struct{ prob float64 }
+
+func (s scorerMock) Probability(string) (float64, bool) { return s.prob, s.prob > 0 }
+
+func TestDetector_CheckWithClassifier(t *testing.T) {
+	tbl := []struct {
+		prob float64
+		res  Result
+	}{
+		{0, Result{}},
+		{0.5, Result{}},
+		{0.85, Result{Score: 0.3, Flag: true, Signals: []string{"classifier: 0.85"}}},
+		{0.99, Result{Score: 1, Spam: true, Signals: []string{"classifier: 0.99"}}},
+	}
+
+	for i, tt := range tbl {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			d, err := NewDetector(Params{Classifier: scorerMock{prob: tt.prob}, TrustAfter: 1})
+			require.NoError(t, err)
+			assert.Equal(t, tt.res, d.Check(bot.Message{From: bot.User{ID: 1}, Text: "some text"}))
+			if !tt.res.Spam {
+				assert.Equal(t, Result{}, d.Check(bot.Message{From: bot.User{ID: 1}, Text: "some text"}),
+					"classifier applied to first-time posters only")
+			}
+		})
+	}
+}
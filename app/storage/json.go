@@ -0,0 +1,58 @@
+package storage
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// JSONFile keeps a single json-encoded value in the local file.
+// Used by bots to persist their state between restarts
+type JSONFile struct {
+	path string
+	lock sync.Mutex
+}
+
+// NewJSONFile makes JSONFile for given path, creates the parent directory if needed
+func NewJSONFile(path string) (*JSONFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return nil, errors.Wrapf(err, "can't make directory for %s", path)
+	}
+	return &JSONFile{path: path}, nil
+}
+
+// Load reads file and decodes it to v. Missing file is not an error, v left untouched in this case
+func (j *JSONFile) Load(v interface{}) error {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	data, err := ioutil.ReadFile(j.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return errors.Wrapf(err, "can't read %s", j.path)
+	}
+	return errors.Wrapf(json.Unmarshal(data, v), "can't decode %s", j.path)
+}
+
+// Save encodes v and writes it to the file. The write is atomic, done via temp file and rename
+func (j *JSONFile) Save(v interface{}) error {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "can't encode")
+	}
+
+	tmp := j.path + ".tmp"
+	if err = ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return errors.Wrapf(err, "can't write %s", tmp)
+	}
+	return errors.Wrapf(os.Rename(tmp, j.path), "can't rename %s", tmp)
+}
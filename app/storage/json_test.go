@@ -0,0 +1,49 @@
+package storage
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJSONFile_SaveLoad(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	type rec struct {
+		Name  string
+		Count int
+	}
+
+	j, err := NewJSONFile(path.Join(tmp, "sub", "state.json"))
+	require.NoError(t, err)
+
+	r := rec{Name: "default"}
+	require.NoError(t, j.Load(&r), "missing file is fine")
+	assert.Equal(t, rec{Name: "default"}, r)
+
+	require.NoError(t, j.Save(rec{Name: "blah", Count: 42}))
+	require.NoError(t, j.Load(&r))
+	assert.Equal(t, rec{Name: "blah", Count: 42}, r)
+
+	_, err = os.Stat(path.Join(tmp, "sub", "state.json.tmp"))
+	assert.True(t, os.IsNotExist(err), "temp file removed")
+}
+
+func TestJSONFile_LoadBroken(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	require.NoError(t, ioutil.WriteFile(path.Join(tmp, "state.json"), []byte("{not json"), 0600))
+	j, err := NewJSONFile(path.Join(tmp, "state.json"))
+	require.NoError(t, err)
+
+	var v map[string]string
+	assert.Error(t, j.Load(&v))
+}
@@ -0,0 +1,74 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// JSONLines is an append-only file with one json-encoded record per line.
+// Used for audit trails which should survive restarts and be easy to export
+type JSONLines struct {
+	path string
+	lock sync.Mutex
+}
+
+// NewJSONLines makes JSONLines for given path, creates the parent directory if needed
+func NewJSONLines(path string) (*JSONLines, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return nil, errors.Wrapf(err, "can't make directory for %s", path)
+	}
+	return &JSONLines{path: path}, nil
+}
+
+// Append encodes v and adds it as a new line
+func (j *JSONLines) Append(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return errors.Wrap(err, "can't encode")
+	}
+
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	fh, err := os.OpenFile(j.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return errors.Wrapf(err, "can't open %s", j.path)
+	}
+	if _, err = fh.Write(append(data, '\n')); err != nil {
+		_ = fh.Close()
+		return errors.Wrapf(err, "can't write %s", j.path)
+	}
+	return errors.Wrapf(fh.Close(), "can't close %s", j.path)
+}
+
+// Each calls fn for every line in order, stops on the first fn error. Missing file is not an error
+func (j *JSONLines) Each(fn func(line []byte) error) error {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+
+	fh, err := os.Open(j.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return errors.Wrapf(err, "can't open %s", j.path)
+	}
+	defer fh.Close() //nolint
+
+	scanner := bufio.NewScanner(fh)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		if err := fn(scanner.Bytes()); err != nil {
+			return err
+		}
+	}
+	return errors.Wrapf(scanner.Err(), "can't read %s", j.path)
+}
@@ -0,0 +1,47 @@
+package storage
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJSONLines(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	type rec struct {
+		ID   int
+		Text string
+	}
+
+	jl, err := NewJSONLines(path.Join(tmp, "sub", "audit.jsonl"))
+	require.NoError(t, err)
+
+	var res []rec
+	collect := func(line []byte) error {
+		r := rec{}
+		if err := json.Unmarshal(line, &r); err != nil {
+			return err
+		}
+		res = append(res, r)
+		return nil
+	}
+	require.NoError(t, jl.Each(collect), "missing file is fine")
+	assert.Empty(t, res)
+
+	require.NoError(t, jl.Append(rec{ID: 1, Text: "one"}))
+	require.NoError(t, jl.Append(rec{ID: 2, Text: "two\nlines"}))
+	require.NoError(t, jl.Each(collect))
+	assert.Equal(t, []rec{{1, "one"}, {2, "two\nlines"}}, res)
+
+	err = jl.Each(func([]byte) error { return errors.New("stop") })
+	assert.EqualError(t, err, "stop")
+}
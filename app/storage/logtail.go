@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// LogTail reads reporter's daily *.log files incrementally. Each Read call passes only complete lines
+// appended since the previous call. Files older than the last processed one are never re-read.
+// Not thread safe
+type LogTail struct {
+	path     string
+	offsets  map[string]int64 // read offset by file name
+	lastFile string
+}
+
+// NewLogTail makes LogTail for the logs directory
+func NewLogTail(path string) *LogTail {
+	return &LogTail{path: path, offsets: map[string]int64{}}
+}
+
+// Read calls fn for every new line, in files order
+func (t *LogTail) Read(fn func(fileName string, line []byte)) error {
+	files, err := filepath.Glob(filepath.Join(t.path, "*.log"))
+	if err != nil {
+		return errors.Wrapf(err, "can't list %s", t.path)
+	}
+	sort.Strings(files)
+
+	for _, f := range files {
+		name := filepath.Base(f)
+		if name < t.lastFile {
+			continue
+		}
+		if err := t.readFile(f, fn); err != nil {
+			return err
+		}
+		t.lastFile = name
+	}
+	return nil
+}
+
+func (t *LogTail) readFile(fname string, fn func(fileName string, line []byte)) error {
+	fh, err := os.Open(fname) //nolint:gosec
+	if err != nil {
+		return errors.Wrapf(err, "can't open %s", fname)
+	}
+	defer fh.Close() //nolint
+
+	name := filepath.Base(fname)
+	if _, err = fh.Seek(t.offsets[name], io.SeekStart); err != nil {
+		return errors.Wrapf(err, "can't seek %s", fname)
+	}
+	data, err := ioutil.ReadAll(fh)
+	if err != nil {
+		return errors.Wrapf(err, "can't read %s", fname)
+	}
+
+	// the last line may be incomplete if reporter is writing right now
+	idx := bytes.LastIndexByte(data, '\n')
+	if idx < 0 {
+		return nil
+	}
+	data = data[:idx+1]
+	t.offsets[name] += int64(len(data))
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		fn(name, scanner.Bytes())
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,45 @@
+package storage
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogTail_Read(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	require.NoError(t, ioutil.WriteFile(path.Join(tmp, "20200214.log"), []byte("l1\nl2\n"), 0600))
+	require.NoError(t, ioutil.WriteFile(path.Join(tmp, "20200215.log"), []byte("l3\nl4-partial"), 0600))
+	require.NoError(t, ioutil.WriteFile(path.Join(tmp, "something.txt"), []byte("ignored\n"), 0600))
+
+	var lines []string
+	collect := func(fname string, line []byte) { lines = append(lines, fname+":"+string(line)) }
+
+	lt := NewLogTail(tmp)
+	require.NoError(t, lt.Read(collect))
+	assert.Equal(t, []string{"20200214.log:l1", "20200214.log:l2", "20200215.log:l3"}, lines)
+
+	fh, err := os.OpenFile(path.Join(tmp, "20200215.log"), os.O_APPEND|os.O_WRONLY, 0600)
+	require.NoError(t, err)
+	_, err = fh.WriteString("-done\nl5\n")
+	require.NoError(t, err)
+	require.NoError(t, fh.Close())
+
+	// older files are not re-read even if changed
+	require.NoError(t, ioutil.WriteFile(path.Join(tmp, "20200214.log"), []byte("l1\nl2\nl2-late\n"), 0600))
+
+	lines = nil
+	require.NoError(t, lt.Read(collect))
+	assert.Equal(t, []string{"20200215.log:l4-partial-done", "20200215.log:l5"}, lines)
+
+	lines = nil
+	require.NoError(t, lt.Read(collect))
+	assert.Empty(t, lines)
+}